@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// option is a choice the reader can make at the end of an arc.
+// A plain option always leads to ArcOption. An option with
+// Outcomes picks one of them at random by weight, and an option
+// with a Roll leads to Roll.Success or Roll.Failure depending
+// on a dice roll. Set adds to the story variables when the
+// option is chosen.
+type option struct {
+	TextOption string         `json:"text"`
+	ArcOption  string         `json:"arc,omitempty"`
+	Outcomes   []outcome      `json:"outcomes,omitempty"`
+	Roll       *roll          `json:"roll,omitempty"`
+	Set        map[string]int `json:"set,omitempty"`
+}
+
+// outcome is one possible destination of a weighted option
+type outcome struct {
+	Arc    string `json:"arc"`
+	Weight int    `json:"weight"`
+}
+
+// roll is a dice check, e.g. 2d6 plus the "luck"
+// variable must meet or beat a target of 8
+type roll struct {
+	Dice    string `json:"dice"`
+	Stat    string `json:"stat,omitempty"`
+	Target  int    `json:"target"`
+	Success string `json:"success"`
+	Failure string `json:"failure"`
+}
+
+// Chance reports whether the option's destination is random
+func (o option) Chance() bool {
+	return len(o.Outcomes) > 0 || o.Roll != nil
+}
+
+// Plain reports whether choosing the option only leads to
+// ArcOption, so it can be a link straight there. Options with
+// a chance or a Set have to be chosen by posting a choice.
+func (o option) Plain() bool {
+	return !o.Chance() && len(o.Set) == 0
+}
+
+// arcs lists every arc the option can lead to
+func (o option) arcs() []string {
+	switch {
+	case o.Roll != nil:
+		return []string{o.Roll.Success, o.Roll.Failure}
+	case len(o.Outcomes) > 0:
+		var arcs []string
+		for _, oc := range o.Outcomes {
+			arcs = append(arcs, oc.Arc)
+		}
+		return arcs
+	default:
+		return []string{o.ArcOption}
+	}
+}
+
+// roller is a source of randomness that's safe to share
+// between requests. Seeding it with the same value gives
+// the same playthrough.
+type roller struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+// newRoller creates a roller from seed, using the
+// current time if seed is 0
+func newRoller(seed int64) *roller {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &roller{r: rand.New(rand.NewSource(seed))}
+}
+
+// intn returns a random number in [0, n)
+func (r *roller) intn(n int) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.r.Intn(n)
+}
+
+// choose resolves the arc an option leads to and applies its
+// variable changes to vars. The returned note describes what
+// happened for chance options and is empty otherwise.
+func (r *roller) choose(o option, vars map[string]int) (next string, note string, err error) {
+	for k, v := range o.Set {
+		vars[k] += v
+	}
+
+	switch {
+	case o.Roll != nil:
+		n, sides, err := parseDice(o.Roll.Dice)
+		if err != nil {
+			return "", "", err
+		}
+		total := 0
+		for i := 0; i < n; i++ {
+			total += r.intn(sides) + 1
+		}
+		note = fmt.Sprintf("Rolled %s: %d", o.Roll.Dice, total)
+		if o.Roll.Stat != "" {
+			total += vars[o.Roll.Stat]
+			note += fmt.Sprintf(" + %s %d = %d", o.Roll.Stat, vars[o.Roll.Stat], total)
+		}
+		if total >= o.Roll.Target {
+			return o.Roll.Success, note + fmt.Sprintf(", beating %d.", o.Roll.Target), nil
+		}
+		return o.Roll.Failure, note + fmt.Sprintf(", short of %d.", o.Roll.Target), nil
+
+	case len(o.Outcomes) > 0:
+		sum := 0
+		for _, oc := range o.Outcomes {
+			sum += oc.Weight
+		}
+		pick := r.intn(sum)
+		for _, oc := range o.Outcomes {
+			if pick < oc.Weight {
+				return oc.Arc, "Fate decides...", nil
+			}
+			pick -= oc.Weight
+		}
+	}
+	return o.ArcOption, "", nil
+}
+
+// parseDice parses dice notation like "2d6" into the
+// number of dice and the number of sides on each
+func parseDice(s string) (n, sides int, err error) {
+	parts := strings.SplitN(strings.ToLower(s), "d", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("dice %q should look like 2d6", s)
+	}
+	n = 1
+	if parts[0] != "" {
+		if n, err = strconv.Atoi(parts[0]); err != nil {
+			return 0, 0, fmt.Errorf("dice %q has an invalid count: %s", s, err)
+		}
+	}
+	if sides, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, fmt.Errorf("dice %q has invalid sides: %s", s, err)
+	}
+	if n < 1 || sides < 1 {
+		return 0, 0, fmt.Errorf("dice %q needs at least one die with at least one side", s)
+	}
+	return n, sides, nil
+}
+
+// validateStory checks that every option leads somewhere
+// that exists and that chance options are well formed
+func validateStory(s map[string]arc) error {
+	for name, a := range s {
+		for i, o := range a.Options {
+			if o.Roll != nil {
+				if _, _, err := parseDice(o.Roll.Dice); err != nil {
+					return fmt.Errorf("arc %q option %d: %s", name, i, err)
+				}
+			}
+			for _, oc := range o.Outcomes {
+				if oc.Weight < 1 {
+					return fmt.Errorf("arc %q option %d: outcome %q needs a positive weight", name, i, oc.Arc)
+				}
+			}
+			for _, next := range o.arcs() {
+				if _, ok := s[next]; !ok {
+					return fmt.Errorf("arc %q option %d leads to unknown arc %q", name, i, next)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const chanceStoryJSON = `{
+	"intro": {
+		"title": "The Fork",
+		"story": ["Two paths."],
+		"options": [
+			{"text": "Trust fate", "outcomes": [{"arc": "arc_a", "weight": 70}, {"arc": "arc_b", "weight": 30}]},
+			{"text": "Train first", "arc": "gym", "set": {"strength": 3}}
+		]
+	},
+	"gym": {
+		"title": "The Gym",
+		"story": ["You feel stronger."],
+		"options": [
+			{"text": "Lift the rock", "roll": {"dice": "1d6", "stat": "strength", "target": 6, "success": "arc_a", "failure": "arc_b"}},
+			{"text": "Go back", "arc": "intro"}
+		]
+	},
+	"arc_a": {"title": "Path A", "story": ["A."]},
+	"arc_b": {"title": "Path B", "story": ["B."]}
+}`
+
+func chanceStory(t *testing.T) map[string]arc {
+	t.Helper()
+	var s map[string]arc
+	if err := json.Unmarshal([]byte(chanceStoryJSON), &s); err != nil {
+		t.Fatalf("failed to unmarshal chance story, err: %s", err)
+	}
+	if err := validateStory(s); err != nil {
+		t.Fatalf("chance story should be valid, err: %s", err)
+	}
+	return s
+}
+
+func TestParseDice(t *testing.T) {
+	testCases := []struct {
+		dice      string
+		wantN     int
+		wantSides int
+		wantErr   bool
+	}{
+		{"2d6", 2, 6, false},
+		{"d20", 1, 20, false},
+		{"3D8", 3, 8, false},
+		{"6", 0, 0, true},
+		{"0d6", 0, 0, true},
+		{"2dx", 0, 0, true},
+	}
+
+	for _, tc := range testCases {
+		n, sides, err := parseDice(tc.dice)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("parseDice(%q) error = %v, wantErr %v", tc.dice, err, tc.wantErr)
+			continue
+		}
+		if n != tc.wantN || sides != tc.wantSides {
+			t.Errorf("parseDice(%q) = %d, %d want %d, %d", tc.dice, n, sides, tc.wantN, tc.wantSides)
+		}
+	}
+}
+
+func TestChooseWeighted(t *testing.T) {
+	s := chanceStory(t)
+	fate := s["intro"].Options[0]
+
+	// The same seed should give the same run of outcomes.
+	run := func(seed int64) []string {
+		r := newRoller(seed)
+		var got []string
+		for i := 0; i < 20; i++ {
+			next, _, err := r.choose(fate, map[string]int{})
+			if err != nil {
+				t.Fatalf("failed to choose, err: %s", err)
+			}
+			got = append(got, next)
+		}
+		return got
+	}
+	if first, second := run(42), run(42); !reflect.DeepEqual(first, second) {
+		t.Errorf("same seed gave different outcomes:\n%v\n%v", first, second)
+	}
+
+	// Outcomes should roughly follow their weights.
+	r := newRoller(7)
+	counts := map[string]int{}
+	for i := 0; i < 10000; i++ {
+		next, _, _ := r.choose(fate, map[string]int{})
+		counts[next]++
+	}
+	if counts["arc_a"] < 6500 || counts["arc_a"] > 7500 {
+		t.Errorf("arc_a should be chosen about 70%% of the time, got %v", counts)
+	}
+}
+
+func TestChooseRoll(t *testing.T) {
+	s := chanceStory(t)
+	lift := s["gym"].Options[0]
+	r := newRoller(1)
+
+	// With strength 5 a 1d6 roll always beats 6.
+	for i := 0; i < 50; i++ {
+		next, note, err := r.choose(lift, map[string]int{"strength": 5})
+		if err != nil {
+			t.Fatalf("failed to choose, err: %s", err)
+		}
+		if next != "arc_a" {
+			t.Errorf("got %s want arc_a, note: %s", next, note)
+		}
+	}
+
+	// Without strength it should fail 5 times in 6.
+	fails := 0
+	for i := 0; i < 600; i++ {
+		if next, _, _ := r.choose(lift, map[string]int{}); next == "arc_b" {
+			fails++
+		}
+	}
+	if fails < 400 || fails == 600 {
+		t.Errorf("got %d fails out of 600 rolls", fails)
+	}
+}
+
+func TestValidateStory(t *testing.T) {
+	s := chanceStory(t)
+	s["intro"].Options[0].Outcomes[1].Arc = "nowhere"
+	if err := validateStory(s); err == nil {
+		t.Error("should have received error for an outcome leading to an unknown arc")
+	}
+
+	s = chanceStory(t)
+	s["gym"].Options[0].Roll.Dice = "lots"
+	if err := validateStory(s); err == nil {
+		t.Error("should have received error for malformed dice")
+	}
+}
+
+func TestPlayStorySeeded(t *testing.T) {
+	s := chanceStory(t)
+	play := func(seed int64) string {
+		var out strings.Builder
+		if err := playStory(s, newRoller(seed), strings.NewReader("2\n1\n"), &out); err != nil {
+			t.Fatalf("failed to play story, err: %s", err)
+		}
+		return out.String()
+	}
+
+	got := play(3)
+	if got != play(3) {
+		t.Error("playthroughs with the same seed should match")
+	}
+	if !strings.Contains(got, "Rolled 1d6") || !strings.Contains(got, "+ strength 3") {
+		t.Errorf("playthrough should describe the roll with the strength bonus, got:\n%s", got)
+	}
+}
+
+func TestStoryHandlerChoice(t *testing.T) {
+	tmpl := template.Must(template.New("test").Parse(storyTemplate))
+	handler := NewStoryHandler(chanceStory(t), tmpl, newRoller(1))
+
+	// Chance options and ones with a Set are buttons posting
+	// a choice, and plain ones link straight to their arc.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/intro", nil))
+	body := rec.Body.String()
+	buttons := regexp.MustCompile(`<form method="post"[^>]*>\s*<button name="(\w+)" value="(\d+)">([^<]*)</button>`).FindAllStringSubmatch(body, -1)
+	if len(buttons) != 2 || buttons[0][3] != "Trust fate 🎲" || buttons[1][3] != "Train first" {
+		t.Fatalf("intro should have buttons for choices 0 and 1, got:\n%s", body)
+	}
+	onIntro := cookie(t, rec, arcCookie)
+
+	// A GET, like a prefetch, chooses nothing.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/intro?choice=1", nil))
+	if rec.Code != http.StatusOK || cookie(t, rec, varsCookie) != nil {
+		t.Errorf("GET with a choice = %d, cookies %v, want the page and no vars", rec.Code, rec.Result().Cookies())
+	}
+
+	// Pressing the rendered button for the option with a Set
+	// stores the variable.
+	post := func(path, name, value string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{name: {value}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = post("/intro", buttons[1][1], buttons[1][2], onIntro)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/gym" {
+		t.Fatalf("got status %d location %q want redirect to /gym", rec.Code, rec.Header().Get("Location"))
+	}
+	if c := cookie(t, rec, varsCookie); c == nil || c.Value != "strength=3" {
+		t.Fatalf("should have set the strength cookie, got %v", rec.Result().Cookies())
+	}
+
+	// A plain option links straight to its arc.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/gym", nil))
+	if body := rec.Body.String(); !strings.Contains(body, `value="0">Lift the rock`) || !strings.Contains(body, `href="/intro"`) {
+		t.Errorf("gym should have a button for choice 0 and link to the intro, got:\n%s", body)
+	}
+	onGym := cookie(t, rec, arcCookie)
+
+	// Choosing again in an arc the reader has left does nothing.
+	if rec := post("/intro", "choice", "1", onGym); rec.Code != http.StatusConflict || cookie(t, rec, varsCookie) != nil {
+		t.Errorf("choosing in a left arc = %d, cookies %v, want %d and no vars", rec.Code, rec.Result().Cookies(), http.StatusConflict)
+	}
+	if rec := post("/intro", "choice", "1"); rec.Code != http.StatusConflict {
+		t.Errorf("choosing without an arc cookie = %d, want %d", rec.Code, http.StatusConflict)
+	}
+
+	// The stored strength makes the roll always succeed.
+	rec = post("/gym", "choice", "0", onGym, &http.Cookie{Name: varsCookie, Value: "strength=5"})
+	if loc := rec.Header().Get("Location"); loc != "/arc_a" {
+		t.Errorf("got location %q want /arc_a", loc)
+	}
+
+	// Choices that don't exist are not found.
+	if rec := post("/gym", "choice", "4", onGym); rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+// cookie returns the cookie called name that rec sets, or nil.
+func cookie(t *testing.T, rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	t.Helper()
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
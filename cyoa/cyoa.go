@@ -3,50 +3,86 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
 )
 
 // ServeCmdLnStory gets the story data and then
-// serves the story through the command line.
-func ServeCmdLnStory() error {
+// serves the story through the command line. When
+// attached to a terminal the story runs full screen,
+// otherwise it's printed as plain text.
+func ServeCmdLnStory(seed int64) error {
 	s, err := buildStoryMap()
 	if err != nil {
 		return err
 	}
+	if term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd())) {
+		return runTUI(s, newRoller(seed), os.Stdin, os.Stdout)
+	}
+	return playStory(s, newRoller(seed), os.Stdin, os.Stdout)
+}
+
+// playStory plays the story from the intro arc, reading
+// choices from in and writing the story to out as plain text.
+func playStory(s map[string]arc, r *roller, in io.Reader, out io.Writer) error {
+	sc := bufio.NewScanner(in)
 	arc := "intro"
+	vars := map[string]int{}
 	for {
-		fmt.Printf("\n--------------------------\n%s\n--------------------------\n", s[arc].Title)
+		fmt.Fprintf(out, "\n--------------------------\n%s\n--------------------------\n", s[arc].Title)
 		for _, p := range s[arc].Story {
-			fmt.Printf("\n%s\n\n", p)
+			fmt.Fprintf(out, "\n%s\n\n", p)
 		}
 		numOptions := len(s[arc].Options)
 		var choice int
 		if numOptions < 1 {
 			break
 		}
-		fmt.Println("Here are your options...")
+		fmt.Fprintln(out, "Here are your options...")
 		for i, o := range s[arc].Options {
-			fmt.Println(o.TextOption)
-			fmt.Printf("Press %v to venture.\n\n", i)
+			fmt.Fprintln(out, o.TextOption)
+			fmt.Fprintf(out, "Press %v to venture.\n\n", i+1)
 		}
-		fmt.Scanln(&choice)
-		for choice < 0 || choice > (numOptions-1) { // if alpha chars are entered, defaults to 0
-			fmt.Printf("Must choose a number between 0 and %v.", numOptions-1)
-			fmt.Scanln(&choice)
+		for {
+			if !sc.Scan() {
+				return sc.Err() // out of input, so the reader walked away
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(sc.Text()))
+			if err == nil && n >= 1 && n <= numOptions {
+				choice = n - 1
+				break
+			}
+			fmt.Fprintf(out, "Must choose a number between 1 and %v.\n", numOptions)
 		}
-		arc = s[arc].Options[choice].ArcOption
+		next, note, err := r.choose(s[arc].Options[choice], vars)
+		if err != nil {
+			return err
+		}
+		if note != "" {
+			fmt.Fprintf(out, "\n%s\n", note)
+		}
+		arc = next
 	}
 	return nil
 }
 
 // ServeHTMLStory gets the story data, creats the template,
 // creates the pages, and then serves the story on localhost.
-func ServeHTMLStory() error {
+func ServeHTMLStory(seed int64) error {
 	s, err := buildStoryMap()
 	if err != nil {
 		return err
@@ -57,36 +93,165 @@ func ServeHTMLStory() error {
 		return err
 	}
 
-	handler := NewStoryHandler(s, tmpl)
+	handler := newStoryMux(NewStoryHandler(s, tmpl, newRoller(seed)))
 
 	fmt.Println("Story is running at http://localhost:1313 ...")
-	http.ListenAndServe(":1313", handler)
+	return http.ListenAndServe(":1313", handler)
+}
 
-	return nil
+// newStoryMux routes the health check and the story
+// arcs, logging every request that comes through.
+func newStoryMux(sh StoryHandler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthz)
+	mux.Handle("/", sh)
+	return logRequests(mux)
+}
+
+// healthz reports that the server is up.
+func healthz(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
 }
 
 // StoryHandler is type for handling story requests
 type StoryHandler struct {
 	s map[string]arc
 	t *template.Template
+	r *roller
 }
 
 // NewStoryHandler creates a story handler
-func NewStoryHandler(story map[string]arc, tmpl *template.Template) StoryHandler {
-	return StoryHandler{story, tmpl}
+func NewStoryHandler(story map[string]arc, tmpl *template.Template, r *roller) StoryHandler {
+	return StoryHandler{story, tmpl, r}
 }
 
 // implements Handler interface through adding
 // ServeHTTP method to StoryHandler
 func (s StoryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	path := req.URL.Path[1:]
+	path := strings.Trim(req.URL.Path, "/")
 	if path == "" {
 		path = "intro"
 	}
-	err := s.t.Execute(w, s.s[path])
+	a, ok := s.s[path]
+	if !ok {
+		renderError(w, http.StatusNotFound, "There's no arc called \""+path+"\" in this story.")
+		return
+	}
+	if req.Method == http.MethodPost {
+		s.choose(w, req, path, a)
+		return
+	}
+
+	// render into a buffer first so a failed template
+	// doesn't leave a half written page behind
+	var buf bytes.Buffer
+	if err := s.t.Execute(&buf, a); err != nil {
+		log.Printf("executing template for arc %q: %s", path, err)
+		renderError(w, http.StatusInternalServerError, "Something went wrong telling this part of the story.")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: arcCookie, Value: path, Path: "/"})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	buf.WriteTo(w)
+}
+
+// choose resolves the option of arc a posted as the choice
+// and redirects to wherever it leads. It has to be the arc
+// the reader is on, so a choice can't be made again by going
+// back or reloading. Story variables are kept in a cookie.
+func (s StoryHandler) choose(w http.ResponseWriter, req *http.Request, path string, a arc) {
+	c := req.PostFormValue("choice")
+	i, err := strconv.Atoi(c)
+	if err != nil || i < 0 || i >= len(a.Options) {
+		renderError(w, http.StatusNotFound, "There's no choice "+c+" in \""+path+"\".")
+		return
+	}
+	if on, err := req.Cookie(arcCookie); err != nil || on.Value != path {
+		renderError(w, http.StatusConflict, "You've already chosen what to do in \""+path+"\".")
+		return
+	}
+	vars := readVars(req)
+	next, _, err := s.r.choose(a.Options[i], vars)
+	if err != nil {
+		log.Printf("choosing option %d of arc %q: %s", i, path, err)
+		renderError(w, http.StatusInternalServerError, "Something went wrong deciding your fate.")
+		return
+	}
+	writeVars(w, vars)
+	http.Redirect(w, req, "/"+next, http.StatusSeeOther)
+}
+
+// varsCookie is the name of the cookie holding story variables,
+// and arcCookie the one holding the arc the reader is on
+const (
+	varsCookie = "cyoa-vars"
+	arcCookie  = "cyoa-arc"
+)
+
+// readVars reads story variables from the request's cookie
+func readVars(req *http.Request) map[string]int {
+	vars := map[string]int{}
+	c, err := req.Cookie(varsCookie)
+	if err != nil {
+		return vars
+	}
+	vals, err := url.ParseQuery(c.Value)
 	if err != nil {
-		log.Fatal(err)
+		return vars
+	}
+	for k := range vals {
+		if n, err := strconv.Atoi(vals.Get(k)); err == nil {
+			vars[k] = n
+		}
 	}
+	return vars
+}
+
+// writeVars stores story variables in a cookie
+func writeVars(w http.ResponseWriter, vars map[string]int) {
+	vals := url.Values{}
+	for k, v := range vars {
+		vals.Set(k, strconv.Itoa(v))
+	}
+	http.SetCookie(w, &http.Cookie{Name: varsCookie, Value: vals.Encode(), Path: "/"})
+}
+
+// renderError writes an error page with the given status code
+func renderError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	err := errorTmpl.Execute(w, struct {
+		Code   int
+		Status string
+		Msg    string
+	}{code, http.StatusText(code), msg})
+	if err != nil {
+		log.Printf("executing error template: %s", err)
+	}
+}
+
+// logRequests logs the method, path, status code
+// and duration of every request
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := statusWriter{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(&sw, req)
+		log.Printf("%s %s %d %s", req.Method, req.URL.Path, sw.code, time.Since(start))
+	})
+}
+
+// statusWriter records the status code written
+// through it so it can be logged
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.code = code
+	sw.ResponseWriter.WriteHeader(code)
 }
 
 // buildStoryMap reads from the json file and creats a map
@@ -103,17 +268,17 @@ func buildStoryMap() (map[string]arc, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := validateStory(s); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
 // arc is the type of object unmarshalled from json data
 type arc struct {
-	Title   string     `json:"title"`
-	Story   []string   `json:"story"`
-	Options []struct { // may be more readable to create Option type instead of leaving it as an undefined struct
-		TextOption string `json:"text"`
-		ArcOption  string `json:"arc"`
-	} `json:"options"`
+	Title   string   `json:"title"`
+	Story   []string `json:"story"`
+	Options []option `json:"options"`
 }
 
 // storyTemplate is the template used for HTML story arc files
@@ -128,10 +293,30 @@ const storyTemplate = `
 			<p>{{.}}</p>
 		{{end}}
 	</div>
-	{{range .Options}}
+	{{range $i, $o := .Options}}
 		<div style="padding: 20px 0px">
-			<a href="/{{.ArcOption}}">{{.TextOption}}</a>
+			{{if $o.Plain}}
+				<a href="/{{$o.ArcOption}}">{{$o.TextOption}}</a>
+			{{else}}
+				<form method="post" style="margin: 0">
+					<button name="choice" value="{{$i}}">{{$o.TextOption}}{{if $o.Chance}} 🎲{{end}}</button>
+				</form>
+			{{end}}
 		</div>
 	{{end}}
 </div>
 `
+
+// errorTmpl is the template used for 404 and 500 pages
+var errorTmpl = template.Must(template.New("error-template").Parse(`
+<div style="max-width: 800px; margin:auto; padding: 45px 3%; font-family: Courier New">
+	<a href="/" style="font-size: 40px; text-decoration: none">
+		🕳
+	</a>
+	<h1>{{.Code}} {{.Status}}</h1>
+	<p>{{.Msg}}</p>
+	<div style="padding: 20px 0px">
+		<a href="/">Back to the beginning</a>
+	</div>
+</div>
+`))
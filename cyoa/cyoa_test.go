@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testStoryJSON = `{
+	"intro": {
+		"title": "The Start",
+		"story": ["Once upon a time."],
+		"options": [{"text": "Go to Denver", "arc": "denver"}]
+	},
+	"denver": {
+		"title": "Visiting Denver",
+		"story": ["It snowed."]
+	}
+}`
+
+func testStory(t *testing.T) map[string]arc {
+	t.Helper()
+	var s map[string]arc
+	if err := json.Unmarshal([]byte(testStoryJSON), &s); err != nil {
+		t.Fatalf("failed to unmarshal test story, err: %s", err)
+	}
+	return s
+}
+
+func TestStoryHandler(t *testing.T) {
+	tmpl := template.Must(template.New("test").Parse(storyTemplate))
+	handler := newStoryMux(NewStoryHandler(testStory(t), tmpl, newRoller(1)))
+
+	testCases := []struct {
+		name     string
+		path     string
+		wantCode int
+		wantBody string
+	}{
+		{"root is intro", "/", http.StatusOK, "The Start"},
+		{"named arc", "/intro", http.StatusOK, `href="/denver"`},
+		{"other arc", "/denver", http.StatusOK, "Visiting Denver"},
+		{"trailing slash", "/denver/", http.StatusOK, "Visiting Denver"},
+		{"unknown arc", "/favicon.ico", http.StatusNotFound, "404 Not Found"},
+		{"nested path", "/denver/extra", http.StatusNotFound, "denver/extra"},
+		{"health check", "/healthz", http.StatusOK, "ok"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantCode {
+				t.Errorf("got status %d want %d for path %s", rec.Code, tc.wantCode, tc.path)
+			}
+			if !strings.Contains(rec.Body.String(), tc.wantBody) {
+				t.Errorf("body for path %s should contain %q, got:\n%s", tc.path, tc.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestStoryHandlerTemplateError(t *testing.T) {
+	tmpl := template.Must(template.New("broken").Parse("<h1>{{.Title}}</h1>{{.NoSuchField}}"))
+	handler := NewStoryHandler(testStory(t), tmpl, newRoller(1))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/intro", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "500 Internal Server Error") {
+		t.Errorf("body should contain the 500 page, got:\n%s", body)
+	}
+	if strings.Contains(body, "<h1>The Start</h1>") {
+		t.Errorf("body should not contain the partially rendered arc, got:\n%s", body)
+	}
+}
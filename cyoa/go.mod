@@ -1,3 +1,5 @@
 module github.com/kristakoch/gophercises/cyoa
 
 go 1.13
+
+require golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
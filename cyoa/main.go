@@ -7,14 +7,15 @@ import (
 
 func main() {
 	vPtr := flag.String("v", "html", "either html or cmd")
+	seedPtr := flag.Int64("seed", 0, "seed for chance choices, 0 picks one from the clock")
 	flag.Parse()
 
 	var err error
 	switch *vPtr {
 	case "cmd":
-		err = ServeCmdLnStory()
+		err = ServeCmdLnStory(*seedPtr)
 	default:
-		err = ServeHTMLStory()
+		err = ServeHTMLStory(*seedPtr)
 	}
 	if err != nil {
 		log.Fatal(err)
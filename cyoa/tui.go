@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// keyKind is the kind of keypress read from the terminal
+type keyKind int
+
+const (
+	keyOther keyKind = iota
+	keyUp
+	keyDown
+	keyPgUp
+	keyPgDn
+	keyHome
+	keyEnd
+	keyEnter
+	keyQuit
+	keyDigit
+)
+
+// key is a single keypress. r holds the digit for keyDigit.
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// readKey reads one keypress from a terminal in raw mode,
+// decoding the escape sequences sent for arrow and paging keys
+func readKey(br *bufio.Reader) (key, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return key{}, err
+	}
+	switch {
+	case b == '\r' || b == '\n' || b == ' ':
+		return key{kind: keyEnter}, nil
+	case b == 3 || b == 4 || b == 'q': // ctrl-c, ctrl-d
+		return key{kind: keyQuit}, nil
+	case b == 'k':
+		return key{kind: keyUp}, nil
+	case b == 'j':
+		return key{kind: keyDown}, nil
+	case b >= '1' && b <= '9':
+		return key{kind: keyDigit, r: rune(b)}, nil
+	case b != 27:
+		return key{kind: keyOther, r: rune(b)}, nil
+	}
+
+	// a lone escape quits, anything else is a sequence like ESC [ A
+	if br.Buffered() == 0 {
+		return key{kind: keyQuit}, nil
+	}
+	if b, err = br.ReadByte(); err != nil || (b != '[' && b != 'O') {
+		return key{}, err
+	}
+	if b, err = br.ReadByte(); err != nil {
+		return key{}, err
+	}
+	switch b {
+	case 'A':
+		return key{kind: keyUp}, nil
+	case 'B':
+		return key{kind: keyDown}, nil
+	case 'H':
+		return key{kind: keyHome}, nil
+	case 'F':
+		return key{kind: keyEnd}, nil
+	}
+	if b < '0' || b > '9' {
+		return key{}, nil
+	}
+	// sequences like ESC [ 5 ~ end with a tilde
+	if t, err := br.ReadByte(); err != nil || t != '~' {
+		return key{}, err
+	}
+	switch b {
+	case '5':
+		return key{kind: keyPgUp}, nil
+	case '6':
+		return key{kind: keyPgDn}, nil
+	case '1', '7':
+		return key{kind: keyHome}, nil
+	case '4', '8':
+		return key{kind: keyEnd}, nil
+	}
+	return key{}, nil
+}
+
+// tui is the state of a full screen story: where the reader
+// is, what they've read so far and which option is selected
+type tui struct {
+	s       map[string]arc
+	r       *roller
+	vars    map[string]int
+	arc     string
+	history []string // paragraphs of earlier arcs and the choices made
+	sel     int
+	scroll  int // lines scrolled back from the bottom
+	height  int // body height at the last render, used for paging
+	msg     string
+}
+
+func newTUI(s map[string]arc, r *roller) *tui {
+	return &tui{s: s, r: r, vars: map[string]int{}, arc: "intro"}
+}
+
+// runTUI plays the story full screen until the reader
+// quits or the story ends
+func runTUI(s map[string]arc, r *roller, in, out *os.File) error {
+	fd := int(in.Fd())
+	old, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, old)
+
+	// switch to the alternate screen and hide the cursor
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	t := newTUI(s, r)
+	br := bufio.NewReader(in)
+	for {
+		w, h, err := term.GetSize(int(out.Fd()))
+		if err != nil {
+			w, h = 80, 24
+		}
+		fmt.Fprint(out, t.view(w, h))
+
+		k, err := readKey(br)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		quit, err := t.update(k)
+		if err != nil || quit {
+			return err
+		}
+	}
+}
+
+// update applies a keypress, reporting whether the reader is done
+func (t *tui) update(k key) (bool, error) {
+	opts := t.s[t.arc].Options
+	t.msg = ""
+	switch k.kind {
+	case keyQuit:
+		return true, nil
+	case keyUp:
+		if t.sel > 0 {
+			t.sel--
+		}
+	case keyDown:
+		if t.sel < len(opts)-1 {
+			t.sel++
+		}
+	case keyPgUp:
+		t.scroll += t.page()
+	case keyPgDn:
+		t.scroll -= t.page()
+		if t.scroll < 0 {
+			t.scroll = 0
+		}
+	case keyHome:
+		t.scroll = int(^uint(0) >> 1) // clamped when rendered
+	case keyEnd:
+		t.scroll = 0
+	case keyEnter:
+		if len(opts) == 0 {
+			return true, nil
+		}
+		return false, t.pick(t.sel)
+	case keyDigit:
+		n := int(k.r - '1')
+		if n < len(opts) {
+			return false, t.pick(n)
+		}
+		if len(opts) > 0 {
+			t.msg = fmt.Sprintf("Choose a number from 1 to %d.", len(opts))
+		}
+	default:
+		if len(opts) > 0 {
+			t.msg = "Use the arrow keys or a number to choose, then Enter to venture."
+		}
+	}
+	return false, nil
+}
+
+// page is how far PgUp and PgDn scroll
+func (t *tui) page() int {
+	if t.height > 2 {
+		return t.height - 2
+	}
+	return 1
+}
+
+// pick follows option i of the current arc, moving
+// the arc into the scrollback
+func (t *tui) pick(i int) error {
+	a := t.s[t.arc]
+	next, note, err := t.r.choose(a.Options[i], t.vars)
+	if err != nil {
+		return err
+	}
+	t.history = append(t.history, arcParagraphs(a)...)
+	t.history = append(t.history, "> "+a.Options[i].TextOption)
+	if note != "" {
+		t.history = append(t.history, note)
+	}
+	t.arc, t.sel, t.scroll = next, 0, 0
+	return nil
+}
+
+// arcParagraphs is the title and story of an arc
+func arcParagraphs(a arc) []string {
+	return append([]string{"== " + a.Title + " =="}, a.Story...)
+}
+
+// line is a line of the rendered body
+type line struct {
+	text        string
+	highlighted bool
+}
+
+// view renders the whole screen for a terminal of the given size
+func (t *tui) view(width, height int) string {
+	a := t.s[t.arc]
+
+	var body []line
+	add := func(p, prefix string, hl bool) {
+		for _, l := range wrap(p, width, prefix) {
+			body = append(body, line{l, hl})
+		}
+		body = append(body, line{})
+	}
+	for _, p := range t.history {
+		add(p, "", false)
+	}
+	for _, p := range arcParagraphs(a) {
+		add(p, "", false)
+	}
+	for i, o := range a.Options {
+		text := o.TextOption
+		if o.Chance() {
+			text += " (chance)"
+		}
+		marker := "  "
+		if i == t.sel {
+			marker = "> "
+		}
+		add(text, fmt.Sprintf("%s%d. ", marker, i+1), i == t.sel)
+	}
+	if len(a.Options) == 0 {
+		add("The End. Press Enter to leave.", "", false)
+	}
+
+	// one line each for the status and help lines
+	t.height = height - 2
+	if t.height < 1 {
+		t.height = 1
+	}
+	maxScroll := len(body) - t.height
+	if maxScroll < 0 {
+		maxScroll = 0
+	}
+	if t.scroll > maxScroll {
+		t.scroll = maxScroll
+	}
+	start := maxScroll - t.scroll
+	end := start + t.height
+	if end > len(body) {
+		end = len(body)
+	}
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[2J")
+	sb.WriteString("\x1b[7m" + fit(" "+a.Title+t.status(), width) + "\x1b[0m\r\n")
+	for _, l := range body[start:end] {
+		if l.highlighted {
+			sb.WriteString("\x1b[1;7m" + fit(l.text, width) + "\x1b[0m\r\n")
+			continue
+		}
+		sb.WriteString(l.text + "\r\n")
+	}
+	for i := end - start; i < t.height; i++ {
+		sb.WriteString("\r\n")
+	}
+
+	help := t.msg
+	if help == "" {
+		help = "↑/↓ or 1-9 choose · Enter venture · PgUp/PgDn scroll · q quit"
+		if t.scroll > 0 {
+			help = fmt.Sprintf("[scrolled back %d] ", t.scroll) + help
+		}
+	}
+	sb.WriteString(fit(help, width))
+	return sb.String()
+}
+
+// status lists the story variables for the status line
+func (t *tui) status() string {
+	if len(t.vars) == 0 {
+		return ""
+	}
+	var names []string
+	for k := range t.vars {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, k := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, t.vars[k]))
+	}
+	return "  |  " + strings.Join(parts, "  ")
+}
+
+// wrap breaks s into lines no wider than width. The first
+// line starts with prefix and the rest are indented to match.
+func wrap(s string, width int, prefix string) []string {
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix))
+	if width <= len(indent) {
+		width = len(indent) + 1
+	}
+
+	var lines []string
+	cur, curLen := prefix, utf8.RuneCountInString(prefix)
+	empty := true
+	for _, w := range strings.Fields(s) {
+		wl := utf8.RuneCountInString(w)
+		if !empty && curLen+1+wl > width {
+			lines = append(lines, cur)
+			cur, curLen, empty = indent, len(indent), true
+		}
+		// words too long for a line are split across lines
+		for empty && curLen+wl > width {
+			n := width - curLen
+			r := []rune(w)
+			lines = append(lines, cur+string(r[:n]))
+			w, wl = string(r[n:]), wl-n
+			cur, curLen = indent, len(indent)
+		}
+		if !empty {
+			cur += " "
+			curLen++
+		}
+		cur += w
+		curLen += wl
+		empty = false
+	}
+	return append(lines, cur)
+}
+
+// fit pads or truncates s to exactly width runes
+func fit(s string, width int) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		return string([]rune(s)[:width])
+	}
+	return s + strings.Repeat(" ", width-n)
+}
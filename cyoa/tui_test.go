@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	testCases := []struct {
+		s      string
+		width  int
+		prefix string
+		want   []string
+	}{
+		{"the little blue gopher", 10, "", []string{"the little", "blue", "gopher"}},
+		{"go to denver", 12, "> 1. ", []string{"> 1. go to", "     denver"}},
+		{"abcdefghij", 4, "", []string{"abcd", "efgh", "ij"}},
+		{"", 10, "", []string{""}},
+	}
+
+	for _, tc := range testCases {
+		got := wrap(tc.s, tc.width, tc.prefix)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("wrap(%q, %d, %q) = %q want %q", tc.s, tc.width, tc.prefix, got, tc.want)
+		}
+	}
+}
+
+func TestReadKey(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want key
+	}{
+		{"\x1b[A", key{kind: keyUp}},
+		{"\x1b[B", key{kind: keyDown}},
+		{"\x1bOA", key{kind: keyUp}},
+		{"\x1b[5~", key{kind: keyPgUp}},
+		{"\x1b[6~", key{kind: keyPgDn}},
+		{"\r", key{kind: keyEnter}},
+		{"3", key{kind: keyDigit, r: '3'}},
+		{"q", key{kind: keyQuit}},
+		{"\x1b", key{kind: keyQuit}},
+		{"x", key{kind: keyOther, r: 'x'}},
+	}
+
+	for _, tc := range testCases {
+		got, err := readKey(bufio.NewReader(strings.NewReader(tc.in)))
+		if err != nil {
+			t.Errorf("readKey(%q) failed, err: %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("readKey(%q) = %+v want %+v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestTUI(t *testing.T) {
+	ui := newTUI(chanceStory(t), newRoller(1))
+
+	screen := ui.view(40, 20)
+	if !strings.Contains(screen, "> 1. Trust fate (chance)") {
+		t.Errorf("first option should be selected, got:\n%s", screen)
+	}
+
+	// Letters don't pick an option.
+	if _, err := ui.update(key{kind: keyOther, r: 'x'}); err != nil || ui.arc != "intro" {
+		t.Fatalf("letter should not move the story, arc %s err %v", ui.arc, err)
+	}
+	if !strings.Contains(ui.view(80, 20), "Use the arrow keys") {
+		t.Error("letter should show a hint")
+	}
+	ui.update(key{kind: keyDigit, r: '9'})
+	if !strings.Contains(ui.view(80, 20), "Choose a number from 1 to 2.") {
+		t.Error("out of range number should show the valid range")
+	}
+
+	// Arrow down and Enter follow the second option.
+	ui.update(key{kind: keyDown})
+	if _, err := ui.update(key{kind: keyEnter}); err != nil {
+		t.Fatalf("failed to pick option, err: %s", err)
+	}
+	if ui.arc != "gym" {
+		t.Fatalf("got arc %s want gym", ui.arc)
+	}
+
+	screen = ui.view(60, 40)
+	if !strings.Contains(screen, "The Gym  |  strength: 3") {
+		t.Errorf("status line should show the title and variables, got:\n%s", screen)
+	}
+	if !strings.Contains(screen, "== The Fork ==") || !strings.Contains(screen, "> Train first") {
+		t.Errorf("scrollback should keep the earlier arc and choice, got:\n%s", screen)
+	}
+
+	// On a short screen the earlier arc is only visible after scrolling back.
+	if screen = ui.view(60, 8); strings.Contains(screen, "The Fork ==") {
+		t.Errorf("earlier arc should be scrolled off a short screen, got:\n%s", screen)
+	}
+	ui.update(key{kind: keyHome})
+	if screen = ui.view(60, 8); !strings.Contains(screen, "== The Fork ==") {
+		t.Errorf("scrolling home should show the earlier arc, got:\n%s", screen)
+	}
+
+	// Number keys pick directly, and Enter leaves at the end.
+	ui.update(key{kind: keyDigit, r: '1'})
+	if ui.arc != "arc_a" && ui.arc != "arc_b" {
+		t.Fatalf("got arc %s want arc_a or arc_b", ui.arc)
+	}
+	if !strings.Contains(ui.view(60, 40), "Rolled 1d6") {
+		t.Error("scrollback should show the roll")
+	}
+	if done, _ := ui.update(key{kind: keyEnter}); !done {
+		t.Error("Enter at the end of the story should quit")
+	}
+}
@@ -1,41 +1,330 @@
 // Package linkparser contains functions to parse links from HTML files.
 package main
 
-// todo:
-// refactor to pass in reader
-//  instead of file name
-
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-// ParseLinks reads in a file, parses it into a node tree,
-// and returns an array of Links from the HTML document.
-func ParseLinks(r *strings.Reader) ([]Link, error) {
-	doc, err := html.Parse(r)
+// ParseLinks reads an HTML document from r and
+// returns the Links in it.
+func ParseLinks(r io.Reader) ([]Link, error) {
+	var Links []Link
+	err := ParseLinksFunc(r, func(l Link) error {
+		Links = append(Links, l)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return Links, nil
+}
 
-	Links := getLinks(doc)
+// ParseLinksFunc streams an HTML document from r, calling fn
+// with each Link as soon as it's complete. Anchors are complete
+// at their closing tag, so links inside an anchor, like its
+// images, come before the anchor itself. Only the current
+// token and anchor are held in memory, so documents of any
+// size can be parsed. Parsing stops at the first error
+// returned by fn.
+func ParseLinksFunc(r io.Reader, fn func(Link) error) error {
+	z := html.NewTokenizer(r)
+	pos := position{line: 1, col: 1}
 
-	return Links, nil
+	var cur *Link
+	var txt []string
+	emit := func() error {
+		if cur == nil {
+			return nil
+		}
+		cur.Text = strings.Join(txt, " ")
+		l := *cur
+		cur, txt = nil, nil
+		return fn(l)
+	}
+
+	// a robots meta tag can mark every link on the page nofollow
+	pageNoFollow := false
+
+	for {
+		tt := z.Next()
+		at := pos
+		pos.advance(z.Raw())
+
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			return emit()
+
+		case html.TextToken:
+			if cur != nil {
+				txt = append(txt, strings.Fields(string(z.Text()))...)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			if _, ok := linkAttrs[a]; !ok {
+				continue
+			}
+			attrs := tagAttrs(z, hasAttr)
+			base := Link{
+				Rel:      attrs["rel"],
+				Title:    attrs["title"],
+				Target:   attrs["target"],
+				Hreflang: attrs["hreflang"],
+				Line:     at.line,
+				Col:      at.col,
+			}
+			base.NoFollow = pageNoFollow || hasToken(base.Rel, "nofollow")
+
+			var found []Link
+			switch a {
+			case atom.A:
+				// links can't nest, so a new one closes the last
+				if err := emit(); err != nil {
+					return err
+				}
+				if href, ok := attrs["href"]; ok {
+					l := base
+					l.Kind, l.Href = KindAnchor, href
+					cur = &l
+				}
+				if tt == html.SelfClosingTagToken {
+					if err := emit(); err != nil {
+						return err
+					}
+				}
+			case atom.Img:
+				alt := attrs["alt"]
+				if cur != nil {
+					txt = append(txt, strings.Fields(alt)...)
+				}
+				if src, ok := attrs["src"]; ok {
+					found = append(found, base.with(KindImage, src, alt))
+				}
+				for _, src := range srcsetURLs(attrs["srcset"]) {
+					found = append(found, base.with(KindImage, src, alt))
+				}
+			case atom.Meta:
+				content := attrs["content"]
+				if strings.EqualFold(attrs["name"], "robots") && hasToken(content, "nofollow") {
+					pageNoFollow = true
+				}
+				if strings.EqualFold(attrs["http-equiv"], "refresh") {
+					if u := refreshURL(content); u != "" {
+						found = append(found, base.with(KindRefresh, u, ""))
+					}
+				}
+			default:
+				k := linkAttrs[a]
+				if href, ok := attrs[k.attr]; ok {
+					found = append(found, base.with(k.kind, href, attrs["alt"]))
+				}
+			}
+			for _, l := range found {
+				if err := fn(l); err != nil {
+					return err
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.A {
+				if err := emit(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// ParseLinksChan streams an HTML document from r in a new
+// goroutine, sending each Link on the returned channel. The
+// channel is closed when parsing ends, after which the error
+// channel receives the parse error, if any. Cancelling ctx
+// stops the parse early.
+func ParseLinksChan(ctx context.Context, r io.Reader) (<-chan Link, <-chan error) {
+	links := make(chan Link)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := ParseLinksFunc(r, func(l Link) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			select {
+			case links <- l:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(links)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return links, errc
 }
 
+// Kind is the kind of element a Link was found in.
+type Kind string
+
+// The kinds of Link ParseLinks finds.
+const (
+	KindAnchor  Kind = "a"
+	KindArea    Kind = "area"
+	KindLink    Kind = "link"
+	KindImage   Kind = "img"
+	KindScript  Kind = "script"
+	KindIframe  Kind = "iframe"
+	KindForm    Kind = "form"
+	KindRefresh Kind = "refresh"
+	KindBase    Kind = "base"
+)
+
 // Link is a type that holds parsed link information.
 type Link struct {
-	Href string
-	Text string
+	Href     string `json:"href"`
+	Text     string `json:"text"`
+	Kind     Kind   `json:"kind"`
+	Rel      string `json:"rel,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Target   string `json:"target,omitempty"`
+	NoFollow bool   `json:"nofollow,omitempty"`
+	Hreflang string `json:"hreflang,omitempty"`
+	Line     int    `json:"line"` // line of the tag in the source, from 1
+	Col      int    `json:"col"`  // column of the tag in the source, from 1
+
+	// URL and Scope are set by ResolveLinks.
+	URL   string `json:"url,omitempty"`
+	Scope Scope  `json:"scope,omitempty"`
+}
+
+// with copies a Link's attributes into a new Link
+// of kind k pointing at href.
+func (l Link) with(k Kind, href, text string) Link {
+	l.Kind, l.Href, l.Text = k, href, text
+	return l
+}
+
+// OfKind returns only the Links of the given kinds.
+func OfKind(ls []Link, kinds ...Kind) []Link {
+	var ret []Link
+	for _, l := range ls {
+		for _, k := range kinds {
+			if l.Kind == k {
+				ret = append(ret, l)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// linkAttrs maps each element that can hold a link
+// to the attribute the link is in.
+var linkAttrs = map[atom.Atom]struct {
+	kind Kind
+	attr string
+}{
+	atom.A:      {KindAnchor, "href"},
+	atom.Area:   {KindArea, "href"},
+	atom.Link:   {KindLink, "href"},
+	atom.Img:    {KindImage, "src"},
+	atom.Script: {KindScript, "src"},
+	atom.Iframe: {KindIframe, "src"},
+	atom.Form:   {KindForm, "action"},
+	atom.Meta:   {KindRefresh, "content"},
+	atom.Base:   {KindBase, "href"},
+}
+
+// tagAttrs reads the current tag's attributes into a map.
+func tagAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(val)
+	}
+	return attrs
+}
+
+// hasToken reports whether the space separated list
+// s contains tok, ignoring case.
+func hasToken(s, tok string) bool {
+	for _, f := range strings.Fields(s) {
+		if strings.EqualFold(f, tok) {
+			return true
+		}
+	}
+	return false
+}
+
+// srcsetURLs returns the URLs in a srcset attribute
+// like "small.png 1x, large.png 2x".
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, c := range strings.Split(srcset, ",") {
+		if f := strings.Fields(c); len(f) > 0 {
+			urls = append(urls, f[0])
+		}
+	}
+	return urls
+}
+
+// refreshURL returns the URL in a meta refresh
+// content attribute like "5; url=/next".
+func refreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return ""
+	}
+	u := strings.TrimSpace(content[i+1:])
+	if len(u) > 4 && strings.EqualFold(u[:4], "url=") {
+		u = strings.TrimSpace(u[4:])
+	}
+	return strings.Trim(u, `'"`)
+}
+
+// position is a line and column in the source document.
+type position struct {
+	line, col int
+}
+
+// advance moves the position past raw.
+func (p *position) advance(raw []byte) {
+	if n := bytes.Count(raw, []byte("\n")); n > 0 {
+		p.line += n
+		p.col = 1
+		raw = raw[bytes.LastIndexByte(raw, '\n')+1:]
+	}
+	p.col += utf8.RuneCount(raw)
 }
 
 // PrintLinks prints a formatted list of Links.
 func PrintLinks(ls []Link) {
+	FprintLinks(os.Stdout, ls)
+}
+
+// FprintLinks writes a formatted list of Links to w.
+func FprintLinks(w io.Writer, ls []Link) error {
 	for i, l := range ls {
-		fmt.Printf("%d. Link text: %s, URL: %s\n", i+1, l.Href, l.Text)
+		if _, err := fmt.Fprintf(w, "%d. Link text: %s, URL: %s\n", i+1, l.Text, l.Href); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // GetURLs returns a slice of only the urls
@@ -59,7 +348,9 @@ func GetLinkText(ls []Link) []string {
 }
 
 // getLinks is a helper to get the href attribute
-// values of link tags in a given node tree.
+// values of link tags in a given node tree. It's the
+// tree-walking parser ParseLinks used to be built on,
+// kept to benchmark the streaming parser against.
 func getLinks(n *html.Node) []Link {
 	var Links []Link
 	isLink := false
@@ -69,7 +360,7 @@ func getLinks(n *html.Node) []Link {
 			if a.Key == "href" {
 				s := txtNodes(n)
 				s = strings.Trim(s, " ")
-				Links = append(Links, Link{Href: a.Val, Text: s})
+				Links = append(Links, Link{Href: a.Val, Text: s, Kind: KindAnchor})
 				break
 			}
 		}
@@ -87,12 +378,20 @@ func getLinks(n *html.Node) []Link {
 }
 
 // txtNodes is a helper to get the text node
-// values in a given node tree.
+// values in a given node tree, along with the
+// alt text of any images.
 func txtNodes(n *html.Node) string {
 	s := ""
 	if n.Type == html.TextNode {
 		s = fmt.Sprintf("%v ", strings.Trim(n.Data, " \n\t"))
 	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+		for _, a := range n.Attr {
+			if a.Key == "alt" {
+				s = fmt.Sprintf("%v ", strings.TrimSpace(a.Val))
+			}
+		}
+	}
 
 	// Range over the node's children and recursively collect
 	// text node values.
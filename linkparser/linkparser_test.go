@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+// treeLinks parses links the old way, by walking the node
+// tree, with the text normalized to single spaces.
+func treeLinks(t testing.TB, doc string) []Link {
+	n, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse document, err: %s", err)
+	}
+	ls := getLinks(n)
+	for i := range ls {
+		ls[i].Text = strings.Join(strings.Fields(ls[i].Text), " ")
+	}
+	return ls
+}
+
+func readExample(t testing.TB, name string) string {
+	b, err := ioutil.ReadFile("ex/" + name)
+	if err != nil {
+		t.Fatalf("failed to read example %s, err: %s", name, err)
+	}
+	return string(b)
+}
+
+func TestParseLinks(t *testing.T) {
+	testCases := []struct {
+		ex   string
+		want []Link
+	}{
+		{"ex1.html", []Link{
+			{Href: "/other-page", Text: "A link to another page", Kind: KindAnchor, Line: 4, Col: 3},
+		}},
+		{"ex2.html", []Link{
+			{Href: "https://maxcdn.bootstrapcdn.com/font-awesome/4.7.0/css/font-awesome.min.css", Kind: KindLink, Rel: "stylesheet", Line: 3, Col: 3},
+			{Href: "https://www.twitter.com/joncalhoun", Text: "Check me out on twitter", Kind: KindAnchor, Line: 8, Col: 5},
+			{Href: "https://github.com/gophercises", Text: "Gophercises is on Github !", Kind: KindAnchor, Line: 12, Col: 5},
+		}},
+		{"ex4.html", []Link{
+			{Href: "/dog-cat", Text: "dog cat", Kind: KindAnchor, Line: 3, Col: 3},
+		}},
+		{"ex6.html", []Link{
+			{Href: "#", Text: "Something here", Kind: KindAnchor, Line: 1, Col: 1},
+			{Href: "/dog", Text: "nested dog link", Kind: KindAnchor, Line: 2, Col: 18},
+		}},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseLinks(strings.NewReader(readExample(t, tc.ex)))
+		if err != nil {
+			t.Errorf("failed to parse links in %s, err: %s", tc.ex, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("got %v want %v for %s", got, tc.want, tc.ex)
+		}
+	}
+}
+
+func TestParseLinksMatchesTree(t *testing.T) {
+	// ex5 nests links, which the tree parser rearranges
+	// and the streaming parser closes, so it's left out.
+	for _, ex := range []string{"ex1.html", "ex2.html", "ex3.html", "ex4.html", "ex6.html"} {
+		doc := readExample(t, ex)
+		ls, err := ParseLinks(strings.NewReader(doc))
+		if err != nil {
+			t.Errorf("failed to parse links in %s, err: %s", ex, err)
+			continue
+		}
+		var got []Link
+		for _, l := range OfKind(ls, KindAnchor) {
+			got = append(got, Link{Href: l.Href, Text: l.Text, Kind: l.Kind})
+		}
+		if want := treeLinks(t, doc); !reflect.DeepEqual(got, want) {
+			t.Errorf("streaming parser got %v, tree parser got %v for %s", got, want, ex)
+		}
+	}
+}
+
+func TestParseLinksKinds(t *testing.T) {
+	doc := `<html><head>
+<link rel="canonical" href="/home">
+<link rel="alternate" hreflang="de" href="/de/home">
+<meta http-equiv="Refresh" content="5; URL='/next'">
+<script src="/app.js"></script>
+</head><body>
+<a href="/logo" target="_blank" rel="nofollow noopener" title="Home"><img src="/logo.png" srcset="/logo-2x.png 2x, /logo-3x.png 3x" alt="Gopher logo"></a>
+<map><area href="/region" alt="A region"></map>
+<iframe src="https://example.com/embed"></iframe>
+<form action="/search"></form>
+</body></html>`
+
+	got, err := ParseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse links, err: %s", err)
+	}
+	img := Link{Line: 7, Col: 70}
+	want := []Link{
+		{Href: "/home", Kind: KindLink, Rel: "canonical", Line: 2, Col: 1},
+		{Href: "/de/home", Kind: KindLink, Rel: "alternate", Hreflang: "de", Line: 3, Col: 1},
+		{Href: "/next", Kind: KindRefresh, Line: 4, Col: 1},
+		{Href: "/app.js", Kind: KindScript, Line: 5, Col: 1},
+		img.with(KindImage, "/logo.png", "Gopher logo"),
+		img.with(KindImage, "/logo-2x.png", "Gopher logo"),
+		img.with(KindImage, "/logo-3x.png", "Gopher logo"),
+		{Href: "/logo", Text: "Gopher logo", Kind: KindAnchor, Rel: "nofollow noopener", Title: "Home", Target: "_blank", NoFollow: true, Line: 7, Col: 1},
+		{Href: "/region", Text: "A region", Kind: KindArea, Line: 8, Col: 6},
+		{Href: "https://example.com/embed", Kind: KindIframe, Line: 9, Col: 1},
+		{Href: "/search", Kind: KindForm, Line: 10, Col: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d links want %d:\n%+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("link %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseLinksRobotsNoFollow(t *testing.T) {
+	doc := `<meta name="robots" content="noindex, nofollow"><a href="/a">a</a>`
+	got, err := ParseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse links, err: %s", err)
+	}
+	if len(got) != 1 || !got[0].NoFollow {
+		t.Errorf("links on a nofollow page should be nofollow, got %+v", got)
+	}
+}
+
+func TestTxtNodesAlt(t *testing.T) {
+	doc := `<a href="/home"><img src="/logo.png" alt="Home page"></a>`
+	n, err := html.Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse document, err: %s", err)
+	}
+	got := getLinks(n)
+	if len(got) != 1 || got[0].Text != "Home page" {
+		t.Errorf("image-only link should take its text from alt, got %+v", got)
+	}
+}
+
+func TestParseLinksFuncStops(t *testing.T) {
+	stop := errors.New("stop")
+	var seen []Link
+	err := ParseLinksFunc(strings.NewReader(readExample(t, "ex3.html")), func(l Link) error {
+		seen = append(seen, l)
+		return stop
+	})
+	if err != stop {
+		t.Errorf("got err %v want %v", err, stop)
+	}
+	if len(seen) != 1 {
+		t.Errorf("callback should have run once, ran %d times", len(seen))
+	}
+}
+
+func TestParseLinksChan(t *testing.T) {
+	links, errc := ParseLinksChan(context.Background(), strings.NewReader(readExample(t, "ex3.html")))
+	var got []string
+	for l := range links {
+		got = append(got, l.Href)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("failed to parse links, err: %s", err)
+	}
+	want := []string{
+		"#",
+		"https://gophercises.com/img/gophercises_logo.png",
+		"/do-stuff",
+		"/lost",
+		"https://gophercises.com/img/gophercises_lifting.gif",
+		"https://twitter.com/marcusolsson",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	// Cancelling stops the parse.
+	ctx, cancel := context.WithCancel(context.Background())
+	links, errc = ParseLinksChan(ctx, strings.NewReader(readExample(t, "ex3.html")))
+	<-links
+	cancel()
+	for range links {
+	}
+	if err := <-errc; err != context.Canceled {
+		t.Errorf("got err %v want %v", err, context.Canceled)
+	}
+}
+
+// bigDoc builds an HTML document of roughly size bytes.
+func bigDoc(size int) string {
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	for i := 0; sb.Len() < size; i++ {
+		fmt.Fprintf(&sb, `<div><p>Paragraph %d with <b>bold</b> text.</p><a href="/page/%d">Page <span>%d</span></a></div>`, i, i, i)
+	}
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+func BenchmarkParseLinks(b *testing.B) {
+	doc := bigDoc(4 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		n := 0
+		err := ParseLinksFunc(strings.NewReader(doc), func(Link) error {
+			n++
+			return nil
+		})
+		if err != nil || n == 0 {
+			b.Fatalf("parsed %d links, err: %v", n, err)
+		}
+	}
+}
+
+func BenchmarkTreeLinks(b *testing.B) {
+	doc := bigDoc(4 << 20)
+	b.SetBytes(int64(len(doc)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		n, err := html.Parse(strings.NewReader(doc))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(getLinks(n)) == 0 {
+			b.Fatal("no links parsed")
+		}
+	}
+}
@@ -1,32 +1,205 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
 	"strings"
+	"time"
 )
 
 func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(2)
+		}
+		log.Fatal(err)
+	}
+}
+
+// options are the command line options.
+type options struct {
+	file   string
+	url    string
+	base   string
+	format string
+	kinds  string
+	domain string
+	match  string
+	dedupe bool
+	only   string
+}
 
-	fPtr := flag.String("f", "./ex/ex1.html", "name of file to parse")
-	flag.Parse()
+// run parses the command line args, reads the document,
+// and writes the filtered links to stdout.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	var o options
+	fs := flag.NewFlagSet("linkparser", flag.ContinueOnError)
+	fs.StringVar(&o.file, "f", "", "name of file to parse, or - for stdin (the default)")
+	fs.StringVar(&o.url, "u", "", "URL of a page to fetch and parse instead of a file")
+	fs.StringVar(&o.base, "base", "", "URL to resolve links against when reading a file")
+	fs.StringVar(&o.format, "o", "text", "output format: text, json (one link per line) or csv")
+	fs.StringVar(&o.kinds, "kind", "", "comma separated kinds to keep, e.g. a,img (default all)")
+	fs.StringVar(&o.domain, "domain", "", "keep only links to this domain or its subdomains")
+	fs.StringVar(&o.match, "match", "", "keep only links whose URL matches this regexp")
+	fs.BoolVar(&o.dedupe, "dedupe", false, "drop links repeating an earlier one")
+	fs.StringVar(&o.only, "only", "", "print only the href or text of each link")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
 
-	c, err := ioutil.ReadFile(*fPtr)
-	if err != nil {
-		log.Fatal(err)
+	switch o.format {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("unknown output format %q, want text, json or csv", o.format)
+	}
+	switch o.only {
+	case "", "href", "text":
+	default:
+		return fmt.Errorf("unknown -only value %q, want href or text", o.only)
+	}
+	var re *regexp.Regexp
+	if o.match != "" {
+		var err error
+		if re, err = regexp.Compile(o.match); err != nil {
+			return err
+		}
 	}
-	r := strings.NewReader(string(c))
 
-	l, err := ParseLinks(r)
+	ls, base, err := readLinks(o, stdin)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if base != nil {
+		ls = ResolveLinks(base, ls)
 	}
+	ls = filterLinks(ls, o, re)
 
-	fmt.Println(l)
+	switch o.only {
+	case "href":
+		hrefs := GetURLs(ls)
+		if base != nil {
+			// print hrefs the way they resolved
+			for i, l := range ls {
+				hrefs[i] = l.URL
+			}
+		}
+		return writeStrings(stdout, o.format, "href", hrefs)
+	case "text":
+		return writeStrings(stdout, o.format, "text", GetLinkText(ls))
+	}
+	switch o.format {
+	case "json":
+		return WriteJSONLines(stdout, ls)
+	case "csv":
+		return WriteCSV(stdout, ls)
+	default:
+		return FprintLinks(stdout, ls)
+	}
+}
 
-	// lp.PrintLinks(l)
-	// fmt.Println(lp.GetURLs(l))
-	// fmt.Println(lp.GetLinkText(l))
+// readLinks parses the links from the file, URL or stdin
+// named in o. The base URL to resolve them against is
+// returned when there is one.
+func readLinks(o options, stdin io.Reader) ([]Link, *url.URL, error) {
+	var base *url.URL
+	if o.base != "" {
+		var err error
+		if base, err = url.Parse(o.base); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	switch {
+	case o.url != "" && o.file != "":
+		return nil, nil, errors.New("use either -f or -u, not both")
+
+	case o.url != "":
+		client := http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(o.url)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("fetching %s: %s", o.url, resp.Status)
+		}
+		ls, err := ParseLinks(resp.Body)
+		if base == nil {
+			base = resp.Request.URL // where any redirects ended up
+		}
+		return ls, base, err
+
+	case o.file != "" && o.file != "-":
+		f, err := os.Open(o.file)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		ls, err := ParseLinks(f)
+		return ls, base, err
+
+	default:
+		ls, err := ParseLinks(stdin)
+		return ls, base, err
+	}
+}
+
+// filterLinks keeps the links matching the kind, domain and
+// regexp filters in o, dropping repeats if o.dedupe is set.
+func filterLinks(ls []Link, o options, re *regexp.Regexp) []Link {
+	var kinds []Kind
+	for _, k := range strings.Split(o.kinds, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			kinds = append(kinds, Kind(k))
+		}
+	}
+	if len(kinds) > 0 {
+		ls = OfKind(ls, kinds...)
+	}
+
+	seen := make(map[string]bool)
+	var ret []Link
+	for _, l := range ls {
+		u := l.URL
+		if u == "" {
+			u = l.Href
+		}
+		if o.domain != "" && !inDomain(u, o.domain) {
+			continue
+		}
+		if re != nil && !re.MatchString(u) {
+			continue
+		}
+		if o.dedupe {
+			key := u
+			if o.only == "text" {
+				key = l.Text
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		ret = append(ret, l)
+	}
+	return ret
+}
+
+// inDomain reports whether u is on domain or one of its
+// subdomains. Relative URLs aren't on any domain.
+func inDomain(u, domain string) bool {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(pu.Hostname())
+	domain = strings.ToLower(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
 }
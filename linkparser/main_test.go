@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// checkGolden compares got to testdata/name, rewriting
+// the file instead when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("failed to update golden file %s, err: %s", golden, err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file %s, err: %s", golden, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output doesn't match %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestRunExamples(t *testing.T) {
+	for i := 1; i <= 6; i++ {
+		for _, format := range []string{"text", "json", "csv"} {
+			ex := fmt.Sprintf("ex%d", i)
+			t.Run(ex+"."+format, func(t *testing.T) {
+				var out bytes.Buffer
+				if err := run([]string{"-f", "ex/" + ex + ".html", "-o", format}, nil, &out); err != nil {
+					t.Fatalf("run failed, err: %s", err)
+				}
+				checkGolden(t, ex+"."+format+".golden", out.Bytes())
+			})
+		}
+	}
+}
+
+func TestRunFilters(t *testing.T) {
+	testCases := []struct {
+		golden string
+		args   []string
+	}{
+		{"ex3.anchor-hrefs.golden", []string{"-f", "ex/ex3.html", "-kind", "a", "-only", "href"}},
+		{"ex3.images-csv.golden", []string{"-f", "ex/ex3.html", "-kind", "img,form", "-o", "csv"}},
+		{"ex3.domain.golden", []string{"-f", "ex/ex3.html", "-domain", "gophercises.com", "-only", "href"}},
+		{"ex3.match.golden", []string{"-f", "ex/ex3.html", "-match", `\.gif$`}},
+		{"ex5.dedupe.golden", []string{"-f", "ex/ex5.html", "-dedupe", "-only", "href"}},
+		{"ex5.text-json.golden", []string{"-f", "ex/ex5.html", "-only", "text", "-o", "json"}},
+		{"ex3.base.golden", []string{"-f", "ex/ex3.html", "-base", "https://gophercises.com/signup", "-o", "json"}},
+		{"ex3.base-domain.golden", []string{"-f", "ex/ex3.html", "-base", "https://gophercises.com/", "-domain", "gophercises.com", "-dedupe", "-only", "href"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := run(tc.args, nil, &out); err != nil {
+				t.Fatalf("run failed, err: %s", err)
+			}
+			checkGolden(t, tc.golden, out.Bytes())
+		})
+	}
+}
+
+func TestRunStdin(t *testing.T) {
+	f, err := os.Open("ex/ex2.html")
+	if err != nil {
+		t.Fatalf("failed to open example, err: %s", err)
+	}
+	defer f.Close()
+
+	var out bytes.Buffer
+	if err := run([]string{"-f", "-", "-kind", "a"}, f, &out); err != nil {
+		t.Fatalf("run failed, err: %s", err)
+	}
+	want := "1. Link text: Check me out on twitter, URL: https://www.twitter.com/joncalhoun\n" +
+		"2. Link text: Gophercises is on Github !, URL: https://github.com/gophercises\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestRunURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/docs/", http.StatusMovedPermanently)
+		case "/docs/":
+			fmt.Fprint(w, `<a href="intro">Intro</a><a href="https://other.com/">Other</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	// Links resolve against where the redirect ended up.
+	var out bytes.Buffer
+	if err := run([]string{"-u", srv.URL + "/old", "-only", "href", "-o", "csv"}, nil, &out); err != nil {
+		t.Fatalf("run failed, err: %s", err)
+	}
+	if want := "href\n" + srv.URL + "/docs/intro\nhttps://other.com/\n"; out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := run([]string{"-u", srv.URL + "/old", "-match", "^" + srv.URL, "-o", "json"}, nil, &out); err != nil {
+		t.Fatalf("run failed, err: %s", err)
+	}
+	if !strings.Contains(out.String(), `"url":"`+srv.URL+`/docs/intro","scope":"internal"`) {
+		t.Errorf("link should be resolved against the final URL, got:\n%s", out.String())
+	}
+
+	if err := run([]string{"-u", srv.URL + "/missing"}, nil, &out); err == nil {
+		t.Error("should have received error fetching a missing page")
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	testCases := [][]string{
+		{"-o", "xml"},
+		{"-only", "title"},
+		{"-match", "("},
+		{"-f", "ex/ex1.html", "-u", "http://example.com"},
+		{"-f", "ex/missing.html"},
+	}
+	for _, args := range testCases {
+		if err := run(args, strings.NewReader(""), ioutil.Discard); err == nil {
+			t.Errorf("should have received error for args %q", args)
+		}
+	}
+}
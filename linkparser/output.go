@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteJSONLines writes each Link to w as a line of JSON.
+func WriteJSONLines(w io.Writer, ls []Link) error {
+	enc := json.NewEncoder(w)
+	for _, l := range ls {
+		if err := enc.Encode(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvHeader names the columns written by WriteCSV.
+var csvHeader = []string{"href", "text", "kind", "rel", "title", "target", "nofollow", "line", "col", "url", "scope"}
+
+// WriteCSV writes Links to w as CSV with a header row.
+func WriteCSV(w io.Writer, ls []Link) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, l := range ls {
+		cw.Write([]string{
+			l.Href, l.Text, string(l.Kind), l.Rel, l.Title, l.Target,
+			strconv.FormatBool(l.NoFollow), strconv.Itoa(l.Line), strconv.Itoa(l.Col),
+			l.URL, string(l.Scope),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeStrings writes a single column of values, like the
+// ones from GetURLs or GetLinkText, in the given format.
+func writeStrings(w io.Writer, format, column string, vals []string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		for _, v := range vals {
+			if err := enc.Encode(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{column})
+		for _, v := range vals {
+			cw.Write([]string{v})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		for _, v := range vals {
+			if _, err := fmt.Fprintln(w, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Scope says where a resolved Link points relative to the
+// page it was found on.
+type Scope string
+
+// The scopes ResolveLinks assigns.
+const (
+	ScopeInternal Scope = "internal" // same host as the page
+	ScopeExternal Scope = "external" // another host
+	ScopeNonHTTP  Scope = "non-http" // mailto:, javascript:, tel: and so on
+	ScopeInvalid  Scope = "invalid"  // couldn't be parsed
+)
+
+// defaultPorts are the ports NormalizeURL strips.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// ResolveLinks resolves each Link's Href against the page URL
+// base, or against the page's <base href> if it has one, and
+// sets its normalized URL and Scope. HTTP links are internal
+// when they're on base's host.
+func ResolveLinks(base *url.URL, links []Link) []Link {
+	site := NormalizeURL(base)
+	ref := site
+	for _, l := range links {
+		if l.Kind != KindBase {
+			continue
+		}
+		if bu, err := url.Parse(strings.TrimSpace(l.Href)); err == nil {
+			ref = site.ResolveReference(bu)
+		}
+		break // only the first <base> counts
+	}
+
+	ret := make([]Link, len(links))
+	for i, l := range links {
+		ret[i] = l
+		u, err := url.Parse(strings.TrimSpace(l.Href))
+		if err != nil {
+			ret[i].Scope = ScopeInvalid
+			continue
+		}
+		u = NormalizeURL(ref.ResolveReference(u))
+		ret[i].URL = u.String()
+		switch {
+		case u.Scheme != "http" && u.Scheme != "https":
+			ret[i].Scope = ScopeNonHTTP
+		case u.Host == site.Host:
+			ret[i].Scope = ScopeInternal
+		default:
+			ret[i].Scope = ScopeExternal
+		}
+	}
+	return ret
+}
+
+// NormalizeURL returns a copy of u with its scheme and host
+// lowercased, default ports and fragment stripped, and an
+// empty HTTP path set to "/".
+func NormalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); port != "" && port == defaultPorts[n.Scheme] {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	if (n.Scheme == "http" || n.Scheme == "https") && n.Path == "" && n.Opaque == "" {
+		n.Path = "/"
+	}
+	n.Fragment = ""
+	return &n
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestResolveLinks(t *testing.T) {
+	base, _ := url.Parse("https://Example.com:443/docs/guide/intro.html")
+
+	testCases := []struct {
+		href      string
+		wantURL   string
+		wantScope Scope
+	}{
+		{"next.html", "https://example.com/docs/guide/next.html", ScopeInternal},
+		{"../api/", "https://example.com/docs/api/", ScopeInternal},
+		{"/", "https://example.com/", ScopeInternal},
+		{"", "https://example.com/docs/guide/intro.html", ScopeInternal},
+		{"#section", "https://example.com/docs/guide/intro.html", ScopeInternal},
+		{"  /spaced  ", "https://example.com/spaced", ScopeInternal},
+		{"HTTP://EXAMPLE.com:80", "http://example.com/", ScopeInternal},
+		{"//cdn.example.org/app.js", "https://cdn.example.org/app.js", ScopeExternal},
+		{"https://other.com:8443/x?y=1#z", "https://other.com:8443/x?y=1", ScopeExternal},
+		{"mailto:gopher@example.com", "mailto:gopher@example.com", ScopeNonHTTP},
+		{"javascript:void(0)", "javascript:void(0)", ScopeNonHTTP},
+		{"http://[::1", "", ScopeInvalid},
+	}
+
+	var links []Link
+	for _, tc := range testCases {
+		links = append(links, Link{Href: tc.href, Kind: KindAnchor})
+	}
+	got := ResolveLinks(base, links)
+
+	for i, tc := range testCases {
+		if got[i].URL != tc.wantURL || got[i].Scope != tc.wantScope {
+			t.Errorf("resolving %q got %q %s want %q %s", tc.href, got[i].URL, got[i].Scope, tc.wantURL, tc.wantScope)
+		}
+		if got[i].Href != tc.href {
+			t.Errorf("Href should stay raw, got %q want %q", got[i].Href, tc.href)
+		}
+	}
+}
+
+func TestResolveLinksBaseHref(t *testing.T) {
+	doc := `<html><head><base href="/static/v2/"></head>
+<body><a href="img/a.png">a</a><a href="/root">root</a></body></html>`
+	ls, err := ParseLinks(strings.NewReader(doc))
+	if err != nil {
+		t.Fatalf("failed to parse links, err: %s", err)
+	}
+	page, _ := url.Parse("http://example.com/blog/post")
+	got := OfKind(ResolveLinks(page, ls), KindAnchor)
+
+	want := []string{"http://example.com/static/v2/img/a.png", "http://example.com/root"}
+	for i := range want {
+		if got[i].URL != want[i] {
+			t.Errorf("got %s want %s", got[i].URL, want[i])
+		}
+	}
+}
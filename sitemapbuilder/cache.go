@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// Buckets in the crawl cache.
+var (
+	pagesBucket = []byte("pages") // URL to CacheEntry
+	runsBucket  = []byte("runs")  // lastRunKey to the URLs in the last sitemap
+	lastRunKey  = []byte("last")
+)
+
+// CacheEntry is what the crawl cache remembers about a page.
+type CacheEntry struct {
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"` // header, sent back as If-Modified-Since
+	Hash         string    `json:"hash"`                    // SHA-256 of the body
+	Modified     time.Time `json:"modified,omitempty"`      // when the page last changed, if known
+	Links        []Link    `json:"links"`                   // every link on the page
+	Crawled      time.Time `json:"crawled"`
+}
+
+// Cache is a BoltDB store of the pages seen by earlier crawls,
+// so unchanged pages needn't be downloaded again. Its methods
+// are safe to call from several goroutines, and on a nil
+// Cache, which remembers nothing.
+type Cache struct {
+	db *bolt.DB
+}
+
+// OpenCache opens the crawl cache at path, creating it if needed.
+func OpenCache(path string) (*Cache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{pagesBucket, runsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Cache{db}, nil
+}
+
+// Close closes the cache.
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.db.Close()
+}
+
+// get returns the cached entry for u, or nil if there isn't one.
+func (c *Cache) get(u string) (*CacheEntry, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var e *CacheEntry
+	err := c.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(pagesBucket).Get([]byte(u))
+		if v == nil {
+			return nil
+		}
+		e = &CacheEntry{}
+		return json.Unmarshal(v, e)
+	})
+	return e, err
+}
+
+// put saves the entry for u.
+func (c *Cache) put(u string, e *CacheEntry) error {
+	if c == nil {
+		return nil
+	}
+	v, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(pagesBucket).Put([]byte(u), v)
+	})
+}
+
+// LastRun returns the URLs in the sitemap of the last run.
+func (c *Cache) LastRun() ([]string, error) {
+	var urls []string
+	err := c.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(runsBucket).Get(lastRunKey)
+		if v == nil {
+			return nil
+		}
+		return json.Unmarshal(v, &urls)
+	})
+	return urls, err
+}
+
+// SaveRun saves the URLs in this run's sitemap.
+func (c *Cache) SaveRun(urls []string) error {
+	v, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(runsBucket).Put(lastRunKey, v)
+	})
+}
+
+// diffURLs returns the URLs in cur but not old, and in old
+// but not cur, each in the order they're listed.
+func diffURLs(old, cur []string) (added, removed []string) {
+	inOld := make(map[string]empty)
+	for _, u := range old {
+		inOld[u] = empty{}
+	}
+	inCur := make(map[string]empty)
+	for _, u := range cur {
+		inCur[u] = empty{}
+		if _, ok := inOld[u]; !ok {
+			added = append(added, u)
+		}
+	}
+	for _, u := range old {
+		if _, ok := inCur[u]; !ok {
+			removed = append(removed, u)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func testCache(t *testing.T) (*Cache, func()) {
+	t.Helper()
+	dir := tempDir(t)
+	c, err := OpenCache(filepath.Join(dir, "cache.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("OpenCache() error = %v", err)
+	}
+	return c, func() {
+		c.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCache(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	if e, err := c.get("https://example.com/"); e != nil || err != nil {
+		t.Errorf("get() of an unknown page = %v, %v", e, err)
+	}
+	want := &CacheEntry{
+		ETag:  `"abc"`,
+		Hash:  "1234",
+		Links: []Link{{Href: "/about", Kind: KindAnchor, Line: 1, Col: 1}},
+	}
+	if err := c.put("https://example.com/", want); err != nil {
+		t.Fatalf("put() error = %v", err)
+	}
+	got, err := c.get("https://example.com/")
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("get() = %+v, %v, want %+v", got, err, want)
+	}
+
+	if urls, err := c.LastRun(); urls != nil || err != nil {
+		t.Errorf("LastRun() before any run = %v, %v", urls, err)
+	}
+	run := []string{"https://example.com/", "https://example.com/about"}
+	if err := c.SaveRun(run); err != nil {
+		t.Fatalf("SaveRun() error = %v", err)
+	}
+	if urls, err := c.LastRun(); !reflect.DeepEqual(urls, run) || err != nil {
+		t.Errorf("LastRun() = %v, %v, want %v", urls, err, run)
+	}
+
+	var none *Cache
+	if e, err := none.get("x"); e != nil || err != nil || none.put("x", want) != nil || none.Close() != nil {
+		t.Error("a nil cache should do nothing")
+	}
+}
+
+func Test_diffURLs(t *testing.T) {
+	added, removed := diffURLs([]string{"a", "b", "c"}, []string{"b", "d", "c", "e"})
+	if want := []string{"d", "e"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"a"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if added, removed := diffURLs(nil, nil); added != nil || removed != nil {
+		t.Errorf("diff of nothing = %v, %v", added, removed)
+	}
+}
+
+func Test_diffLastRun(t *testing.T) {
+	c, done := testCache(t)
+	defer done()
+
+	var out bytes.Buffer
+	diffLastRun(&out, c, []Page{{URL: "a"}, {URL: "b"}})
+	out.Reset()
+	if err := diffLastRun(&out, c, []Page{{URL: "b"}, {URL: "c"}}); err != nil {
+		t.Fatalf("diffLastRun() error = %v", err)
+	}
+	if want := "1 URLs added, 1 removed since the last run\n+ c\n- a\n"; out.String() != want {
+		t.Errorf("diffLastRun() printed %q, want %q", out.String(), want)
+	}
+}
+
+// cachingSite serves pages with ETags, counting full and
+// conditional responses.
+type cachingSite struct {
+	mu     sync.Mutex
+	pages  map[string]string
+	full   int
+	notMod int
+}
+
+func (cs *cachingSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	body, ok := cs.pages[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	etag := fmt.Sprintf(`"%x"`, len(body))
+	if r.Header.Get("If-None-Match") == etag {
+		cs.notMod++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	cs.full++
+	w.Header().Set("ETag", etag)
+	fmt.Fprint(w, body)
+}
+
+func TestCrawler_CrawlCached(t *testing.T) {
+	site := &cachingSite{pages: map[string]string{
+		"/":      `<a href="/a">a</a><a href="/b">b</a>`,
+		"/a":     `<a href="/c">c</a>`,
+		"/b":     `b`,
+		"/c":     `c`,
+		"/extra": `extra`,
+	}}
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+	cache, done := testCache(t)
+	defer done()
+
+	c := testCrawler()
+	c.Cache = cache
+	first := crawlPaths(t, c, srv)
+	if site.full != 4 || site.notMod != 0 {
+		t.Errorf("first crawl: %d full and %d conditional responses, want 4 and 0", site.full, site.notMod)
+	}
+
+	// Unchanged pages come back 304 and their cached links are followed.
+	site.full, site.notMod = 0, 0
+	if again := crawlPaths(t, c, srv); !reflect.DeepEqual(again, first) {
+		t.Errorf("second crawl found %v, want %v", again, first)
+	}
+	if site.full != 0 || site.notMod != 4 {
+		t.Errorf("second crawl: %d full and %d conditional responses, want 0 and 4", site.full, site.notMod)
+	}
+
+	// A changed page is downloaded again, and its change dated.
+	site.full, site.notMod = 0, 0
+	site.pages["/b"] = `<a href="/extra">extra</a>`
+	before := time.Now()
+	pages, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	if want := []string{srv.URL, srv.URL + "/a", srv.URL + "/b", srv.URL + "/c", srv.URL + "/extra"}; !reflect.DeepEqual(pageURLs(pages), want) {
+		t.Errorf("third crawl found %v, want %v", pageURLs(pages), want)
+	}
+	if site.full != 2 || site.notMod != 3 {
+		t.Errorf("third crawl: %d full and %d conditional responses, want 2 and 3", site.full, site.notMod)
+	}
+	for _, p := range pages {
+		changed := p.URL == srv.URL+"/b"
+		if changed != !p.Modified.Before(before) {
+			t.Errorf("%s modified %v, changed = %v", p.URL, p.Modified, changed)
+		}
+	}
+}
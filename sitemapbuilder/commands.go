@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+)
+
+// interruptContext returns a context cancelled on interrupt.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		select {
+		case <-sig:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(sig)
+	}()
+	return ctx, cancel
+}
+
+// diffCmd runs "sitemapbuilder diff old.xml new.xml", printing
+// the pages added, removed and changed. Like diff(1) it exits 1
+// when the sitemaps differ and 2 on trouble.
+func diffCmd(args []string) int {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sitemapbuilder diff old.xml new.xml")
+		fmt.Fprintln(fs.Output(), "Either sitemap can be a file or URL, gzipped or a sitemap index.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	c := NewCrawler()
+	old, err := loadSitemap(ctx, c, fs.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	cur, err := loadSitemap(ctx, c, fs.Arg(1))
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+
+	d := diffSitemaps(old, cur)
+	if err := d.Write(os.Stdout); err != nil {
+		log.Print(err)
+		return 2
+	}
+	if !d.Empty() {
+		return 1
+	}
+	return 0
+}
+
+// verifyCmd runs "sitemapbuilder verify sitemap.xml", fetching
+// every page listed and printing the ones with problems. It
+// exits 1 when there are any and 2 on trouble.
+func verifyCmd(args []string) int {
+	c := NewCrawler()
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "number of pages to fetch at once")
+	fs.DurationVar(&c.RateLimit, "rate", c.RateLimit, "minimum time between requests to the same host, e.g. 200ms")
+	fs.DurationVar(&c.Timeout, "timeout", c.Timeout, "time limit for each request")
+	fs.IntVar(&c.Retries, "retries", c.Retries, "times to retry a request that fails")
+	fs.StringVar(&c.UserAgent, "user-agent", c.UserAgent, "user agent to send")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: sitemapbuilder verify [flags] sitemap.xml")
+		fmt.Fprintln(fs.Output(), "The sitemap can be a file or URL, gzipped or a sitemap index.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, cancel := interruptContext()
+	defer cancel()
+	pages, err := loadSitemap(ctx, c, fs.Arg(0))
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	results := c.Verify(ctx, pages)
+	bad, err := writeVerifyResults(os.Stdout, results)
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		log.Print(err)
+		return 2
+	}
+	if bad > 0 {
+		return 1
+	}
+	return 0
+}
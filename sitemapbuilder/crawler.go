@@ -0,0 +1,605 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Crawler crawls the pages of a site with a pool of workers.
+type Crawler struct {
+	Client      *http.Client
+	Concurrency int           // number of pages fetched at once
+	RateLimit   time.Duration // minimum time between requests to one host
+	Timeout     time.Duration // time limit for each request
+	Retries     int           // times a failed request is retried
+	Backoff     time.Duration // wait before the first retry, doubled after each
+
+	MaxDepth int         // clicks from the root to follow, 0 for no limit
+	MaxPages int         // pages to crawl, 0 for no limit
+	Include  patternList // when set, only paths matching one are followed
+	Exclude  patternList // paths matching one are never followed
+	Query    QueryPolicy // query parameters kept on URLs
+
+	UserAgent string // sent with requests and matched against robots.txt
+	Robots    bool   // follow robots.txt rules and Crawl-delay
+
+	Images   bool // collect the images on each page
+	Hreflang bool // collect each page's alternate language versions
+
+	// Report, when set, records the status of every page
+	// and, with a HEAD request, every external link.
+	Report *Report
+
+	// Cache, when set, remembers pages between crawls so
+	// unchanged ones are only requested conditionally.
+	Cache *Cache
+
+	// Graph, when set, records which page links to which.
+	Graph *LinkGraph
+
+	limiter *hostLimiter
+	robots  *robots
+}
+
+// NewCrawler creates a crawler with sensible defaults.
+func NewCrawler() *Crawler {
+	return &Crawler{
+		Client:      http.DefaultClient,
+		Concurrency: 8,
+		Timeout:     30 * time.Second,
+		Retries:     2,
+		Backoff:     500 * time.Millisecond,
+		Exclude:     append(patternList{}, defaultExcludes...),
+		UserAgent:   "sitemapbuilder/1.0",
+		Robots:      true,
+	}
+}
+
+// crawlJob is a page waiting to be fetched.
+type crawlJob struct {
+	url      string
+	depth    int  // clicks from the root page
+	external bool // only check the link works
+}
+
+// crawlResult is what a worker found on a page.
+type crawlResult struct {
+	crawlJob
+	pageInfo
+	err error
+}
+
+// pageInfo is what visiting a page turns up.
+type pageInfo struct {
+	links      []string  // page URLs in the domain
+	externals  []string  // http URLs outside it
+	redirect   string    // where the page redirected to, if elsewhere
+	modified   time.Time // when the page last changed, if known
+	images     []Image
+	alternates []Alternate
+}
+
+// Crawl crawls the site starting at rootURL and returns its pages
+// sorted by URL. Pages that can't be fetched are logged and left
+// out. If ctx is cancelled the pages found so far are returned
+// along with the context's error.
+func (c *Crawler) Crawl(ctx context.Context, rootURL string) ([]Page, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ru, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, err
+	}
+	c.limiter = newHostLimiter(c.RateLimit)
+	c.robots = nil
+	if c.Robots {
+		if c.robots, err = c.fetchRobots(ctx, ru); err != nil {
+			return nil, err
+		}
+		if c.robots.delay > c.limiter.interval {
+			c.limiter.interval = c.robots.delay
+		}
+		if !c.robots.allowed(ru) {
+			return nil, fmt.Errorf("robots.txt doesn't allow %s to crawl %s", c.UserAgent, rootURL)
+		}
+	}
+
+	n := c.Concurrency
+	if n < 1 {
+		n = 1
+	}
+	jobs := make(chan crawlJob)
+	results := make(chan crawlResult)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if j.external {
+					results <- crawlResult{j, pageInfo{}, c.check(ctx, j.url)}
+					continue
+				}
+				info, err := c.visit(ctx, j.url)
+				results <- crawlResult{j, info, err}
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	// The site is crawled a level at a time, so every page in
+	// one level is done before the next starts and a page's
+	// depth is its fewest clicks from the root, however the
+	// results come in.
+	found := map[string]empty{rootURL: {}}
+	checked := make(map[string]empty) // external links
+	queue := []crawlJob{{url: rootURL}}
+	nextLevel := make(map[string]empty)
+	depth := 0
+	inflight := 0
+	var SitePages []Page
+	var rootErr error
+	done := ctx.Done()
+
+	for {
+		if inflight == 0 && len(queue) == 0 && len(nextLevel) > 0 && ctx.Err() == nil {
+			depth++
+			queue = c.level(nextLevel, found, depth)
+			nextLevel = make(map[string]empty)
+		}
+		if inflight == 0 && (len(queue) == 0 || ctx.Err() != nil) {
+			break
+		}
+
+		// only offer a job when there's one to give
+		var send chan crawlJob
+		var next crawlJob
+		if len(queue) > 0 && ctx.Err() == nil {
+			send, next = jobs, queue[0]
+		}
+
+		select {
+		case send <- next:
+			queue = queue[1:]
+			inflight++
+
+		case r := <-results:
+			inflight--
+			if r.external {
+				continue
+			}
+			if r.err != nil {
+				if r.url == rootURL {
+					rootErr = r.err
+				}
+				if ctx.Err() == nil {
+					log.Printf("skipping %s: %s", r.url, r.err)
+				}
+				continue
+			}
+			if r.redirect == "" {
+				SitePages = append(SitePages, Page{
+					URL:        r.url,
+					Images:     r.images,
+					Alternates: r.alternates,
+					Depth:      r.depth,
+					Modified:   r.modified,
+				})
+			}
+			c.Graph.addPage(r.url, r.depth, r.links)
+			c.Report.linksFrom(r.url, r.links)
+			c.Report.linksFrom(r.url, r.externals)
+
+			// Unfound pages are crawled in the next level,
+			// as long as it's within the depth limit.
+			if c.MaxDepth > 0 && r.depth >= c.MaxDepth {
+				continue
+			}
+			for _, dl := range r.links {
+				if _, ok := found[dl]; !ok {
+					nextLevel[dl] = empty{}
+				}
+			}
+			if c.Report == nil {
+				continue
+			}
+			for _, el := range r.externals {
+				if _, ok := checked[el]; !ok {
+					checked[el] = empty{}
+					queue = append(queue, crawlJob{url: el, external: true})
+				}
+			}
+
+		case <-done:
+			queue, done = nil, nil // let the workers finish what they have
+		}
+	}
+
+	sort.Slice(SitePages, func(i, j int) bool { return SitePages[i].URL < SitePages[j].URL })
+	if err := ctx.Err(); err != nil {
+		return SitePages, err
+	}
+	if rootErr != nil {
+		return nil, rootErr
+	}
+	return SitePages, nil
+}
+
+// level adds the pages of the next level to found and returns
+// the jobs to crawl them, in URL order so the pages kept under
+// the page limit are the same from one crawl to the next.
+func (c *Crawler) level(pages, found map[string]empty, depth int) []crawlJob {
+	urls := make([]string, 0, len(pages))
+	for u := range pages {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	var jobs []crawlJob
+	for _, u := range urls {
+		if c.MaxPages > 0 && len(found) >= c.MaxPages {
+			break
+		}
+		found[u] = empty{}
+		jobs = append(jobs, crawlJob{url: u, depth: depth})
+	}
+	return jobs
+}
+
+// visit fetches a page and returns the sorted URLs it links
+// to in the same domain, along with when it last changed and,
+// if the crawler collects them, its images and alternates.
+// Pages that don't come back 200 OK are errors, and a page
+// that redirects elsewhere only links to where it went.
+func (c *Crawler) visit(ctx context.Context, lnk string) (pageInfo, error) {
+	var info pageInfo
+	var links []Link
+	cached, err := c.Cache.get(lnk)
+	if err != nil {
+		log.Printf("reading cache for %s: %s", lnk, err)
+	}
+	f := fetch{method: http.MethodGet, url: lnk, status: &URLStatus{URL: lnk}}
+	if cached != nil {
+		f.header = http.Header{}
+		if cached.ETag != "" {
+			f.header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			f.header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	st := f.status
+	var entry *CacheEntry
+	err = c.get(ctx, f, func(resp *http.Response) error {
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			links, info.modified = cached.Links, cached.Modified
+			return nil
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("fetching %s: %s", lnk, resp.Status)
+		}
+		if st.FinalURL != "" {
+			// a redirect that only adds or drops a trailing
+			// slash leads to the same page as far as we know
+			final := resp.Request.URL.String()
+			clean(&final)
+			if final != lnk {
+				info.redirect = resp.Request.URL.String()
+				return nil
+			}
+		}
+		info.modified = lastModified(resp.Header)
+		entry = &CacheEntry{
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		hash := sha256.New()
+		body := io.TeeReader(resp.Body, hash)
+		defer func() {
+			entry.Hash = hex.EncodeToString(hash.Sum(nil))
+		}()
+		if !isHTML(st.ContentType) {
+			_, err := io.Copy(ioutil.Discard, body)
+			return err
+		}
+
+		// scan the head for a modified date as the links are parsed
+		pr, pw := io.Pipe()
+		metaTime := make(chan time.Time, 1)
+		go func() {
+			t := scanLastMod(pr)
+			io.Copy(ioutil.Discard, pr)
+			metaTime <- t
+		}()
+		l, err := ParseLinks(io.TeeReader(body, pw))
+		if err == nil {
+			_, err = io.Copy(pw, body) // hash whatever the parser left
+		}
+		pw.Close()
+		if t := <-metaTime; !t.IsZero() {
+			info.modified = t
+		}
+		links = l
+		return err
+	})
+	c.Report.record(st)
+	if err != nil {
+		return info, err
+	}
+	if info.redirect != "" {
+		links = []Link{{Href: info.redirect, Kind: KindAnchor}}
+	}
+	if entry != nil && c.Cache != nil {
+		// without a date from the server, the page changed
+		// when its content did
+		if info.modified.IsZero() && cached != nil {
+			info.modified = cached.Modified
+			if entry.Hash != cached.Hash {
+				info.modified = time.Now()
+			}
+		}
+		entry.Modified, entry.Links, entry.Crawled = info.modified, links, time.Now()
+		if err := c.Cache.put(lnk, entry); err != nil {
+			log.Printf("caching %s: %s", lnk, err)
+		}
+	}
+
+	// only follow links that lead to other pages, keeping
+	// any <base> so they resolve the way a browser would
+	followable := OfKind(links, KindAnchor, KindArea, KindRefresh, KindBase)
+	uid, err := filterLinks(lnk, followable, c.Query)
+	if err != nil {
+		return info, err
+	}
+	for _, u := range keyList(uid) {
+		if c.follows(u) {
+			info.links = append(info.links, u)
+		}
+	}
+	sort.Strings(info.links)
+
+	pu, err := url.Parse(lnk)
+	if err != nil {
+		return info, err
+	}
+	resolved := ResolveLinks(pu, links)
+	if c.Report != nil {
+		info.externals = externalLinks(ResolveLinks(pu, followable))
+	}
+	if c.Images {
+		info.images = pageImages(resolved)
+	}
+	if c.Hreflang {
+		info.alternates = pageAlternates(resolved)
+	}
+	return info, nil
+}
+
+// check makes a HEAD request for an external link, falling back
+// to GET for servers that don't support HEAD, and records how
+// it went in the report.
+func (c *Crawler) check(ctx context.Context, u string) error {
+	f := fetch{method: http.MethodHead, url: u, status: &URLStatus{URL: u, External: true}}
+	ignore := func(*http.Response) error { return nil }
+	err := c.get(ctx, f, ignore)
+	if s := f.status.Status; s == http.StatusMethodNotAllowed || s == http.StatusNotImplemented {
+		f.method = http.MethodGet
+		err = c.get(ctx, f, ignore)
+	}
+	c.Report.record(f.status)
+	return err
+}
+
+// externalLinks returns the sorted, distinct http URLs
+// outside the domain among a page's resolved links.
+func externalLinks(links []Link) []string {
+	uid := make(map[string]empty)
+	for _, l := range links {
+		if l.Scope == ScopeExternal && l.Kind != KindBase {
+			uid[l.URL] = empty{}
+		}
+	}
+	urls := keyList(uid)
+	sort.Strings(urls)
+	return urls
+}
+
+// isHTML reports whether a Content-Type is HTML, or missing.
+func isHTML(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return contentType == "" || (err == nil && (mt == "text/html" || mt == "application/xhtml+xml"))
+}
+
+// pageImages returns the images among a page's resolved links.
+func pageImages(links []Link) []Image {
+	seen := make(map[string]bool)
+	var images []Image
+	for _, l := range OfKind(links, KindImage) {
+		if l.Scope != ScopeInternal && l.Scope != ScopeExternal {
+			continue
+		}
+		if !seen[l.URL] {
+			seen[l.URL] = true
+			images = append(images, Image{Loc: l.URL})
+		}
+	}
+	return images
+}
+
+// pageAlternates returns the alternate language versions
+// of a page declared in its <link rel="alternate"> tags.
+func pageAlternates(links []Link) []Alternate {
+	var alts []Alternate
+	for _, l := range OfKind(links, KindLink) {
+		if l.Hreflang == "" || !hasToken(l.Rel, "alternate") {
+			continue
+		}
+		if l.Scope != ScopeInternal && l.Scope != ScopeExternal {
+			continue
+		}
+		alts = append(alts, Alternate{Rel: "alternate", Hreflang: l.Hreflang, Href: l.URL})
+	}
+	return alts
+}
+
+// follows reports whether u passes the include and
+// exclude patterns and robots.txt.
+func (c *Crawler) follows(u string) bool {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+	if len(c.Include) > 0 && !c.Include.matches(pu) {
+		return false
+	}
+	return !c.Exclude.matches(pu) && c.robots.allowed(pu)
+}
+
+// fetchRobots fetches and parses the robots.txt for root's host.
+// A missing or unreachable robots.txt allows everything.
+func (c *Crawler) fetchRobots(ctx context.Context, root *url.URL) (*robots, error) {
+	ru := url.URL{Scheme: root.Scheme, Host: root.Host, Path: "/robots.txt"}
+	var rb *robots
+	err := c.get(ctx, fetch{method: http.MethodGet, url: ru.String()}, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		var err error
+		rb, err = parseRobots(resp.Body, c.UserAgent)
+		return err
+	})
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		log.Printf("ignoring robots.txt: %s", err)
+	}
+	if rb == nil {
+		rb = &robots{}
+	}
+	return rb, nil
+}
+
+// fetch is a request for the crawler to make.
+type fetch struct {
+	method string
+	url    string
+	header http.Header // sent along with the User-Agent
+	status *URLStatus  // when set, records how the last attempt went
+}
+
+// get makes the request f, retrying network errors and server
+// errors with exponential backoff, and hands the response to fn.
+func (c *Crawler) get(ctx context.Context, f fetch, fn func(*http.Response) error) error {
+	backoff := c.Backoff
+	var err error
+	for attempt := 0; attempt <= c.Retries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff); err != nil {
+				return err
+			}
+			backoff *= 2
+		}
+		var retry bool
+		retry, err = c.try(ctx, f, fn)
+		if !retry || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// try makes a single rate limited request, reporting
+// whether a failure is worth retrying.
+func (c *Crawler) try(ctx context.Context, f fetch, fn func(*http.Response) error) (bool, error) {
+	pu, err := url.Parse(f.url)
+	if err != nil {
+		return false, err
+	}
+	if err := c.limiter.wait(ctx, pu.Host); err != nil {
+		return false, err
+	}
+
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequest(f.method, f.url, nil)
+	if err != nil {
+		return false, err
+	}
+	for k, v := range f.header {
+		req.Header[k] = v
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	start := time.Now()
+	resp, err := c.Client.Do(req.WithContext(ctx))
+	if f.status != nil {
+		f.status.fill(resp, err, time.Since(start))
+	}
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+		return true, fmt.Errorf("fetching %s: %s", f.url, resp.Status)
+	}
+	return false, fn(resp)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hostLimiter spaces out requests to each host.
+type hostLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[string]time.Time
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{interval: interval, next: make(map[string]time.Time)}
+}
+
+// wait blocks until a request to host is allowed.
+func (l *hostLimiter) wait(ctx context.Context, host string) error {
+	if l.interval <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next[host]
+	if at.Before(now) {
+		at = now
+	}
+	l.next[host] = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleep(ctx, time.Until(at))
+}
@@ -0,0 +1,502 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testSite serves a site of n pages in a binary tree: the root
+// links to /page/1 and /page/i links to /page/2i and /page/2i+1.
+// Every 50th page fails with a 503 the first time it's requested.
+type testSite struct {
+	n        int
+	delay    time.Duration
+	mu       sync.Mutex
+	requests map[string]int
+	inflight int32
+	maxSeen  int32
+}
+
+func newTestSite(n int) *testSite {
+	return &testSite{n: n, requests: make(map[string]int)}
+}
+
+func (ts *testSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cur := atomic.AddInt32(&ts.inflight, 1)
+	defer atomic.AddInt32(&ts.inflight, -1)
+	for {
+		max := atomic.LoadInt32(&ts.maxSeen)
+		if cur <= max || atomic.CompareAndSwapInt32(&ts.maxSeen, max, cur) {
+			break
+		}
+	}
+	time.Sleep(ts.delay)
+
+	ts.mu.Lock()
+	ts.requests[r.URL.Path]++
+	count := ts.requests[r.URL.Path]
+	ts.mu.Unlock()
+
+	var i int
+	switch {
+	case r.URL.Path == "/":
+		fmt.Fprint(w, `<a href="/page/1">start</a><a href="https://elsewhere.com/">away</a>`)
+		return
+	case sscanPage(r.URL.Path, &i) && i >= 1 && i <= ts.n:
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if i%50 == 0 && count == 1 {
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, `<a href="/">home</a><img src="/img/%d.png">`, i)
+	for _, child := range []int{2 * i, 2*i + 1} {
+		if child <= ts.n {
+			fmt.Fprintf(w, `<a href="../page/%d#top">child</a>`, child)
+		}
+	}
+}
+
+func sscanPage(p string, i *int) bool {
+	_, err := fmt.Sscanf(p, "/page/%d", i)
+	return err == nil
+}
+
+// wantURLs lists every page of a test site at url, sorted.
+func (ts *testSite) wantURLs(url string) []string {
+	var urls []string
+	for i := 1; i <= ts.n; i++ {
+		urls = append(urls, fmt.Sprintf("%s/page/%d", url, i))
+	}
+	urls = append(urls, url)
+	sort.Strings(urls)
+	return urls
+}
+
+// pageURLs lists the URLs of pages.
+func pageURLs(pages []Page) []string {
+	var urls []string
+	for _, p := range pages {
+		urls = append(urls, p.URL)
+	}
+	return urls
+}
+
+func testCrawler() *Crawler {
+	c := NewCrawler()
+	c.Backoff = time.Millisecond
+	c.Timeout = 5 * time.Second
+	return c
+}
+
+func TestCrawler_Crawl(t *testing.T) {
+	site := newTestSite(300)
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	c := testCrawler()
+	c.Concurrency = 6
+	got, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	if want := site.wantURLs(srv.URL); !reflect.DeepEqual(pageURLs(got), want) {
+		t.Errorf("Crawl() found %d pages, want %d", len(got), len(want))
+	}
+	for _, p := range got {
+		// /page/i is log2(i)+1 clicks from the root
+		var i int
+		if sscanPage(strings.TrimPrefix(p.URL, srv.URL), &i) {
+			if want := bits.Len(uint(i)); p.Depth != want {
+				t.Errorf("%s depth = %d, want %d", p.URL, p.Depth, want)
+			}
+		}
+	}
+
+	// Each page is fetched once, or twice when it failed the first time.
+	for p, n := range site.requests {
+		var i int
+		if want := 1; n != want && !(sscanPage(p, &i) && i%50 == 0 && n == 2) {
+			t.Errorf("%s requested %d times", p, n)
+		}
+	}
+	if site.maxSeen > int32(c.Concurrency) {
+		t.Errorf("saw %d requests at once, concurrency is %d", site.maxSeen, c.Concurrency)
+	}
+
+	// A second crawl gives the same result.
+	again, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil || !reflect.DeepEqual(got, again) {
+		t.Errorf("second crawl differed, err = %v", err)
+	}
+}
+
+func TestCrawler_CrawlRetriesExhausted(t *testing.T) {
+	site := newTestSite(100)
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	// Without retries the pages that fail once, and the pages
+	// only they link to, are left out.
+	c := testCrawler()
+	c.Retries = 0
+	got, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	for _, p := range got {
+		if p.URL == srv.URL+"/page/50" || p.URL == srv.URL+"/page/100" {
+			t.Errorf("%s should have been skipped", p.URL)
+		}
+	}
+	if len(got) != 99 {
+		t.Errorf("got %d pages, want 99", len(got))
+	}
+}
+
+func TestCrawler_CrawlRateLimit(t *testing.T) {
+	site := newTestSite(10)
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	c := testCrawler()
+	c.RateLimit = 20 * time.Millisecond
+	start := time.Now()
+	got, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	// 11 requests to one host need at least 10 intervals.
+	if elapsed, min := time.Since(start), 10*c.RateLimit; elapsed < min {
+		t.Errorf("crawl of %d pages took %s, want at least %s", len(got), elapsed, min)
+	}
+}
+
+func TestCrawler_CrawlCancel(t *testing.T) {
+	site := newTestSite(500)
+	site.delay = 5 * time.Millisecond
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	got, err := testCrawler().Crawl(ctx, srv.URL)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Crawl() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if len(got) == 0 || len(got) >= 501 {
+		t.Errorf("cancelled crawl should return some but not all pages, got %d", len(got))
+	}
+}
+
+func TestCrawler_CrawlRootFails(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := testCrawler()
+	if _, err := c.Crawl(context.Background(), srv.URL); err == nil {
+		t.Error("Crawl() should fail when the root page can't be fetched")
+	}
+}
+
+// crawlURLs crawls srv with c and returns the paths found.
+func crawlPaths(t *testing.T, c *Crawler, srv *httptest.Server) []string {
+	t.Helper()
+	pages, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	var paths []string
+	for _, p := range pages {
+		paths = append(paths, strings.TrimPrefix(p.URL, srv.URL))
+	}
+	return paths
+}
+
+func TestCrawler_CrawlLimits(t *testing.T) {
+	site := newTestSite(100)
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		setup func(c *Crawler)
+		want  []string
+	}{
+		{"max depth", func(c *Crawler) { c.MaxDepth = 2 }, []string{"", "/page/1", "/page/2", "/page/3"}},
+		{"max pages", func(c *Crawler) { c.MaxPages = 5 }, []string{"", "/page/1", "/page/2", "/page/3", "/page/4"}},
+		{"include", func(c *Crawler) {
+			c.Include.Set("/page/1")
+			c.Include.Set("re:^/page/[23]$")
+		}, []string{"", "/page/1", "/page/2", "/page/3"}},
+		{"exclude", func(c *Crawler) {
+			c.MaxDepth = 2
+			c.Exclude.Set("/page/2")
+		}, []string{"", "/page/1", "/page/3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := testCrawler()
+			tt.setup(c)
+			if got := crawlPaths(t, c, srv); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawler_CrawlDepth(t *testing.T) {
+	// A diamond, where /x is two clicks away through /b and
+	// three through /a and /c. /b is slow, so the long way
+	// round is found first.
+	links := map[string][]string{
+		"/":  {"/a", "/b"},
+		"/a": {"/c"},
+		"/b": {"/x"},
+		"/c": {"/x"},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		for _, l := range links[r.URL.Path] {
+			fmt.Fprintf(w, `<a href="%s">%s</a>`, l, l)
+		}
+	}))
+	defer srv.Close()
+
+	for _, maxDepth := range []int{0, 2} {
+		c := testCrawler()
+		c.Robots = false
+		c.MaxDepth = maxDepth
+		pages, err := c.Crawl(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		depths := make(map[string]int)
+		for _, p := range pages {
+			depths[strings.TrimPrefix(p.URL, srv.URL)] = p.Depth
+		}
+		want := map[string]int{"": 0, "/a": 1, "/b": 1, "/c": 2, "/x": 2}
+		if !reflect.DeepEqual(depths, want) {
+			t.Errorf("max depth %d: got depths %v, want %v", maxDepth, depths, want)
+		}
+	}
+}
+
+func TestCrawler_CrawlRobots(t *testing.T) {
+	var agents []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		agents = append(agents, r.UserAgent())
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: *\nDisallow: /\n\nUser-agent: testbot\nDisallow: /admin\nCrawl-delay: 0.03\n")
+		case "/":
+			fmt.Fprint(w, `<a href="/admin/users">admin</a><a href="/about">about</a><a href="/blog?page=2&utm=x">blog</a>`)
+		default:
+			fmt.Fprint(w, "nothing here")
+		}
+	}))
+	defer srv.Close()
+
+	c := testCrawler()
+	c.UserAgent = "testbot/1.0"
+	c.Query = QueryPolicy{"page"}
+	start := time.Now()
+	got := crawlPaths(t, c, srv)
+	if want := []string{"", "/about", "/blog?page=2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Three pages need two crawl delays between them.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("crawl took %s, should have honored the crawl delay", elapsed)
+	}
+	for _, a := range agents {
+		if a != c.UserAgent {
+			t.Errorf("request sent with user agent %q, want %q", a, c.UserAgent)
+		}
+	}
+
+	// Other agents are kept out entirely.
+	c.UserAgent = "otherbot"
+	if _, err := c.Crawl(context.Background(), srv.URL); err == nil {
+		t.Error("Crawl() should fail when robots.txt disallows the root")
+	}
+
+	// Unless robots.txt is ignored.
+	c.Robots = false
+	if got := crawlPaths(t, c, srv); len(got) != 4 {
+		t.Errorf("ignoring robots.txt should crawl every page, got %v", got)
+	}
+}
+
+func TestCrawler_CrawlPageInfo(t *testing.T) {
+	modified := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+			fmt.Fprint(w, `<html><head>
+<link rel="alternate" hreflang="de" href="/de/">
+<link rel="stylesheet" href="/style.css">
+</head><body>
+<img src="/logo.png"><img src="logo.png" srcset="/logo-2x.png 2x">
+<img src="data:image/png;base64,AAAA">
+<a href="/about">about</a>
+</body></html>`)
+		case "/about":
+			fmt.Fprint(w, `<head><meta property="article:modified_time" content="2021-01-02T03:04:05Z"></head>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := testCrawler()
+	c.Images = true
+	c.Hreflang = true
+	got, err := c.Crawl(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatalf("Crawl() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %v, want 2 pages", pageURLs(got))
+	}
+	root, about := got[0], got[1]
+
+	if !root.Modified.Equal(modified) {
+		t.Errorf("root modified = %v, want %v from the header", root.Modified, modified)
+	}
+	if want := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC); !about.Modified.Equal(want) {
+		t.Errorf("about modified = %v, want %v from the meta tag", about.Modified, want)
+	}
+	wantImages := []Image{{srv.URL + "/logo.png"}, {srv.URL + "/logo-2x.png"}}
+	if !reflect.DeepEqual(root.Images, wantImages) {
+		t.Errorf("images = %v, want %v", root.Images, wantImages)
+	}
+	wantAlts := []Alternate{{"alternate", "de", srv.URL + "/de/"}}
+	if !reflect.DeepEqual(root.Alternates, wantAlts) {
+		t.Errorf("alternates = %v, want %v", root.Alternates, wantAlts)
+	}
+	if about.Images != nil || about.Alternates != nil {
+		t.Errorf("about should have no images or alternates, got %v %v", about.Images, about.Alternates)
+	}
+}
+
+func TestCrawler_CrawlReport(t *testing.T) {
+	ext := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/nohead":
+			if r.Method == http.MethodHead {
+				http.Error(w, "no", http.StatusMethodNotAllowed)
+			}
+		default:
+			if r.Method != http.MethodHead {
+				t.Errorf("external link checked with %s, want HEAD", r.Method)
+			}
+			http.NotFound(w, r)
+		}
+	}))
+	defer ext.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprintf(w, `<a href="/about">about</a><a href="/missing">missing</a><a href="/old">old</a>
+<a href="/report.pdf?x">pdf</a><a href="%[1]s/ok">ok</a><a href="%[1]s/gone">gone</a>`, ext.URL)
+		case "/about":
+			fmt.Fprintf(w, `<a href="/missing">missing again</a><a href="/broken">broken</a><a href="%s/nohead">x</a>`, ext.URL)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, "new page")
+		case "/broken":
+			http.Error(w, "oops", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := testCrawler()
+	c.Retries = 0
+	c.Report = NewReport()
+	got := crawlPaths(t, c, srv)
+
+	// Only pages that came back 200 OK, not redirects, make the sitemap.
+	if want := []string{"", "/about", "/new"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	statuses := make(map[string]URLStatus)
+	for _, s := range c.Report.URLs() {
+		statuses[s.URL] = s
+	}
+	wantStatus := map[string]int{
+		srv.URL:              200,
+		srv.URL + "/about":   200,
+		srv.URL + "/missing": 404,
+		srv.URL + "/old":     200,
+		srv.URL + "/new":     200,
+		srv.URL + "/broken":  500,
+		ext.URL + "/ok":      200,
+		ext.URL + "/gone":    404,
+		ext.URL + "/nohead":  200,
+	}
+	if len(statuses) != len(wantStatus) {
+		t.Errorf("report has %d URLs, want %d", len(statuses), len(wantStatus))
+	}
+	for u, want := range wantStatus {
+		if s := statuses[u]; s.Status != want {
+			t.Errorf("%s status = %d, want %d", u, s.Status, want)
+		}
+	}
+	old := statuses[srv.URL+"/old"]
+	if want := []Redirect{{srv.URL + "/old", 301}}; !reflect.DeepEqual(old.Redirects, want) || old.FinalURL != srv.URL+"/new" {
+		t.Errorf("/old redirects = %v to %s, want %v to /new", old.Redirects, old.FinalURL, want)
+	}
+	if s := statuses[srv.URL+"/new"]; s.ContentType != "text/html; charset=utf-8" || s.Elapsed <= 0 {
+		t.Errorf("/new content type %q, elapsed %s", s.ContentType, s.Elapsed)
+	}
+	if !statuses[ext.URL+"/gone"].External || statuses[srv.URL+"/about"].External {
+		t.Error("only links off the site should be external")
+	}
+
+	var broken []string
+	for _, bp := range c.Report.Broken() {
+		for _, l := range bp.Links {
+			broken = append(broken, strings.TrimPrefix(bp.Page, srv.URL)+" "+l.URL)
+		}
+	}
+	wantBroken := []string{
+		" " + srv.URL + "/missing",
+		" " + ext.URL + "/gone",
+		"/about " + srv.URL + "/broken",
+		"/about " + srv.URL + "/missing",
+	}
+	sort.Strings(broken)
+	sort.Strings(wantBroken)
+	if !reflect.DeepEqual(broken, wantBroken) {
+		t.Errorf("broken links = %q, want %q", broken, wantBroken)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SitemapDiff is how one sitemap differs from another.
+type SitemapDiff struct {
+	Added   []Page
+	Removed []Page
+	Changed []PageChange
+}
+
+// PageChange is a page listed in both sitemaps with
+// different details.
+type PageChange struct {
+	Old, New Page
+}
+
+// diffSitemaps compares the pages of two sitemaps by URL.
+func diffSitemaps(old, cur []Page) SitemapDiff {
+	oldURLs, oldPages := indexPages(old)
+	curURLs, curPages := indexPages(cur)
+
+	var d SitemapDiff
+	added, removed := diffURLs(oldURLs, curURLs)
+	for _, u := range added {
+		d.Added = append(d.Added, curPages[u])
+	}
+	for _, u := range removed {
+		d.Removed = append(d.Removed, oldPages[u])
+	}
+	for _, u := range curURLs {
+		o, ok := oldPages[u]
+		if !ok {
+			continue
+		}
+		if n := curPages[u]; len(pageChanges(o, n)) > 0 {
+			d.Changed = append(d.Changed, PageChange{o, n})
+		}
+	}
+	return d
+}
+
+// indexPages lists the URLs of pages in order and maps
+// them to their pages. A URL listed twice keeps its first.
+func indexPages(pages []Page) ([]string, map[string]Page) {
+	var urls []string
+	byURL := make(map[string]Page)
+	for _, p := range pages {
+		if _, ok := byURL[p.URL]; ok {
+			continue
+		}
+		urls = append(urls, p.URL)
+		byURL[p.URL] = p
+	}
+	return urls, byURL
+}
+
+// pageChanges describes how the details of a page differ.
+func pageChanges(o, n Page) []string {
+	var changes []string
+	field := func(name, a, b string) {
+		if a != b {
+			changes = append(changes, fmt.Sprintf("%s %s -> %s", name, orNone(a), orNone(b)))
+		}
+	}
+	field("lastmod", o.LastMod, n.LastMod)
+	field("changefreq", o.ChangeFreq, n.ChangeFreq)
+	field("priority", o.Priority, n.Priority)
+	if len(o.Images) != len(n.Images) {
+		changes = append(changes, fmt.Sprintf("images %d -> %d", len(o.Images), len(n.Images)))
+	}
+	if len(o.Alternates) != len(n.Alternates) {
+		changes = append(changes, fmt.Sprintf("alternates %d -> %d", len(o.Alternates), len(n.Alternates)))
+	}
+	return changes
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+// Empty reports whether the sitemaps were the same.
+func (d SitemapDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Write prints the diff to w, a line per page.
+func (d SitemapDiff) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+	ew.printf("%d added, %d removed, %d changed\n", len(d.Added), len(d.Removed), len(d.Changed))
+	for _, p := range d.Added {
+		ew.printf("+ %s\n", p.URL)
+	}
+	for _, p := range d.Removed {
+		ew.printf("- %s\n", p.URL)
+	}
+	for _, c := range d.Changed {
+		ew.printf("~ %s (%s)\n", c.New.URL, strings.Join(pageChanges(c.Old, c.New), ", "))
+	}
+	return ew.err
+}
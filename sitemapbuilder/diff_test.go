@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_diffSitemaps(t *testing.T) {
+	old := []Page{
+		{URL: "https://example.com/", LastMod: "2020-01-01T00:00:00Z", Priority: "1.0"},
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/b", ChangeFreq: "weekly"},
+	}
+	cur := []Page{
+		{URL: "https://example.com/", LastMod: "2020-02-01T00:00:00Z", Priority: "1.0"},
+		{URL: "https://example.com/b", ChangeFreq: "weekly"},
+		{URL: "https://example.com/c", Images: []Image{{"https://example.com/c.png"}}},
+		{URL: "https://example.com/b"}, // repeated, ignored
+	}
+
+	d := diffSitemaps(old, cur)
+	var out bytes.Buffer
+	if err := d.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := `1 added, 1 removed, 1 changed
++ https://example.com/c
+- https://example.com/a
+~ https://example.com/ (lastmod 2020-01-01T00:00:00Z -> 2020-02-01T00:00:00Z)
+`
+	if out.String() != want {
+		t.Errorf("diff =\n%s\nwant\n%s", out.String(), want)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true for different sitemaps")
+	}
+	if d := diffSitemaps(old, old); !d.Empty() {
+		t.Errorf("a sitemap differs from itself: %+v", d)
+	}
+}
+
+func Test_pageChanges(t *testing.T) {
+	o := Page{ChangeFreq: "daily", Alternates: []Alternate{{}}}
+	n := Page{Priority: "0.5", Images: []Image{{}}}
+	got := pageChanges(o, n)
+	want := []string{"changefreq daily -> (none)", "priority (none) -> 0.5", "images 0 -> 1", "alternates 1 -> 0"}
+	if len(got) != len(want) {
+		t.Fatalf("pageChanges() = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("pageChanges()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits on the size of one sitemap file, from the sitemap protocol.
+const (
+	maxSitemapURLs  = 50000
+	maxSitemapBytes = 50 * 1024 * 1024 // uncompressed
+)
+
+// SitemapIndex lists the sitemap files of a site that
+// needs more than one.
+type SitemapIndex struct {
+	XMLName   xml.Name     `xml:"sitemapindex"`
+	Namespace string       `xml:"xmlns,attr"`
+	Sitemaps  []SitemapRef `xml:"sitemap"`
+}
+
+// SitemapRef is one sitemap file in a SitemapIndex.
+type SitemapRef struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapWriter writes sitemap files to a directory.
+type sitemapWriter struct {
+	Dir      string // directory the files are written to
+	BaseURL  string // URL the directory is served from
+	Gzip     bool   // write .xml.gz files
+	MaxURLs  int
+	MaxBytes int
+}
+
+// newSitemapWriter creates a sitemap writer with the
+// protocol's size limits.
+func newSitemapWriter(dir, baseURL string, gz bool) *sitemapWriter {
+	return &sitemapWriter{dir, baseURL, gz, maxSitemapURLs, maxSitemapBytes}
+}
+
+// write writes pages to sitemap.xml, or sitemap.xml.gz. When the
+// pages don't fit in one sitemap they're split across numbered
+// sitemaps listed in a sitemap.xml index. The names of the files
+// written are returned.
+func (sw *sitemapWriter) write(pages []Page) ([]string, error) {
+	if err := os.MkdirAll(sw.Dir, 0755); err != nil {
+		return nil, err
+	}
+	chunks, err := sw.split(pages)
+	if err != nil {
+		return nil, err
+	}
+	ext := ".xml"
+	if sw.Gzip {
+		ext += ".gz"
+	}
+
+	if len(chunks) == 1 {
+		name := "sitemap" + ext
+		return []string{name}, sw.writeFile(name, func(w io.Writer) error {
+			return encodeURLSet(w, chunks[0])
+		})
+	}
+
+	if len(chunks) > maxSitemapURLs {
+		return nil, fmt.Errorf("%d sitemaps are too many for one index", len(chunks))
+	}
+	index := SitemapIndex{Namespace: sitemapNS}
+	var names []string
+	for i, chunk := range chunks {
+		name := fmt.Sprintf("sitemap-%d%s", i+1, ext)
+		err := sw.writeFile(name, func(w io.Writer) error {
+			return encodeURLSet(w, chunk)
+		})
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		index.Sitemaps = append(index.Sitemaps, SitemapRef{
+			Loc:     strings.TrimSuffix(sw.BaseURL, "/") + "/" + name,
+			LastMod: latestLastMod(chunk),
+		})
+	}
+
+	err = sw.writeFile("sitemap.xml", func(w io.Writer) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		enc := xml.NewEncoder(w)
+		enc.Indent("  ", "    ")
+		if err := enc.Encode(index); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	})
+	return append([]string{"sitemap.xml"}, names...), err
+}
+
+// split breaks pages into chunks that each fit in one sitemap.
+func (sw *sitemapWriter) split(pages []Page) ([][]Page, error) {
+	// measure the empty sitemap, then each url element as it's
+	// indented inside one
+	var empty bytes.Buffer
+	if err := encodeURLSet(&empty, nil); err != nil {
+		return nil, err
+	}
+	overhead := empty.Len() + 1024 // room for namespace declarations
+
+	var chunks [][]Page
+	var cur []Page
+	size := overhead
+	for _, p := range pages {
+		b, err := xml.MarshalIndent(p, "      ", "    ")
+		if err != nil {
+			return nil, err
+		}
+		n := len(b) + 1 // and a newline
+		if overhead+n > sw.MaxBytes {
+			return nil, fmt.Errorf("the entry for %s is too big for a sitemap", p.URL)
+		}
+		if len(cur) > 0 && (len(cur) >= sw.MaxURLs || size+n > sw.MaxBytes) {
+			chunks = append(chunks, cur)
+			cur, size = nil, overhead
+		}
+		cur = append(cur, p)
+		size += n
+	}
+	return append(chunks, cur), nil
+}
+
+// writeFile writes a file in the output directory through fn,
+// gzipping it if it's named .gz. The file is written to a
+// temporary name first so a failed write leaves nothing behind.
+func (sw *sitemapWriter) writeFile(name string, fn func(io.Writer) error) error {
+	f, err := ioutil.TempFile(sw.Dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if strings.HasSuffix(name, ".gz") {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	if err := fn(w); err != nil {
+		return err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), filepath.Join(sw.Dir, name))
+}
+
+// latestLastMod returns the latest lastmod of pages.
+func latestLastMod(pages []Page) string {
+	latest := ""
+	for _, p := range pages {
+		// RFC 3339 dates in UTC sort as strings
+		if p.LastMod > latest {
+			latest = p.LastMod
+		}
+	}
+	return latest
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testPages makes n pages with lastmods a day apart.
+func testPages(n int) []Page {
+	var pages []Page
+	for i := 0; i < n; i++ {
+		pages = append(pages, Page{
+			URL:     fmt.Sprintf("https://example.com/page/%03d", i),
+			LastMod: fmt.Sprintf("2020-01-%02dT00:00:00Z", i%28+1),
+		})
+	}
+	return pages
+}
+
+func tempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "sitemap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSitemapWriter_single(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	pages := testPages(3)
+	pages[0].Images = []Image{{"https://example.com/a.png"}}
+	names, err := newSitemapWriter(dir, "https://example.com/", false).write(pages)
+	if err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	if want := []string{"sitemap.xml"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("wrote %v, want %v", names, want)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := buildXML(pages)
+	if string(b) != want {
+		t.Errorf("sitemap.xml =\n%s\nwant\n%s", b, want)
+	}
+	for _, s := range []string{`xmlns:image="` + imageNS + `"`, "<image:loc>https://example.com/a.png</image:loc>"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("sitemap.xml is missing %s", s)
+		}
+	}
+}
+
+func TestSitemapWriter_split(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	sw := newSitemapWriter(dir, "https://example.com/maps", true)
+	sw.MaxURLs = 4
+	names, err := sw.write(testPages(10))
+	if err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+	want := []string{"sitemap.xml", "sitemap-1.xml.gz", "sitemap-2.xml.gz", "sitemap-3.xml.gz"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("wrote %v, want %v", names, want)
+	}
+
+	// The index lists each part with its latest lastmod.
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var index SitemapIndex
+	if err := xml.Unmarshal(b, &index); err != nil {
+		t.Fatalf("reading index: %v", err)
+	}
+	wantRefs := []SitemapRef{
+		{"https://example.com/maps/sitemap-1.xml.gz", "2020-01-04T00:00:00Z"},
+		{"https://example.com/maps/sitemap-2.xml.gz", "2020-01-08T00:00:00Z"},
+		{"https://example.com/maps/sitemap-3.xml.gz", "2020-01-10T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(index.Sitemaps, wantRefs) {
+		t.Errorf("index = %v, want %v", index.Sitemaps, wantRefs)
+	}
+
+	// Each part is a gzipped sitemap of its share of the pages.
+	var urls int
+	for _, name := range names[1:] {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		b, err := ioutil.ReadAll(zr)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		urls += strings.Count(string(b), "<url>")
+	}
+	if urls != 10 {
+		t.Errorf("parts have %d urls, want 10", urls)
+	}
+
+	// No temporary files are left behind.
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != len(names) {
+		t.Errorf("%d files in the output dir, want %d", len(files), len(names))
+	}
+}
+
+func TestSitemapWriter_splitBytes(t *testing.T) {
+	sw := newSitemapWriter("", "", false)
+	pages := testPages(20)
+
+	// Each sitemap stays under the byte limit.
+	var one strings.Builder
+	encodeURLSet(&one, pages[:1])
+	sw.MaxBytes = one.Len() + 1024 + 300
+	chunks, err := sw.split(pages)
+	if err != nil {
+		t.Fatalf("split() error = %v", err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("split() made %d chunks, want several", len(chunks))
+	}
+	n := 0
+	for _, c := range chunks {
+		var b strings.Builder
+		encodeURLSet(&b, c)
+		if b.Len() > sw.MaxBytes {
+			t.Errorf("chunk of %d pages is %d bytes, over %d", len(c), b.Len(), sw.MaxBytes)
+		}
+		n += len(c)
+	}
+	if n != len(pages) {
+		t.Errorf("chunks hold %d pages, want %d", n, len(pages))
+	}
+
+	// A page too big for any sitemap is an error.
+	sw.MaxBytes = 1100
+	if _, err := sw.split(pages); err == nil {
+		t.Error("split() should fail when a page doesn't fit")
+	}
+}
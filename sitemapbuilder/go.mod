@@ -2,4 +2,7 @@ module github.com/kristakoch/gophercises/sitemapbuilder
 
 go 1.13
 
-require golang.org/x/net v0.0.0-20200602114024-627f9648deb9
+require (
+	github.com/boltdb/bolt v1.3.1
+	golang.org/x/net v0.0.0-20200602114024-627f9648deb9
+)
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LinkGraph records which crawled page links to which. Only
+// the crawl's coordinator adds to it, so it needs no locking.
+// Its methods can be called on a nil LinkGraph, which records
+// nothing.
+type LinkGraph struct {
+	root    string
+	links   map[string][]string // crawled page to the site pages it links to
+	orphans []string            // sitemap pages no crawled page links to
+}
+
+// NewLinkGraph creates an empty graph.
+func NewLinkGraph() *LinkGraph {
+	return &LinkGraph{links: make(map[string][]string)}
+}
+
+// addPage records a crawled page and the pages it links to.
+func (g *LinkGraph) addPage(u string, depth int, links []string) {
+	if g == nil {
+		return
+	}
+	if depth == 0 {
+		g.root = u
+	}
+	g.links[u] = links
+}
+
+// GraphNode is a page in the graph.
+type GraphNode struct {
+	URL      string `json:"url"`
+	Depth    int    `json:"depth"` // clicks from the root, -1 if it can't be reached
+	Inbound  int    `json:"inbound"`
+	Outbound int    `json:"outbound"`
+	Orphan   bool   `json:"orphan,omitempty"`
+}
+
+// GraphEdge is a link from one page to another.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// graphData is the graph as it's exported.
+type graphData struct {
+	Root  string      `json:"root"`
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// AddOrphans adds the pages of a sitemap that no crawled page
+// links to, other than the root, and returns their URLs.
+func (g *LinkGraph) AddOrphans(sitemap []Page) []string {
+	linked := map[string]empty{g.root: {}}
+	for _, links := range g.links {
+		for _, l := range links {
+			linked[l] = empty{}
+		}
+	}
+	var orphans []string
+	for _, p := range sitemap {
+		u := p.URL
+		if pu, err := url.Parse(u); err == nil {
+			u = NormalizeURL(pu).String()
+		}
+		clean(&u)
+		if _, ok := linked[u]; !ok {
+			linked[u] = empty{} // once is enough
+			orphans = append(orphans, u)
+		}
+	}
+	g.orphans = append(g.orphans, orphans...)
+	return orphans
+}
+
+// data works out the nodes and edges of the graph. Links to
+// pages that weren't crawled are left out, and click depths
+// are the shortest paths from the root.
+func (g *LinkGraph) data() graphData {
+	d := graphData{Root: g.root}
+	nodes := make(map[string]*GraphNode)
+	for u := range g.links {
+		nodes[u] = &GraphNode{URL: u, Depth: -1}
+	}
+	for _, u := range g.orphans {
+		if nodes[u] == nil {
+			nodes[u] = &GraphNode{URL: u, Depth: -1}
+		}
+		nodes[u].Orphan = true
+	}
+	for from, links := range g.links {
+		for _, to := range links {
+			if n := nodes[to]; n != nil && to != from {
+				d.Edges = append(d.Edges, GraphEdge{from, to})
+				nodes[from].Outbound++
+				n.Inbound++
+			}
+		}
+	}
+
+	if root := nodes[g.root]; root != nil {
+		root.Depth = 0
+		for queue := []string{g.root}; len(queue) > 0; queue = queue[1:] {
+			cur := nodes[queue[0]]
+			for _, l := range g.links[cur.URL] {
+				if n := nodes[l]; n != nil && n.Depth < 0 {
+					n.Depth = cur.Depth + 1
+					queue = append(queue, l)
+				}
+			}
+		}
+	}
+	for _, n := range nodes {
+		d.Nodes = append(d.Nodes, *n)
+	}
+	sort.Slice(d.Nodes, func(i, j int) bool { return d.Nodes[i].URL < d.Nodes[j].URL })
+	sort.Slice(d.Edges, func(i, j int) bool {
+		a, b := d.Edges[i], d.Edges[j]
+		return a.From < b.From || (a.From == b.From && a.To < b.To)
+	})
+	return d
+}
+
+// GraphFormat guesses the export format from a file name,
+// going by its extension.
+func GraphFormat(file string) string {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".dot", ".gv":
+		return "dot"
+	case ".graphml", ".xml":
+		return "graphml"
+	default:
+		return "json"
+	}
+}
+
+// Write writes the graph to w as dot, graphml or json.
+func (g *LinkGraph) Write(w io.Writer, format string) error {
+	d := g.data()
+	switch format {
+	case "dot":
+		return writeDOT(w, d)
+	case "graphml":
+		return writeGraphML(w, d)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	default:
+		return fmt.Errorf("unknown graph format %q, want dot, graphml or json", format)
+	}
+}
+
+func writeDOT(w io.Writer, d graphData) error {
+	ew := &errWriter{w: w}
+	ew.printf("digraph site {\n")
+	ew.printf("  node [shape=box];\n")
+	for _, n := range d.Nodes {
+		label := n.URL
+		if u, err := url.Parse(n.URL); err == nil && u.RequestURI() != "" {
+			label = u.RequestURI()
+		}
+		ew.printf("  %s [label=%s, depth=%d, inbound=%d, outbound=%d", strconv.Quote(n.URL), strconv.Quote(label), n.Depth, n.Inbound, n.Outbound)
+		switch {
+		case n.Orphan:
+			ew.printf(", color=red")
+		case n.URL == d.Root:
+			ew.printf(", style=bold")
+		}
+		ew.printf("];\n")
+	}
+	for _, e := range d.Edges {
+		ew.printf("  %s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+	}
+	ew.printf("}\n")
+	return ew.err
+}
+
+// GraphML documents, as far as the graph needs them.
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	NS      string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string `xml:"source,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func writeGraphML(w io.Writer, d graphData) error {
+	doc := graphML{NS: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Keys = []graphMLKey{
+		{"url", "node", "url", "string"},
+		{"depth", "node", "depth", "int"},
+		{"inbound", "node", "inbound", "int"},
+		{"outbound", "node", "outbound", "int"},
+		{"orphan", "node", "orphan", "boolean"},
+	}
+	doc.Graph.ID = "site"
+	doc.Graph.EdgeDefault = "directed"
+	ids := make(map[string]string)
+	for i, n := range d.Nodes {
+		id := fmt.Sprintf("n%d", i)
+		ids[n.URL] = id
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{id, []graphMLData{
+			{"url", n.URL},
+			{"depth", strconv.Itoa(n.Depth)},
+			{"inbound", strconv.Itoa(n.Inbound)},
+			{"outbound", strconv.Itoa(n.Outbound)},
+			{"orphan", strconv.FormatBool(n.Orphan)},
+		}})
+	}
+	for _, e := range d.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{ids[e.From], ids[e.To]})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
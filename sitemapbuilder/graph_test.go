@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testGraph() *LinkGraph {
+	g := NewLinkGraph()
+	g.addPage("https://e.com", 0, []string{"https://e.com/a", "https://e.com/b"})
+	g.addPage("https://e.com/a", 1, []string{"https://e.com", "https://e.com/a", "https://e.com/c"})
+	g.addPage("https://e.com/b", 1, []string{"https://e.com/c", "https://e.com/missing"})
+	g.addPage("https://e.com/c", 2, nil)
+	return g
+}
+
+func TestLinkGraph_data(t *testing.T) {
+	g := testGraph()
+	orphans := g.AddOrphans([]Page{{URL: "https://E.com/"}, {URL: "https://e.com/c"}, {URL: "https://e.com/lost/"}, {URL: "https://e.com/lost"}})
+	if want := []string{"https://e.com/lost"}; !reflect.DeepEqual(orphans, want) {
+		t.Errorf("AddOrphans() = %v, want %v", orphans, want)
+	}
+
+	d := g.data()
+	wantNodes := []GraphNode{
+		{URL: "https://e.com", Depth: 0, Inbound: 1, Outbound: 2},
+		{URL: "https://e.com/a", Depth: 1, Inbound: 1, Outbound: 2},
+		{URL: "https://e.com/b", Depth: 1, Inbound: 1, Outbound: 1},
+		{URL: "https://e.com/c", Depth: 2, Inbound: 2, Outbound: 0},
+		{URL: "https://e.com/lost", Depth: -1, Orphan: true},
+	}
+	if !reflect.DeepEqual(d.Nodes, wantNodes) {
+		t.Errorf("nodes =\n%+v\nwant\n%+v", d.Nodes, wantNodes)
+	}
+	wantEdges := []GraphEdge{
+		{"https://e.com", "https://e.com/a"},
+		{"https://e.com", "https://e.com/b"},
+		{"https://e.com/a", "https://e.com"},
+		{"https://e.com/a", "https://e.com/c"},
+		{"https://e.com/b", "https://e.com/c"},
+	}
+	if !reflect.DeepEqual(d.Edges, wantEdges) {
+		t.Errorf("edges =\n%v\nwant\n%v", d.Edges, wantEdges)
+	}
+}
+
+func TestLinkGraph_Write(t *testing.T) {
+	g := testGraph()
+	g.AddOrphans([]Page{{URL: "https://e.com/lost"}})
+
+	var dot bytes.Buffer
+	if err := g.Write(&dot, "dot"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"digraph site {\n",
+		`"https://e.com/c" [label="/c", depth=2, inbound=2, outbound=0];`,
+		`"https://e.com/lost" [label="/lost", depth=-1, inbound=0, outbound=0, color=red];`,
+		`"https://e.com/b" -> "https://e.com/c";`,
+	} {
+		if !strings.Contains(dot.String(), s) {
+			t.Errorf("dot output is missing %s:\n%s", s, dot.String())
+		}
+	}
+
+	var gml bytes.Buffer
+	if err := g.Write(&gml, "graphml"); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal(gml.Bytes(), &doc); err != nil {
+		t.Fatalf("reading graphml: %v", err)
+	}
+	if len(doc.Keys) != 5 || len(doc.Graph.Nodes) != 5 || len(doc.Graph.Edges) != 5 {
+		t.Errorf("graphml has %d keys, %d nodes, %d edges", len(doc.Keys), len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	if e := doc.Graph.Edges[0]; e.Source != "n0" || e.Target != "n1" {
+		t.Errorf("first graphml edge = %+v", e)
+	}
+
+	var js bytes.Buffer
+	if err := g.Write(&js, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var d graphData
+	if err := json.Unmarshal(js.Bytes(), &d); err != nil {
+		t.Fatalf("reading json: %v", err)
+	}
+	if !reflect.DeepEqual(d, g.data()) {
+		t.Errorf("json graph = %+v", d)
+	}
+
+	if err := g.Write(&js, "svg"); err == nil {
+		t.Error("Write(svg) should fail")
+	}
+}
+
+func TestGraphFormat(t *testing.T) {
+	for file, want := range map[string]string{"site.dot": "dot", "a/b.GV": "dot", "g.graphml": "graphml", "g.json": "json", "g": "json"} {
+		if got := GraphFormat(file); got != want {
+			t.Errorf("GraphFormat(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
+
+func TestCrawler_CrawlGraph(t *testing.T) {
+	site := newTestSite(6)
+	srv := httptest.NewServer(site)
+	defer srv.Close()
+
+	c := testCrawler()
+	c.Graph = NewLinkGraph()
+	if _, err := c.Crawl(context.Background(), srv.URL); err != nil {
+		t.Fatal(err)
+	}
+	d := c.Graph.data()
+	if d.Root != srv.URL || len(d.Nodes) != 7 {
+		t.Fatalf("graph root %s with %d nodes, want %s with 7", d.Root, len(d.Nodes), srv.URL)
+	}
+	for _, n := range d.Nodes {
+		// every page links home, and the root links to /page/1
+		if n.URL == srv.URL && (n.Inbound != 6 || n.Outbound != 1) {
+			t.Errorf("root has %d inbound and %d outbound links, want 6 and 1", n.Inbound, n.Outbound)
+		}
+		if n.URL == srv.URL+"/page/5" && (n.Depth != 3 || n.Inbound != 1 || n.Outbound != 1) {
+			t.Errorf("/page/5 = %+v", n)
+		}
+	}
+}
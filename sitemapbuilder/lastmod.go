@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// lastModMeta are the meta tag names, properties and itemprops
+// that say when a page last changed.
+var lastModMeta = map[string]bool{
+	"last-modified":         true,
+	"article:modified_time": true,
+	"og:updated_time":       true,
+	"datemodified":          true,
+	"dcterms.modified":      true,
+	"revised":               true,
+	"date.modified":         true,
+}
+
+// timeLayouts are the date formats found in headers and meta tags.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+	http.TimeFormat,
+	time.RFC850,
+	time.ANSIC,
+}
+
+// parseTime parses a date in any of timeLayouts.
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// lastModified reads the Last-Modified header.
+func lastModified(h http.Header) time.Time {
+	t, _ := parseTime(h.Get("Last-Modified"))
+	return t
+}
+
+// headMeta is what a page's <head> says about it.
+type headMeta struct {
+	modified  time.Time // when it last changed
+	noindex   bool      // robots meta tag says noindex
+	canonical string    // href of its rel=canonical link
+}
+
+// scanLastMod reads the <head> of a page for a meta tag saying
+// when it last changed.
+func scanLastMod(r io.Reader) time.Time {
+	return scanHead(r).modified
+}
+
+// scanHead reads the meta and link tags in the <head> of a page.
+// It stops reading at the end of the head.
+func scanHead(r io.Reader) headMeta {
+	var hm headMeta
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return hm
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				return hm
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := atom.Lookup(name)
+			switch tag {
+			case atom.Body:
+				return hm
+			case atom.Meta, atom.Link:
+			default:
+				continue
+			}
+			var key, content, rel, href string
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				switch string(k) {
+				case "name", "property", "itemprop", "http-equiv":
+					key = strings.ToLower(string(v))
+				case "content":
+					content = string(v)
+				case "rel":
+					rel = string(v)
+				case "href":
+					href = string(v)
+				}
+			}
+
+			switch {
+			case tag == atom.Link:
+				if hasToken(rel, "canonical") && hm.canonical == "" {
+					hm.canonical = strings.TrimSpace(href)
+				}
+			case key == "robots":
+				if hasToken(strings.Replace(content, ",", " ", -1), "noindex") {
+					hm.noindex = true
+				}
+			case lastModMeta[key] && hm.modified.IsZero():
+				if t, ok := parseTime(content); ok {
+					hm.modified = t
+				}
+			}
+		}
+	}
+}
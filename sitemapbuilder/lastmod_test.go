@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_scanLastMod(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want time.Time
+	}{
+		{"none", `<head><title>x</title></head><body></body>`, time.Time{}},
+		{"article", `<head><meta property="article:modified_time" content="2020-05-06T07:08:09+02:00"></head>`,
+			time.Date(2020, 5, 6, 5, 8, 9, 0, time.UTC)},
+		{"http-equiv", `<meta http-equiv="Last-Modified" content="Tue, 15 Nov 1994 12:45:26 GMT">`,
+			time.Date(1994, 11, 15, 12, 45, 26, 0, time.UTC)},
+		{"itemprop date", `<head><meta itemprop="dateModified" content="2019-12-31"></head>`,
+			time.Date(2019, 12, 31, 0, 0, 0, 0, time.UTC)},
+		{"bad date skipped", `<meta name="last-modified" content="yesterday"><meta property="og:updated_time" content="2018-01-01T00:00:00">`,
+			time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"body ignored", `<head></head><body><meta name="last-modified" content="2019-12-31"></body>`, time.Time{}},
+		{"other meta", `<meta name="description" content="2019-12-31">`, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := scanLastMod(strings.NewReader(tt.doc)); !got.Equal(tt.want) {
+				t.Errorf("scanLastMod() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lastModified(t *testing.T) {
+	h := http.Header{}
+	if got := lastModified(h); !got.IsZero() {
+		t.Errorf("lastModified() with no header = %v, want zero", got)
+	}
+	h.Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+	if got, want := lastModified(h), time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("lastModified() = %v, want %v", got, want)
+	}
+}
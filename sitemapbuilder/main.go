@@ -1,21 +1,178 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "diff":
+			os.Exit(diffCmd(os.Args[2:]))
+		case "verify":
+			os.Exit(verifyCmd(os.Args[2:]))
+		}
+	}
+
+	c := NewCrawler()
 	rootURL := flag.String("root", "https://www.calhoun.io/", "root URL to create sitemap from")
+	flag.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "number of pages to fetch at once")
+	flag.DurationVar(&c.RateLimit, "rate", c.RateLimit, "minimum time between requests to the same host, e.g. 200ms")
+	flag.DurationVar(&c.Timeout, "timeout", c.Timeout, "time limit for each request")
+	flag.IntVar(&c.Retries, "retries", c.Retries, "times to retry a request that fails")
+	flag.DurationVar(&c.Backoff, "backoff", c.Backoff, "wait before the first retry, doubled after each")
+	flag.IntVar(&c.MaxDepth, "depth", c.MaxDepth, "clicks from the root to follow, 0 for no limit")
+	flag.IntVar(&c.MaxPages, "max-pages", c.MaxPages, "pages to crawl, 0 for no limit")
+	flag.Var(&c.Include, "include", "only follow paths matching this glob, or regexp with a re: prefix (repeatable)")
+	flag.Var(&c.Exclude, "exclude", "don't follow paths matching this glob, or regexp with a re: prefix (repeatable)")
+	query := flag.String("query", "drop", "query strings: drop, keep, or a comma separated list of params to keep")
+	flag.StringVar(&c.UserAgent, "user-agent", c.UserAgent, "user agent to send and to match in robots.txt")
+	flag.BoolVar(&c.Robots, "robots", c.Robots, "follow robots.txt")
+	flag.BoolVar(&c.Images, "images", false, "list the images on each page")
+	flag.BoolVar(&c.Hreflang, "hreflang", false, "list each page's alternate language versions")
+	rulesFile := flag.String("rules", "", "JSON file of changefreq and priority rules by path pattern")
+	outDir := flag.String("out", "", "directory to write sitemap files to, split and indexed as needed (default print)")
+	gz := flag.Bool("gzip", false, "gzip the sitemap files written to -out")
+	sitemapURL := flag.String("sitemap-url", "", "URL the -out directory is served from, for the index (default the root)")
+	cacheFile := flag.String("cache", "", "file to keep a crawl cache in, so unchanged pages aren't downloaded again")
+	graphFile := flag.String("graph", "", "file to write the link graph to, as .dot, .graphml or .json")
+	orphans := flag.String("orphans", "", "sitemap whose pages no crawled page links to are marked orphans in the -graph")
+	report := flag.String("report", "", "print a broken link and redirect report as text, json or html instead of the sitemap")
 	flag.Parse()
+	c.Query = ParseQueryPolicy(*query)
+	switch *report {
+	case "":
+	case "text", "json", "html":
+		c.Report = NewReport()
+	default:
+		log.Fatalf("unknown report format %q, want text, json or html", *report)
+	}
+
+	var rules []FreqRule
+	if *rulesFile != "" {
+		var err error
+		if rules, err = loadRules(*rulesFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *cacheFile != "" {
+		var err error
+		if c.Cache, err = OpenCache(*cacheFile); err != nil {
+			log.Fatalf("opening cache: %s", err)
+		}
+		defer c.Cache.Close()
+	}
+
+	if *graphFile != "" {
+		c.Graph = NewLinkGraph()
+	} else if *orphans != "" {
+		log.Fatal("-orphans needs -graph")
+	}
 
-	// Build a string of the sitemap of domain from a URL.
-	sMap, err := SiteMap(*rootURL)
+	// Stop crawling on interrupt.
+	ctx, cancel := interruptContext()
+	defer cancel()
+
+	// Crawl the site and work out what to say about each page.
+	sitePages, err := CrawlSite(ctx, c, *rootURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	annotate(sitePages, rules, time.Now())
+	if c.Graph != nil {
+		if err := writeGraph(ctx, c, *graphFile, *orphans); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if c.Cache != nil {
+		if err := diffLastRun(os.Stderr, c.Cache, sitePages); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	// Print the map.
-	fmt.Println(sMap)
+	// Print the report, or the map, or write the map out as files.
+	if c.Report != nil {
+		if err := c.Report.Write(os.Stdout, *report); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *outDir == "" {
+		if c.Report != nil {
+			return
+		}
+		sMap, err := buildXML(sitePages)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(sMap)
+		return
+	}
+	base := *sitemapURL
+	if base == "" {
+		base = *rootURL
+	}
+	names, err := newSitemapWriter(*outDir, base, *gz).write(sitePages)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "wrote", filepath.Join(*outDir, name))
+	}
+}
+
+// diffLastRun prints the URLs added to and removed from the
+// sitemap since the last run, and saves this run's.
+func diffLastRun(w io.Writer, cache *Cache, sitePages []Page) error {
+	old, err := cache.LastRun()
+	if err != nil {
+		return err
+	}
+	var cur []string
+	for _, p := range sitePages {
+		cur = append(cur, p.URL)
+	}
+	added, removed := diffURLs(old, cur)
+	fmt.Fprintf(w, "%d URLs added, %d removed since the last run\n", len(added), len(removed))
+	for _, u := range added {
+		fmt.Fprintln(w, "+", u)
+	}
+	for _, u := range removed {
+		fmt.Fprintln(w, "-", u)
+	}
+	return cache.SaveRun(cur)
+}
+
+// writeGraph writes the crawl's link graph to file, first
+// marking the pages of the orphans sitemap, if given, that no
+// crawled page links to.
+func writeGraph(ctx context.Context, c *Crawler, file, orphans string) error {
+	if orphans != "" {
+		pages, err := loadSitemap(ctx, c, orphans)
+		if err != nil {
+			return err
+		}
+		found := c.Graph.AddOrphans(pages)
+		fmt.Fprintf(os.Stderr, "%d orphan pages\n", len(found))
+		for _, u := range found {
+			fmt.Fprintln(os.Stderr, " ", u)
+		}
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := c.Graph.Write(f, GraphFormat(file)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+// changeFreqs are the changefreq values the sitemap protocol allows.
+var changeFreqs = map[string]bool{
+	"always": true, "hourly": true, "daily": true, "weekly": true,
+	"monthly": true, "yearly": true, "never": true,
+}
+
+// FreqRule sets the changefreq and priority of the pages whose
+// path matches Pattern, overriding the heuristics. Pattern is
+// a glob, or a regexp with a re: prefix, as for -include.
+type FreqRule struct {
+	Pattern    string   `json:"pattern"`
+	ChangeFreq string   `json:"changefreq,omitempty"`
+	Priority   *float64 `json:"priority,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// loadRules reads a JSON list of FreqRules from a file.
+func loadRules(file string) ([]FreqRule, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var rules []FreqRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("reading rules from %s: %s", file, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if r.re, err = compilePattern(r.Pattern); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i, err)
+		}
+		if r.ChangeFreq != "" && !changeFreqs[r.ChangeFreq] {
+			return nil, fmt.Errorf("rule %d: unknown changefreq %q", i, r.ChangeFreq)
+		}
+		if r.Priority != nil && (*r.Priority < 0 || *r.Priority > 1) {
+			return nil, fmt.Errorf("rule %d: priority %v isn't between 0 and 1", i, *r.Priority)
+		}
+	}
+	return rules, nil
+}
+
+// annotate fills in each page's lastmod, changefreq and priority.
+// The first rule matching a page wins. Otherwise priority falls
+// with the page's depth, and changefreq follows how long ago the
+// page last changed, if that's known.
+func annotate(pages []Page, rules []FreqRule, now time.Time) {
+	for i := range pages {
+		p := &pages[i]
+		freq, prio := "", 1.0-0.2*float64(p.Depth)
+		if prio < 0.1 {
+			prio = 0.1
+		}
+		if !p.Modified.IsZero() {
+			p.LastMod = p.Modified.UTC().Format(time.RFC3339)
+			freq = changeFreqFor(now.Sub(p.Modified))
+		}
+
+		if u, err := url.Parse(p.URL); err == nil {
+			for _, r := range rules {
+				if !(patternList{r.re}).matches(u) {
+					continue
+				}
+				if r.ChangeFreq != "" {
+					freq = r.ChangeFreq
+				}
+				if r.Priority != nil {
+					prio = *r.Priority
+				}
+				break
+			}
+		}
+		p.ChangeFreq = freq
+		p.Priority = fmt.Sprintf("%.1f", prio)
+	}
+}
+
+// changeFreqFor guesses how often a page changes from
+// how long ago it last did.
+func changeFreqFor(age time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case age < day:
+		return "daily"
+	case age < 7*day:
+		return "weekly"
+	case age < 31*day:
+		return "monthly"
+	default:
+		return "yearly"
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_annotate(t *testing.T) {
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	pages := []Page{
+		{URL: "https://example.com/", Modified: now.Add(-time.Hour)},
+		{URL: "https://example.com/blog/", Depth: 1, Modified: now.Add(-3 * 24 * time.Hour)},
+		{URL: "https://example.com/blog/old", Depth: 2, Modified: time.Date(2019, 1, 1, 0, 0, 0, 0, time.FixedZone("x", 3600))},
+		{URL: "https://example.com/a/b/c/d/e/f", Depth: 6},
+		{URL: "https://example.com/legal/terms", Depth: 1, Modified: now.Add(-20 * 24 * time.Hour)},
+	}
+	low := 0.0
+	rules := []FreqRule{
+		{Pattern: "/legal/**", ChangeFreq: "never", Priority: &low},
+		{Pattern: "/legal/terms", ChangeFreq: "daily"}, // shadowed by the first
+		{Pattern: "re:^/a/", ChangeFreq: "monthly"},
+	}
+	for i := range rules {
+		rules[i].re, _ = compilePattern(rules[i].Pattern)
+	}
+	annotate(pages, rules, now)
+
+	want := []struct{ lastmod, freq, prio string }{
+		{"2020-06-01T11:00:00Z", "daily", "1.0"},
+		{"2020-05-29T12:00:00Z", "weekly", "0.8"},
+		{"2018-12-31T23:00:00Z", "yearly", "0.6"},
+		{"", "monthly", "0.1"},
+		{"2020-05-12T12:00:00Z", "never", "0.0"},
+	}
+	for i, p := range pages {
+		got := struct{ lastmod, freq, prio string }{p.LastMod, p.ChangeFreq, p.Priority}
+		if got != want[i] {
+			t.Errorf("%s: got %v, want %v", p.URL, got, want[i])
+		}
+	}
+}
+
+func Test_loadRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(s string) string {
+		f := filepath.Join(dir, "rules.json")
+		if err := ioutil.WriteFile(f, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	rules, err := loadRules(write(`[{"pattern": "/blog/**", "changefreq": "weekly", "priority": 0.7}]`))
+	if err != nil {
+		t.Fatalf("loadRules() error = %v", err)
+	}
+	if len(rules) != 1 || rules[0].ChangeFreq != "weekly" || *rules[0].Priority != 0.7 || rules[0].re == nil {
+		t.Errorf("loadRules() = %+v", rules)
+	}
+
+	for _, bad := range []string{
+		`{"pattern": "/"}`,
+		`[{"pattern": "/", "changefreq": "sometimes"}]`,
+		`[{"pattern": "/", "priority": 1.5}]`,
+		`[{"pattern": "re:("}]`,
+	} {
+		if _, err := loadRules(write(bad)); err == nil {
+			t.Errorf("loadRules(%s) should fail", bad)
+		}
+	}
+	if _, err := loadRules(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("loadRules() of a missing file should fail")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// UnmarshalXML decodes a <url> element. The image and xhtml
+// elements are matched by namespace, since the prefixes used
+// to write them can't be relied on when reading.
+func (p *Page) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		URL        string `xml:"loc"`
+		LastMod    string `xml:"lastmod"`
+		ChangeFreq string `xml:"changefreq"`
+		Priority   string `xml:"priority"`
+		Images     []struct {
+			Loc string `xml:"loc"`
+		} `xml:"http://www.google.com/schemas/sitemap-image/1.1 image"`
+		Alternates []Alternate `xml:"http://www.w3.org/1999/xhtml link"`
+	}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	*p = Page{
+		URL:        strings.TrimSpace(v.URL),
+		LastMod:    strings.TrimSpace(v.LastMod),
+		ChangeFreq: strings.TrimSpace(v.ChangeFreq),
+		Priority:   strings.TrimSpace(v.Priority),
+		Alternates: v.Alternates,
+	}
+	for _, img := range v.Images {
+		p.Images = append(p.Images, Image{Loc: strings.TrimSpace(img.Loc)})
+	}
+	return nil
+}
+
+// decodeSitemap reads a sitemap or sitemap index from r,
+// gunzipping it first if it's compressed. Exactly one of
+// the returned documents is set.
+func decodeSitemap(r io.Reader) (*XMLMap, *SitemapIndex, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	d := xml.NewDecoder(br)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil, nil, fmt.Errorf("no sitemap found")
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "urlset":
+			var m XMLMap
+			return &m, nil, d.DecodeElement(&m, &start)
+		case "sitemapindex":
+			var idx SitemapIndex
+			return nil, &idx, d.DecodeElement(&idx, &start)
+		default:
+			return nil, nil, fmt.Errorf("<%s> isn't a sitemap or sitemap index", start.Name.Local)
+		}
+	}
+}
+
+// loadSitemap reads the pages of the sitemap at loc, a file or
+// URL, and of every sitemap it lists if it's an index. The
+// sitemaps in an index on disk are read from beside it when
+// they're there, and fetched with c when they aren't.
+func loadSitemap(ctx context.Context, c *Crawler, loc string) ([]Page, error) {
+	m, idx, err := readSitemap(ctx, c, loc)
+	if err != nil {
+		return nil, err
+	}
+	if m != nil {
+		return m.Pages, nil
+	}
+
+	var pages []Page
+	for _, ref := range idx.Sitemaps {
+		child := ref.Loc
+		if !isURL(loc) {
+			local := filepath.Join(filepath.Dir(loc), path.Base(child))
+			if _, err := os.Stat(local); err == nil {
+				child = local
+			}
+		}
+		m, idx, err := readSitemap(ctx, c, child)
+		if err != nil {
+			return nil, err
+		}
+		if idx != nil {
+			return nil, fmt.Errorf("%s: sitemap indexes can't list other indexes", child)
+		}
+		pages = append(pages, m.Pages...)
+	}
+	return pages, nil
+}
+
+// readSitemap reads one sitemap or index from a file or URL.
+func readSitemap(ctx context.Context, c *Crawler, loc string) (*XMLMap, *SitemapIndex, error) {
+	var m *XMLMap
+	var idx *SitemapIndex
+	read := func(r io.Reader) error {
+		var err error
+		m, idx, err = decodeSitemap(r)
+		if err != nil {
+			return fmt.Errorf("reading %s: %s", loc, err)
+		}
+		return nil
+	}
+
+	if !isURL(loc) {
+		f, err := os.Open(loc)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		err = read(f)
+		return m, idx, err
+	}
+
+	if c.limiter == nil {
+		c.limiter = newHostLimiter(c.RateLimit)
+	}
+	err := c.get(ctx, fetch{method: http.MethodGet, url: loc}, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			io.Copy(ioutil.Discard, resp.Body)
+			return fmt.Errorf("fetching %s: %s", loc, resp.Status)
+		}
+		return read(resp.Body)
+	})
+	return m, idx, err
+}
+
+// isURL reports whether loc is an http URL rather than a file.
+func isURL(loc string) bool {
+	u, err := url.Parse(loc)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPage_UnmarshalXML(t *testing.T) {
+	pages := []Page{
+		{
+			URL:        "https://example.com/",
+			LastMod:    "2020-01-02T03:04:05Z",
+			ChangeFreq: "daily",
+			Priority:   "1.0",
+			Images:     []Image{{"https://example.com/a.png"}, {"https://example.com/b.png"}},
+			Alternates: []Alternate{{"alternate", "de", "https://example.com/de/"}},
+		},
+		{URL: "https://example.com/about"},
+	}
+	s, err := buildXML(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, idx, err := decodeSitemap(strings.NewReader(s))
+	if err != nil || idx != nil {
+		t.Fatalf("decodeSitemap() = %v, %v", idx, err)
+	}
+	if !reflect.DeepEqual(m.Pages, pages) {
+		t.Errorf("decoded\n%+v\nwant\n%+v", m.Pages, pages)
+	}
+
+	// Other prefixes for the same namespaces work too.
+	other := `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:img="http://www.google.com/schemas/sitemap-image/1.1">
+<url><loc> https://example.com/ </loc><img:image><img:loc>https://example.com/a.png</img:loc></img:image></url>
+</urlset>`
+	m, _, err = decodeSitemap(strings.NewReader(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Image{{"https://example.com/a.png"}}; len(m.Pages) != 1 || m.Pages[0].URL != "https://example.com/" || !reflect.DeepEqual(m.Pages[0].Images, want) {
+		t.Errorf("decoded %+v", m.Pages)
+	}
+
+	if _, _, err := decodeSitemap(strings.NewReader("<html></html>")); err == nil {
+		t.Error("decodeSitemap() of HTML should fail")
+	}
+}
+
+func Test_loadSitemap(t *testing.T) {
+	pages := testPages(10)
+
+	// A split, gzipped sitemap is read back from disk in full.
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	sw := newSitemapWriter(dir, "https://example.com/", true)
+	sw.MaxURLs = 3
+	if _, err := sw.write(pages); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadSitemap(context.Background(), testCrawler(), filepath.Join(dir, "sitemap.xml"))
+	if err != nil {
+		t.Fatalf("loadSitemap() error = %v", err)
+	}
+	if !reflect.DeepEqual(pageURLs(got), pageURLs(pages)) {
+		t.Errorf("loadSitemap() = %v, want %v", pageURLs(got), pageURLs(pages))
+	}
+
+	// And over HTTP, where the index points.
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer srv.Close()
+	os.RemoveAll(dir)
+	sw.Dir, sw.BaseURL = dir, srv.URL
+	if _, err := sw.write(pages); err != nil {
+		t.Fatal(err)
+	}
+	got, err = loadSitemap(context.Background(), testCrawler(), srv.URL+"/sitemap.xml")
+	if err != nil {
+		t.Fatalf("loadSitemap() error = %v", err)
+	}
+	if len(got) != len(pages) {
+		t.Errorf("loadSitemap() over HTTP found %d pages, want %d", len(got), len(pages))
+	}
+
+	if _, err := loadSitemap(context.Background(), testCrawler(), srv.URL+"/missing.xml"); err == nil {
+		t.Error("loadSitemap() of a missing sitemap should fail")
+	}
+	nested := filepath.Join(dir, "nested.xml")
+	ioutil.WriteFile(nested, []byte(fmt.Sprintf(`<sitemapindex><sitemap><loc>%s/sitemap.xml</loc></sitemap></sitemapindex>`, srv.URL)), 0644)
+	if _, err := loadSitemap(context.Background(), testCrawler(), nested); err == nil {
+		t.Error("loadSitemap() of an index listing an index should fail")
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// URLStatus is what fetching or checking one URL found.
+type URLStatus struct {
+	URL         string        `json:"url"`
+	Status      int           `json:"status,omitempty"` // of the final response
+	Redirects   []Redirect    `json:"redirects,omitempty"`
+	FinalURL    string        `json:"final_url,omitempty"` // where redirects ended up
+	Elapsed     time.Duration `json:"elapsed_ns"`
+	ContentType string        `json:"content_type,omitempty"`
+	External    bool          `json:"external,omitempty"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Redirect is one step in a redirect chain.
+type Redirect struct {
+	URL    string `json:"url"`
+	Status int    `json:"status"`
+}
+
+// Broken reports whether the URL couldn't be fetched
+// or came back with an error status.
+func (s *URLStatus) Broken() bool {
+	return s.Error != "" || s.Status >= 400
+}
+
+// fill records the outcome of one request for s.URL.
+func (s *URLStatus) fill(resp *http.Response, err error, elapsed time.Duration) {
+	*s = URLStatus{URL: s.URL, External: s.External, Elapsed: elapsed}
+	if err != nil {
+		s.Error = err.Error()
+		return
+	}
+	s.Status = resp.StatusCode
+	s.ContentType = resp.Header.Get("Content-Type")
+
+	// walk back through the responses that redirected here
+	for r := resp.Request; r.Response != nil; r = r.Response.Request {
+		s.Redirects = append([]Redirect{{r.Response.Request.URL.String(), r.Response.StatusCode}}, s.Redirects...)
+	}
+	if len(s.Redirects) > 0 {
+		s.FinalURL = resp.Request.URL.String()
+	}
+}
+
+// Report collects the status of every URL a crawl checks and
+// the pages linking to each. Its methods are safe to call from
+// several goroutines, and on a nil Report, which records nothing.
+type Report struct {
+	mu     sync.Mutex
+	urls   map[string]*URLStatus
+	linked map[string]map[string]empty // URL to the pages linking to it
+}
+
+// NewReport creates an empty report.
+func NewReport() *Report {
+	return &Report{
+		urls:   make(map[string]*URLStatus),
+		linked: make(map[string]map[string]empty),
+	}
+}
+
+// record saves the status of a URL.
+func (r *Report) record(s *URLStatus) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.urls[s.URL] = s
+}
+
+// linksFrom notes that page links to urls.
+func (r *Report) linksFrom(page string, urls []string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, u := range urls {
+		if r.linked[u] == nil {
+			r.linked[u] = make(map[string]empty)
+		}
+		r.linked[u][page] = empty{}
+	}
+}
+
+// URLs returns the status of every URL checked, sorted by URL.
+func (r *Report) URLs() []URLStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ret []URLStatus
+	for _, s := range r.urls {
+		ret = append(ret, *s)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].URL < ret[j].URL })
+	return ret
+}
+
+// BrokenPage is a page and the broken links on it.
+type BrokenPage struct {
+	Page  string      `json:"page"`
+	Links []URLStatus `json:"links"`
+}
+
+// Broken returns the pages linking to broken URLs, sorted,
+// each with its broken links.
+func (r *Report) Broken() []BrokenPage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byPage := make(map[string][]URLStatus)
+	for u, s := range r.urls {
+		if !s.Broken() {
+			continue
+		}
+		for page := range r.linked[u] {
+			byPage[page] = append(byPage[page], *s)
+		}
+	}
+
+	var ret []BrokenPage
+	for page, links := range byPage {
+		sort.Slice(links, func(i, j int) bool { return links[i].URL < links[j].URL })
+		ret = append(ret, BrokenPage{page, links})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Page < ret[j].Page })
+	return ret
+}
+
+// reportData is what the report formats are written from.
+type reportData struct {
+	Checked   int          `json:"checked"`
+	Redirects int          `json:"redirects"`
+	Broken    []BrokenPage `json:"broken"`
+	URLs      []URLStatus  `json:"urls"`
+}
+
+func (r *Report) data() reportData {
+	d := reportData{URLs: r.URLs(), Broken: r.Broken()}
+	d.Checked = len(d.URLs)
+	for _, s := range d.URLs {
+		if len(s.Redirects) > 0 {
+			d.Redirects++
+		}
+	}
+	if d.Broken == nil {
+		d.Broken = []BrokenPage{}
+	}
+	return d
+}
+
+// Write writes the report to w as text, json or html.
+func (r *Report) Write(w io.Writer, format string) error {
+	d := r.data()
+	switch format {
+	case "text":
+		return writeTextReport(w, d)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	case "html":
+		return reportTmpl.Execute(w, d)
+	default:
+		return fmt.Errorf("unknown report format %q, want text, json or html", format)
+	}
+}
+
+func writeTextReport(w io.Writer, d reportData) error {
+	ew := &errWriter{w: w}
+	ew.printf("Checked %d URLs, %d redirected, %d pages with broken links\n", d.Checked, d.Redirects, len(d.Broken))
+	for _, bp := range d.Broken {
+		ew.printf("\n%s\n", bp.Page)
+		for _, s := range bp.Links {
+			ew.printf("  %s %s\n", statusText(s), s.URL)
+		}
+	}
+
+	var redirected []URLStatus
+	for _, s := range d.URLs {
+		if len(s.Redirects) > 0 {
+			redirected = append(redirected, s)
+		}
+	}
+	if len(redirected) > 0 {
+		ew.printf("\nRedirects\n")
+	}
+	for _, s := range redirected {
+		ew.printf(" ")
+		for _, rd := range s.Redirects {
+			ew.printf(" %s -%d->", rd.URL, rd.Status)
+		}
+		ew.printf(" %s (%s)\n", s.FinalURL, statusText(s))
+	}
+	return ew.err
+}
+
+// statusText is a short description of how a URL fared.
+func statusText(s URLStatus) string {
+	if s.Error != "" {
+		return "error: " + s.Error
+	}
+	return fmt.Sprintf("%d", s.Status)
+}
+
+// errWriter keeps the first error from a run of writes.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, a ...interface{}) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, a...)
+	}
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"statusText": statusText,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Link report</title>
+  <style>
+    body { font-family: sans-serif; }
+    .broken { color: #b00; }
+    td { padding: 0 1em 0 0; }
+  </style>
+</head>
+<body>
+  <h1>Link report</h1>
+  <p>Checked {{.Checked}} URLs, {{.Redirects}} redirected, {{len .Broken}} pages with broken links.</p>
+  {{range .Broken}}
+  <h2><a href="{{.Page}}">{{.Page}}</a></h2>
+  <ul>
+    {{range .Links}}<li class="broken">{{statusText .}} <a href="{{.URL}}">{{.URL}}</a></li>
+    {{end}}
+  </ul>
+  {{end}}
+  <h2>All URLs</h2>
+  <table>
+    <tr><th>Status</th><th>URL</th><th>Redirects</th><th>Time</th><th>Type</th></tr>
+    {{range .URLs}}<tr{{if .Broken}} class="broken"{{end}}>
+      <td>{{statusText .}}</td>
+      <td><a href="{{.URL}}">{{.URL}}</a></td>
+      <td>{{range .Redirects}}{{.Status}} {{end}}{{.FinalURL}}</td>
+      <td>{{.Elapsed}}</td>
+      <td>{{.ContentType}}</td>
+    </tr>
+    {{end}}
+  </table>
+</body>
+</html>
+`))
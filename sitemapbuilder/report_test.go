@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	r := NewReport()
+	r.record(&URLStatus{URL: "https://example.com/", Status: 200, ContentType: "text/html"})
+	r.record(&URLStatus{URL: "https://example.com/a", Status: 200, Elapsed: 12 * time.Millisecond})
+	r.record(&URLStatus{URL: "https://example.com/gone", Status: 404})
+	r.record(&URLStatus{URL: "https://elsewhere.com/", Error: "connection refused", External: true})
+	r.record(&URLStatus{
+		URL:       "https://example.com/old",
+		Status:    200,
+		Redirects: []Redirect{{"https://example.com/old", 301}, {"https://example.com/older", 302}},
+		FinalURL:  "https://example.com/new",
+	})
+	r.linksFrom("https://example.com/", []string{"https://example.com/a", "https://example.com/gone", "https://example.com/old"})
+	r.linksFrom("https://example.com/a", []string{"https://example.com/gone", "https://elsewhere.com/"})
+	return r
+}
+
+func TestReport_Broken(t *testing.T) {
+	got := testReport().Broken()
+	if len(got) != 2 {
+		t.Fatalf("Broken() = %v, want 2 pages", got)
+	}
+	if got[0].Page != "https://example.com/" || len(got[0].Links) != 1 || got[0].Links[0].URL != "https://example.com/gone" {
+		t.Errorf("first page = %+v", got[0])
+	}
+	if got[1].Page != "https://example.com/a" || len(got[1].Links) != 2 ||
+		got[1].Links[0].URL != "https://elsewhere.com/" || got[1].Links[1].URL != "https://example.com/gone" {
+		t.Errorf("second page = %+v", got[1])
+	}
+
+	var nilReport *Report
+	nilReport.record(&URLStatus{URL: "x"})
+	nilReport.linksFrom("x", []string{"y"})
+}
+
+func TestReport_Write(t *testing.T) {
+	r := testReport()
+
+	var text bytes.Buffer
+	if err := r.Write(&text, "text"); err != nil {
+		t.Fatalf("Write(text) error = %v", err)
+	}
+	want := `Checked 5 URLs, 1 redirected, 2 pages with broken links
+
+https://example.com/
+  404 https://example.com/gone
+
+https://example.com/a
+  error: connection refused https://elsewhere.com/
+  404 https://example.com/gone
+
+Redirects
+  https://example.com/old -301-> https://example.com/older -302-> https://example.com/new (200)
+`
+	if text.String() != want {
+		t.Errorf("text report =\n%s\nwant\n%s", text.String(), want)
+	}
+
+	var js bytes.Buffer
+	if err := r.Write(&js, "json"); err != nil {
+		t.Fatalf("Write(json) error = %v", err)
+	}
+	var d reportData
+	if err := json.Unmarshal(js.Bytes(), &d); err != nil {
+		t.Fatalf("reading json report: %v", err)
+	}
+	if d.Checked != 5 || d.Redirects != 1 || len(d.Broken) != 2 || len(d.URLs) != 5 {
+		t.Errorf("json report = %+v", d)
+	}
+
+	var page bytes.Buffer
+	if err := r.Write(&page, "html"); err != nil {
+		t.Fatalf("Write(html) error = %v", err)
+	}
+	for _, s := range []string{"<h2><a href=\"https://example.com/a\">", `<li class="broken">404 <a href="https://example.com/gone">`} {
+		if !strings.Contains(page.String(), s) {
+			t.Errorf("html report is missing %s", s)
+		}
+	}
+
+	if err := r.Write(&page, "yaml"); err == nil {
+		t.Error("Write(yaml) should fail")
+	}
+}
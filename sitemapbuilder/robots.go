@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robots holds the robots.txt rules that apply to one user agent.
+type robots struct {
+	rules []robotsRule
+	delay time.Duration // Crawl-delay
+}
+
+// robotsRule is an Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	length  int // length of the pattern, the longest match wins
+	pattern *regexp.Regexp
+}
+
+// robotsGroup is a set of rules for some user agents.
+type robotsGroup struct {
+	agents []string
+	rules  []robotsRule
+	delay  time.Duration
+}
+
+// parseRobots parses a robots.txt file, returning the rules for
+// the group that best matches agent, or the "*" group if none do.
+func parseRobots(r io.Reader, agent string) (*robots, error) {
+	token := strings.ToLower(strings.SplitN(agent, "/", 2)[0])
+
+	var groups []*robotsGroup
+	var cur *robotsGroup
+	inAgents := false // still reading a group's User-agent lines
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.TrimSpace(kv[1])
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &robotsGroup{}
+				groups = append(groups, cur)
+				inAgents = true
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil || (key == "disallow" && val == "") {
+				continue // an empty Disallow allows everything
+			}
+			cur.rules = append(cur.rules, robotsRule{
+				allow:   key == "allow",
+				length:  len(val),
+				pattern: robotsPattern(val),
+			})
+		case "crawl-delay":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+				cur.delay = time.Duration(secs * float64(time.Second))
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	// The group naming the longest part of our agent wins over "*".
+	var best *robotsGroup
+	bestLen := -1
+	for _, g := range groups {
+		for _, a := range g.agents {
+			n := -1
+			switch {
+			case a == "*":
+				n = 0
+			case a != "" && strings.Contains(token, a):
+				n = len(a)
+			}
+			if n > bestLen {
+				best, bestLen = g, n
+			}
+		}
+	}
+	if best == nil {
+		return &robots{}, nil
+	}
+	return &robots{rules: best.rules, delay: best.delay}, nil
+}
+
+// robotsPattern compiles a robots.txt path pattern, where *
+// matches anything and a trailing $ anchors the end.
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	parts := strings.Split(p, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed reports whether the rules let u be crawled. The
+// longest matching rule wins, and Allow wins a tie.
+func (r *robots) allowed(u *url.URL) bool {
+	if r == nil {
+		return true
+	}
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	allow, length := true, -1
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(target) {
+			continue
+		}
+		if rule.length > length || (rule.length == length && rule.allow) {
+			allow, length = rule.allow, rule.length
+		}
+	}
+	return allow
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `# comments are ignored
+User-agent: *
+Disallow: /private/
+Allow: /private/open
+Disallow: /*.json$
+Crawl-delay: 2
+
+User-agent: Googlebot
+User-agent: sitemapbuilder
+Disallow: /drafts
+Allow: /drafts/published
+Disallow: /search?
+Crawl-delay: 0.5
+
+User-agent: badbot
+Disallow: /
+`
+
+func TestParseRobots(t *testing.T) {
+	testCases := []struct {
+		agent string
+		path  string
+		want  bool
+	}{
+		{"otherbot/2.0", "/", true},
+		{"otherbot/2.0", "/private/", false},
+		{"otherbot/2.0", "/private/secret", false},
+		{"otherbot/2.0", "/private/open/door", true},
+		{"otherbot/2.0", "/data.json", false},
+		{"otherbot/2.0", "/data.json?x=1", true},
+		{"sitemapbuilder/1.0", "/private/", true},
+		{"sitemapbuilder/1.0", "/drafts/wip", false},
+		{"sitemapbuilder/1.0", "/drafts/published/post", true},
+		{"sitemapbuilder/1.0", "/search", true},
+		{"sitemapbuilder/1.0", "/search?q=go", false},
+		{"BadBot", "/anything", false},
+	}
+
+	for _, tc := range testCases {
+		r, err := parseRobots(strings.NewReader(testRobots), tc.agent)
+		if err != nil {
+			t.Fatalf("parseRobots() error = %v", err)
+		}
+		u, _ := url.Parse("https://example.com" + tc.path)
+		if got := r.allowed(u); got != tc.want {
+			t.Errorf("allowed(%q) for %s = %v, want %v", tc.path, tc.agent, got, tc.want)
+		}
+	}
+}
+
+func TestParseRobotsCrawlDelay(t *testing.T) {
+	testCases := []struct {
+		agent string
+		want  time.Duration
+	}{
+		{"otherbot", 2 * time.Second},
+		{"sitemapbuilder/1.0", 500 * time.Millisecond},
+		{"badbot", 0},
+	}
+	for _, tc := range testCases {
+		r, err := parseRobots(strings.NewReader(testRobots), tc.agent)
+		if err != nil {
+			t.Fatalf("parseRobots() error = %v", err)
+		}
+		if r.delay != tc.want {
+			t.Errorf("crawl delay for %s = %s, want %s", tc.agent, r.delay, tc.want)
+		}
+	}
+}
+
+func TestParseRobotsEmpty(t *testing.T) {
+	r, err := parseRobots(strings.NewReader("User-agent: *\nDisallow:\n"), "sitemapbuilder")
+	if err != nil {
+		t.Fatalf("parseRobots() error = %v", err)
+	}
+	u, _ := url.Parse("https://example.com/anything")
+	if !r.allowed(u) {
+		t.Error("an empty Disallow should allow everything")
+	}
+}
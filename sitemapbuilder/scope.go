@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// QueryPolicy says which query parameters are kept on crawled
+// URLs. An empty policy drops them all, "*" keeps them all, and
+// anything else is an allowlist of parameter names.
+type QueryPolicy []string
+
+// ParseQueryPolicy parses "drop", "keep", or a comma
+// separated list of parameters to keep.
+func ParseQueryPolicy(s string) QueryPolicy {
+	switch s {
+	case "", "drop":
+		return nil
+	case "keep":
+		return QueryPolicy{"*"}
+	}
+	var q QueryPolicy
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			q = append(q, p)
+		}
+	}
+	return q
+}
+
+// apply trims u's query to the parameters the policy keeps,
+// sorting them so the same page always has the same URL.
+func (q QueryPolicy) apply(u *url.URL) {
+	if len(q) == 1 && q[0] == "*" {
+		if u.RawQuery != "" {
+			u.RawQuery = u.Query().Encode()
+		}
+		return
+	}
+	vals := u.Query()
+	for k := range vals {
+		if !q.keeps(k) {
+			delete(vals, k)
+		}
+	}
+	u.RawQuery = vals.Encode()
+}
+
+func (q QueryPolicy) keeps(param string) bool {
+	for _, p := range q {
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// patternList is a list of URL path patterns. It's a flag.Value
+// so patterns can be given by repeating a flag.
+type patternList []*regexp.Regexp
+
+func (p *patternList) String() string {
+	var s []string
+	for _, re := range *p {
+		s = append(s, re.String())
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+// Set adds a pattern to the list. See compilePattern.
+func (p *patternList) Set(s string) error {
+	re, err := compilePattern(s)
+	if err != nil {
+		return err
+	}
+	*p = append(*p, re)
+	return nil
+}
+
+// matches reports whether any pattern matches u's path and query.
+func (p patternList) matches(u *url.URL) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	for _, re := range p {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// compilePattern compiles a pattern matched against URL paths.
+// Patterns starting with "re:" are regular expressions that can
+// match anywhere. Anything else is a glob matching the whole
+// path, where * matches within one path segment and ** matches
+// across segments.
+func compilePattern(s string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(s, "re:") {
+		return regexp.Compile(s[3:])
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case s[i] == '*':
+			sb.WriteString("[^/]*")
+		case s[i] == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(s[i : i+1]))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// defaultExcludes leaves out links to files that aren't pages.
+var defaultExcludes = patternList{
+	regexp.MustCompile(`(?i)\.(jpe?g|png|gif|svg|webp|ico|bmp|pdf|zip|gz|tar|mp3|mp4|mov|css|js)(\?|$)`),
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func Test_compilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/blog/*", "/blog/post", true},
+		{"/blog/*", "/blog/2020/post", false},
+		{"/blog/**", "/blog/2020/post", true},
+		{"/blog/**", "/about", false},
+		{"/page-?", "/page-1", true},
+		{"/page-?", "/page-10", false},
+		{"**.pdf", "/files/report.pdf", true},
+		{"re:^/tag/", "/tag/go", true},
+		{"re:draft", "/posts/draft-1", true},
+		{"re:^/tag/", "/blog/tag/go", false},
+	}
+	for _, tt := range tests {
+		var p patternList
+		if err := p.Set(tt.pattern); err != nil {
+			t.Fatalf("Set(%q) error = %v", tt.pattern, err)
+		}
+		u, _ := url.Parse("https://example.com" + tt.path)
+		if got := p.matches(u); got != tt.want {
+			t.Errorf("pattern %q matching %q = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+
+	var p patternList
+	if err := p.Set("re:("); err == nil {
+		t.Error("Set() should fail for an invalid regexp")
+	}
+}
+
+func TestParseQueryPolicy(t *testing.T) {
+	tests := []struct {
+		s    string
+		want QueryPolicy
+	}{
+		{"", nil},
+		{"drop", nil},
+		{"keep", QueryPolicy{"*"}},
+		{"page, lang", QueryPolicy{"page", "lang"}},
+	}
+	for _, tt := range tests {
+		if got := ParseQueryPolicy(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseQueryPolicy(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func Test_defaultExcludes(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/img/logo.PNG":       true,
+		"/files/report.pdf":   true,
+		"/app.js?v=3":         true,
+		"/blog/post":          false,
+		"/blog/javascript-go": false,
+	} {
+		u, _ := url.Parse("https://example.com" + path)
+		if got := defaultExcludes.matches(u); got != want {
+			t.Errorf("defaultExcludes matching %q = %v, want %v", path, got, want)
+		}
+	}
+}
@@ -2,45 +2,73 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"io"
 	"net/url"
+	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // Page represents one page in the domain.
 type Page struct {
-	XMLName xml.Name `xml:"url"`
-	URL     string   `xml:"loc"`
+	XMLName    xml.Name    `xml:"url"`
+	URL        string      `xml:"loc"`
+	LastMod    string      `xml:"lastmod,omitempty"`
+	ChangeFreq string      `xml:"changefreq,omitempty"`
+	Priority   string      `xml:"priority,omitempty"`
+	Images     []Image     `xml:"image:image,omitempty"`
+	Alternates []Alternate `xml:"xhtml:link,omitempty"`
+
+	Depth    int       `xml:"-"` // clicks from the root page
+	Modified time.Time `xml:"-"` // when the page last changed, if known
+}
+
+// Image is an image on a page, for the image sitemap extension.
+type Image struct {
+	Loc string `xml:"image:loc"`
+}
+
+// Alternate is another language version of a page.
+type Alternate struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
 }
 
 // XMLMap represents all pages in the domain.
 type XMLMap struct {
 	XMLName   xml.Name `xml:"urlset"`
 	Namespace string   `xml:"xmlns,attr"`
-	Pages     []Page
+	ImageNS   string   `xml:"xmlns:image,attr,omitempty"`
+	XhtmlNS   string   `xml:"xmlns:xhtml,attr,omitempty"`
+	Pages     []Page   `xml:"url"`
 }
 
-type empty struct{}
-
-// SiteMap takes in a root URL and returns an XML sitemap.
-func SiteMap(rootURL string) (string, error) {
-	clean(&rootURL)
-	fmt.Printf("Building sitemap for %s...\n\n", rootURL)
+// Namespaces used in sitemaps.
+const (
+	sitemapNS = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	imageNS   = "http://www.google.com/schemas/sitemap-image/1.1"
+	xhtmlNS   = "http://www.w3.org/1999/xhtml"
+)
 
-	unvisited := map[string]empty{rootURL: empty{}}
-	found := map[string]empty{rootURL: empty{}}
+type empty struct{}
 
-	sitePages, err := crawlSite(rootURL, unvisited, found)
+// SiteMap takes in a root URL, crawls the site with c,
+// and returns an XML sitemap.
+func SiteMap(ctx context.Context, c *Crawler, rootURL string) (string, error) {
+	sitePages, err := CrawlSite(ctx, c, rootURL)
 	if err != nil {
 		return "", err
 	}
+	annotate(sitePages, nil, time.Now())
 	siteXML, err := buildXML(sitePages)
 	if err != nil {
 		return "", err
@@ -49,130 +77,79 @@ func SiteMap(rootURL string) (string, error) {
 	return siteXML, nil
 }
 
-func buildXML(sitePages []Page) (string, error) {
-
-	doc := XMLMap{Namespace: "http://www.sitemaps.org/schemas/sitemap/0.9", Pages: sitePages}
-	var xmlData bytes.Buffer
-	w := bufio.NewWriter(&xmlData)
+// CrawlSite normalizes the root URL and crawls the site with c.
+func CrawlSite(ctx context.Context, c *Crawler, rootURL string) ([]Page, error) {
+	ru, err := url.Parse(rootURL)
+	if err != nil {
+		return nil, err
+	}
+	rootURL = NormalizeURL(ru).String()
+	clean(&rootURL)
+	fmt.Fprintf(os.Stderr, "Building sitemap for %s...\n\n", rootURL)
 
-	enc := xml.NewEncoder(w)
-	enc.Indent("  ", "    ")
+	return c.Crawl(ctx, rootURL)
+}
 
-	if err := enc.Encode(doc); err != nil {
+// buildXML encodes pages as a sitemap.
+func buildXML(sitePages []Page) (string, error) {
+	var xmlData bytes.Buffer
+	if err := encodeURLSet(&xmlData, sitePages); err != nil {
 		return "", err
 	}
-	siteXML := xmlData.String()
-
-	return siteXML, nil
+	return xmlData.String(), nil
 }
 
-// crawlSite crawls over pages in the domain, returning a slice of Pages.
-func crawlSite(
-	rootURL string,
-	unvisited map[string]empty,
-	found map[string]empty) ([]Page, error) {
-	var SitePages []Page
-	for len(unvisited) > 0 {
-		for lnk := range unvisited {
-			// Remove the link from the list of unvisiteds.
-			delete(unvisited, lnk)
-
-			// Get the page's links, create the page, and add it to SitePages.
-			uid, err := pageURLsInDomain(lnk, rootURL)
-			if err != nil {
-				return nil, err
-			}
-			thisPage := Page{URL: lnk}
-			SitePages = append(SitePages, thisPage)
-
-			// Add unfound pages to found and unvisted lists.
-			for _, dl := range uid {
-				if _, ok := found[dl]; !ok {
-					found[dl] = empty{}
-					unvisited[dl] = empty{}
-				}
-			}
+// encodeURLSet writes a sitemap of pages to w, declaring
+// the image and xhtml namespaces when they're used.
+func encodeURLSet(w io.Writer, sitePages []Page) error {
+	doc := XMLMap{Namespace: sitemapNS, Pages: sitePages}
+	for _, p := range sitePages {
+		if len(p.Images) > 0 {
+			doc.ImageNS = imageNS
+		}
+		if len(p.Alternates) > 0 {
+			doc.XhtmlNS = xhtmlNS
 		}
 	}
-	return SitePages, nil
-}
 
-// pageURLsInDomain filters URLs from a given page for the ones in the domain.
-func pageURLsInDomain(lnk string, rootURL string) ([]string, error) {
-	urls, err := getPageLinks(lnk)
-	if err != nil {
-		return nil, err
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
 	}
-	uid, err := filterLinks(rootURL, urls)
-	if err != nil {
-		return nil, err
+	enc := xml.NewEncoder(w)
+	enc.Indent("  ", "    ")
+	if err := enc.Encode(doc); err != nil {
+		return err
 	}
-	// Use keyList to return a slice of the URLs.
-	return keyList(uid), nil
+	_, err := io.WriteString(w, "\n")
+	return err
 }
 
-// filterLinks filters a map to contain only URLs in the domain of the root URL.
-func filterLinks(rootURL string, urls []string) (map[string]empty, error) {
-	pr, err := url.Parse(rootURL)
+// filterLinks resolves the links found on the page at pageURL and
+// filters them to a map of the page URLs in the same domain, with
+// their query strings trimmed to the ones q keeps.
+func filterLinks(pageURL string, links []Link, q QueryPolicy) (map[string]empty, error) {
+	pu, err := url.Parse(pageURL)
 	if err != nil {
 		return nil, err
 	}
-	rootHost := pr.Host
 
 	uid := make(map[string]empty)
-	for _, u := range urls {
-		pu, err := url.Parse(u)
-		if err != nil {
-			return nil, err
-		}
-		var fileExt string
-		if len(u) > 4 {
-			fileExt = u[len(u)-4:]
+	for _, l := range ResolveLinks(pu, links) {
+		if l.Scope != ScopeInternal || l.Kind == KindBase {
+			continue
 		}
-		// Check if the link is in the domain of the root URL.
-		if (pu.Host == rootHost || pu.Host == "") && (fileExt != ".jpg" && fileExt != ".png") {
-			clean(&pu.Path)
-			if _, ok := uid[rootURL+pu.Path]; !ok {
-				uid[rootURL+pu.Path] = empty{}
-			}
+		lu, err := url.Parse(l.URL)
+		if err != nil {
+			continue
 		}
+		q.apply(lu)
+		u := lu.String()
+		clean(&u)
+		uid[u] = empty{}
 	}
 	return uid, nil
 }
 
-// getPageLinks returns a slice of links from a page.
-func getPageLinks(url string) ([]string, error) {
-	s, err := pageToString(url)
-	if err != nil {
-		return nil, err
-	}
-	r := strings.NewReader(string(s))
-	l, err := ParseLinks(r)
-	if err != nil {
-		return nil, err
-	}
-	urls := GetURLs(l)
-
-	return urls, nil
-}
-
-// pageToString takes in a url and returns a string of the HTML.
-func pageToString(url string) (string, error) {
-	resp, err := http.Get(url)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	html, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	str := fmt.Sprintf("%s\n", html)
-
-	return str, nil
-}
-
 // keyList is a utility that takes a map of links and creates a list of its keys.
 func keyList(mp map[string]empty) []string {
 	var ret []string
@@ -190,30 +167,317 @@ func clean(s *string) {
 // HACK: adding  contents here because I'm not yet sure how to use
 // go 1.13 with private and local repos.
 
-// ParseLinks reads in a file, parses it into a node tree,
-// and returns an array of Links from the HTML document.
-func ParseLinks(r *strings.Reader) ([]Link, error) {
-	doc, err := html.Parse(r)
+// ParseLinks reads an HTML document from r and
+// returns the Links in it.
+func ParseLinks(r io.Reader) ([]Link, error) {
+	var Links []Link
+	err := ParseLinksFunc(r, func(l Link) error {
+		Links = append(Links, l)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	return Links, nil
+}
+
+// ParseLinksFunc streams an HTML document from r, calling fn
+// with each Link as soon as it's complete. Anchors are complete
+// at their closing tag, so links inside an anchor, like its
+// images, come before the anchor itself. Only the current
+// token and anchor are held in memory, so documents of any
+// size can be parsed. Parsing stops at the first error
+// returned by fn.
+func ParseLinksFunc(r io.Reader, fn func(Link) error) error {
+	z := html.NewTokenizer(r)
+	pos := position{line: 1, col: 1}
+
+	var cur *Link
+	var txt []string
+	emit := func() error {
+		if cur == nil {
+			return nil
+		}
+		cur.Text = strings.Join(txt, " ")
+		l := *cur
+		cur, txt = nil, nil
+		return fn(l)
+	}
 
-	Links := getLinks(doc)
+	// a robots meta tag can mark every link on the page nofollow
+	pageNoFollow := false
 
-	return Links, nil
+	for {
+		tt := z.Next()
+		at := pos
+		pos.advance(z.Raw())
+
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return z.Err()
+			}
+			return emit()
+
+		case html.TextToken:
+			if cur != nil {
+				txt = append(txt, strings.Fields(string(z.Text()))...)
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			if _, ok := linkAttrs[a]; !ok {
+				continue
+			}
+			attrs := tagAttrs(z, hasAttr)
+			base := Link{
+				Rel:      attrs["rel"],
+				Title:    attrs["title"],
+				Target:   attrs["target"],
+				Hreflang: attrs["hreflang"],
+				Line:     at.line,
+				Col:      at.col,
+			}
+			base.NoFollow = pageNoFollow || hasToken(base.Rel, "nofollow")
+
+			var found []Link
+			switch a {
+			case atom.A:
+				// links can't nest, so a new one closes the last
+				if err := emit(); err != nil {
+					return err
+				}
+				if href, ok := attrs["href"]; ok {
+					l := base
+					l.Kind, l.Href = KindAnchor, href
+					cur = &l
+				}
+				if tt == html.SelfClosingTagToken {
+					if err := emit(); err != nil {
+						return err
+					}
+				}
+			case atom.Img:
+				alt := attrs["alt"]
+				if cur != nil {
+					txt = append(txt, strings.Fields(alt)...)
+				}
+				if src, ok := attrs["src"]; ok {
+					found = append(found, base.with(KindImage, src, alt))
+				}
+				for _, src := range srcsetURLs(attrs["srcset"]) {
+					found = append(found, base.with(KindImage, src, alt))
+				}
+			case atom.Meta:
+				content := attrs["content"]
+				if strings.EqualFold(attrs["name"], "robots") && hasToken(content, "nofollow") {
+					pageNoFollow = true
+				}
+				if strings.EqualFold(attrs["http-equiv"], "refresh") {
+					if u := refreshURL(content); u != "" {
+						found = append(found, base.with(KindRefresh, u, ""))
+					}
+				}
+			default:
+				k := linkAttrs[a]
+				if href, ok := attrs[k.attr]; ok {
+					found = append(found, base.with(k.kind, href, attrs["alt"]))
+				}
+			}
+			for _, l := range found {
+				if err := fn(l); err != nil {
+					return err
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.A {
+				if err := emit(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// ParseLinksChan streams an HTML document from r in a new
+// goroutine, sending each Link on the returned channel. The
+// channel is closed when parsing ends, after which the error
+// channel receives the parse error, if any. Cancelling ctx
+// stops the parse early.
+func ParseLinksChan(ctx context.Context, r io.Reader) (<-chan Link, <-chan error) {
+	links := make(chan Link)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		err := ParseLinksFunc(r, func(l Link) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			select {
+			case links <- l:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(links)
+		if err != nil {
+			errc <- err
+		}
+	}()
+	return links, errc
 }
 
+// Kind is the kind of element a Link was found in.
+type Kind string
+
+// The kinds of Link ParseLinks finds.
+const (
+	KindAnchor  Kind = "a"
+	KindArea    Kind = "area"
+	KindLink    Kind = "link"
+	KindImage   Kind = "img"
+	KindScript  Kind = "script"
+	KindIframe  Kind = "iframe"
+	KindForm    Kind = "form"
+	KindRefresh Kind = "refresh"
+	KindBase    Kind = "base"
+)
+
 // Link is a type that holds parsed link information.
 type Link struct {
-	Href string
-	Text string
+	Href     string `json:"href"`
+	Text     string `json:"text"`
+	Kind     Kind   `json:"kind"`
+	Rel      string `json:"rel,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Target   string `json:"target,omitempty"`
+	NoFollow bool   `json:"nofollow,omitempty"`
+	Hreflang string `json:"hreflang,omitempty"`
+	Line     int    `json:"line"` // line of the tag in the source, from 1
+	Col      int    `json:"col"`  // column of the tag in the source, from 1
+
+	// URL and Scope are set by ResolveLinks.
+	URL   string `json:"url,omitempty"`
+	Scope Scope  `json:"scope,omitempty"`
+}
+
+// with copies a Link's attributes into a new Link
+// of kind k pointing at href.
+func (l Link) with(k Kind, href, text string) Link {
+	l.Kind, l.Href, l.Text = k, href, text
+	return l
+}
+
+// OfKind returns only the Links of the given kinds.
+func OfKind(ls []Link, kinds ...Kind) []Link {
+	var ret []Link
+	for _, l := range ls {
+		for _, k := range kinds {
+			if l.Kind == k {
+				ret = append(ret, l)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+// linkAttrs maps each element that can hold a link
+// to the attribute the link is in.
+var linkAttrs = map[atom.Atom]struct {
+	kind Kind
+	attr string
+}{
+	atom.A:      {KindAnchor, "href"},
+	atom.Area:   {KindArea, "href"},
+	atom.Link:   {KindLink, "href"},
+	atom.Img:    {KindImage, "src"},
+	atom.Script: {KindScript, "src"},
+	atom.Iframe: {KindIframe, "src"},
+	atom.Form:   {KindForm, "action"},
+	atom.Meta:   {KindRefresh, "content"},
+	atom.Base:   {KindBase, "href"},
+}
+
+// tagAttrs reads the current tag's attributes into a map.
+func tagAttrs(z *html.Tokenizer, hasAttr bool) map[string]string {
+	attrs := make(map[string]string)
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attrs[string(key)] = string(val)
+	}
+	return attrs
+}
+
+// hasToken reports whether the space separated list
+// s contains tok, ignoring case.
+func hasToken(s, tok string) bool {
+	for _, f := range strings.Fields(s) {
+		if strings.EqualFold(f, tok) {
+			return true
+		}
+	}
+	return false
+}
+
+// srcsetURLs returns the URLs in a srcset attribute
+// like "small.png 1x, large.png 2x".
+func srcsetURLs(srcset string) []string {
+	var urls []string
+	for _, c := range strings.Split(srcset, ",") {
+		if f := strings.Fields(c); len(f) > 0 {
+			urls = append(urls, f[0])
+		}
+	}
+	return urls
+}
+
+// refreshURL returns the URL in a meta refresh
+// content attribute like "5; url=/next".
+func refreshURL(content string) string {
+	i := strings.Index(content, ";")
+	if i < 0 {
+		return ""
+	}
+	u := strings.TrimSpace(content[i+1:])
+	if len(u) > 4 && strings.EqualFold(u[:4], "url=") {
+		u = strings.TrimSpace(u[4:])
+	}
+	return strings.Trim(u, `'"`)
+}
+
+// position is a line and column in the source document.
+type position struct {
+	line, col int
+}
+
+// advance moves the position past raw.
+func (p *position) advance(raw []byte) {
+	if n := bytes.Count(raw, []byte("\n")); n > 0 {
+		p.line += n
+		p.col = 1
+		raw = raw[bytes.LastIndexByte(raw, '\n')+1:]
+	}
+	p.col += utf8.RuneCount(raw)
 }
 
 // PrintLinks prints a formatted list of Links.
 func PrintLinks(ls []Link) {
+	FprintLinks(os.Stdout, ls)
+}
+
+// FprintLinks writes a formatted list of Links to w.
+func FprintLinks(w io.Writer, ls []Link) error {
 	for i, l := range ls {
-		fmt.Printf("%d. Link text: %s, URL: %s\n", i+1, l.Href, l.Text)
+		if _, err := fmt.Fprintf(w, "%d. Link text: %s, URL: %s\n", i+1, l.Text, l.Href); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // GetURLs returns a slice of only the urls
@@ -237,7 +501,9 @@ func GetLinkText(ls []Link) []string {
 }
 
 // getLinks is a helper to get the href attribute
-// values of link tags in a given node tree.
+// values of link tags in a given node tree. It's the
+// tree-walking parser ParseLinks used to be built on,
+// kept to benchmark the streaming parser against.
 func getLinks(n *html.Node) []Link {
 	var Links []Link
 	isLink := false
@@ -247,7 +513,7 @@ func getLinks(n *html.Node) []Link {
 			if a.Key == "href" {
 				s := txtNodes(n)
 				s = strings.Trim(s, " ")
-				Links = append(Links, Link{Href: a.Val, Text: s})
+				Links = append(Links, Link{Href: a.Val, Text: s, Kind: KindAnchor})
 				break
 			}
 		}
@@ -265,12 +531,20 @@ func getLinks(n *html.Node) []Link {
 }
 
 // txtNodes is a helper to get the text node
-// values in a given node tree.
+// values in a given node tree, along with the
+// alt text of any images.
 func txtNodes(n *html.Node) string {
 	s := ""
 	if n.Type == html.TextNode {
 		s = fmt.Sprintf("%v ", strings.Trim(n.Data, " \n\t"))
 	}
+	if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+		for _, a := range n.Attr {
+			if a.Key == "alt" {
+				s = fmt.Sprintf("%v ", strings.TrimSpace(a.Val))
+			}
+		}
+	}
 
 	// Range over the node's children and recursively collect
 	// text node values.
@@ -282,3 +556,77 @@ func txtNodes(n *html.Node) string {
 
 	return s
 }
+
+// Scope says where a resolved Link points relative to the
+// page it was found on.
+type Scope string
+
+// The scopes ResolveLinks assigns.
+const (
+	ScopeInternal Scope = "internal" // same host as the page
+	ScopeExternal Scope = "external" // another host
+	ScopeNonHTTP  Scope = "non-http" // mailto:, javascript:, tel: and so on
+	ScopeInvalid  Scope = "invalid"  // couldn't be parsed
+)
+
+// defaultPorts are the ports NormalizeURL strips.
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// ResolveLinks resolves each Link's Href against the page URL
+// base, or against the page's <base href> if it has one, and
+// sets its normalized URL and Scope. HTTP links are internal
+// when they're on base's host.
+func ResolveLinks(base *url.URL, links []Link) []Link {
+	site := NormalizeURL(base)
+	ref := site
+	for _, l := range links {
+		if l.Kind != KindBase {
+			continue
+		}
+		if bu, err := url.Parse(strings.TrimSpace(l.Href)); err == nil {
+			ref = site.ResolveReference(bu)
+		}
+		break // only the first <base> counts
+	}
+
+	ret := make([]Link, len(links))
+	for i, l := range links {
+		ret[i] = l
+		u, err := url.Parse(strings.TrimSpace(l.Href))
+		if err != nil {
+			ret[i].Scope = ScopeInvalid
+			continue
+		}
+		u = NormalizeURL(ref.ResolveReference(u))
+		ret[i].URL = u.String()
+		switch {
+		case u.Scheme != "http" && u.Scheme != "https":
+			ret[i].Scope = ScopeNonHTTP
+		case u.Host == site.Host:
+			ret[i].Scope = ScopeInternal
+		default:
+			ret[i].Scope = ScopeExternal
+		}
+	}
+	return ret
+}
+
+// NormalizeURL returns a copy of u with its scheme and host
+// lowercased, default ports and fragment stripped, and an
+// empty HTTP path set to "/".
+func NormalizeURL(u *url.URL) *url.URL {
+	n := *u
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if port := n.Port(); port != "" && port == defaultPorts[n.Scheme] {
+		n.Host = strings.TrimSuffix(n.Host, ":"+port)
+	}
+	if (n.Scheme == "http" || n.Scheme == "https") && n.Path == "" && n.Opaque == "" {
+		n.Path = "/"
+	}
+	n.Fragment = ""
+	return &n
+}
@@ -6,47 +6,107 @@ import (
 	"testing"
 )
 
-func Test_crawlSite(t *testing.T) {
+func Test_clean(t *testing.T) {
 	type args struct {
-		rootURL   string
-		unvisited map[string]empty
-		found     map[string]empty
+		s *string
 	}
 	tests := []struct {
-		name    string
-		args    args
-		want    []Page
-		wantErr bool
+		name string
+		args args
 	}{
 		// TODO: Add test cases.
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := crawlSite(tt.args.rootURL, tt.args.unvisited, tt.args.found)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("crawlSite() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("crawlSite() = %v, want %v", got, tt.want)
-			}
+			clean(tt.args.s)
 		})
 	}
 }
 
-func Test_clean(t *testing.T) {
+func Test_filterLinks(t *testing.T) {
 	type args struct {
-		s *string
+		pageURL string
+		links   []Link
+		q       QueryPolicy
 	}
 	tests := []struct {
-		name string
-		args args
+		name    string
+		args    args
+		want    map[string]empty
+		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{
+			name: "relative links resolve against the page",
+			args: args{"https://example.com/blog/post/", []Link{
+				{Href: "../other"},
+				{Href: "next"},
+				{Href: "/about/#team"},
+				{Href: "https://EXAMPLE.com:443/"},
+			}, nil},
+			want: map[string]empty{
+				"https://example.com/blog/other":     {},
+				"https://example.com/blog/post/next": {},
+				"https://example.com/about":          {},
+				"https://example.com":                {},
+			},
+		},
+		{
+			name: "base href is honored",
+			args: args{"https://example.com/a/b", []Link{
+				{Href: "/docs/", Kind: KindBase},
+				{Href: "intro"},
+			}, nil},
+			want: map[string]empty{
+				"https://example.com/docs/intro": {},
+			},
+		},
+		{
+			name: "other domains and non-http links are dropped",
+			args: args{"https://example.com/", []Link{
+				{Href: "//cdn.example.com/x"},
+				{Href: "https://other.com/"},
+				{Href: "mailto:me@example.com"},
+				{Href: "javascript:void(0)"},
+			}, nil},
+			want: map[string]empty{},
+		},
+		{
+			name: "query strings are dropped by default",
+			args: args{"https://example.com/", []Link{
+				{Href: "/search?q=go&page=2"},
+			}, nil},
+			want: map[string]empty{"https://example.com/search": {}},
+		},
+		{
+			name: "query strings can be kept and are sorted",
+			args: args{"https://example.com/", []Link{
+				{Href: "/search?q=go&page=2"},
+			}, QueryPolicy{"*"}},
+			want: map[string]empty{"https://example.com/search?page=2&q=go": {}},
+		},
+		{
+			name: "allowlisted query params are kept",
+			args: args{"https://example.com/", []Link{
+				{Href: "/search?q=go&utm_source=x&page=2"},
+			}, QueryPolicy{"page"}},
+			want: map[string]empty{"https://example.com/search?page=2": {}},
+		},
+		{
+			name:    "invalid page URL",
+			args:    args{"http://[::1", nil, nil},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			clean(tt.args.s)
+			got, err := filterLinks(tt.args.pageURL, tt.args.links, tt.args.q)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("filterLinks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterLinks() = %v, want %v", got, tt.want)
+			}
 		})
 	}
 }
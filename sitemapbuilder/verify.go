@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VerifyResult is what fetching a page listed in a sitemap found.
+type VerifyResult struct {
+	URL      string
+	Status   URLStatus
+	Problems []string
+}
+
+// Verify fetches every page and checks it comes back 200 OK
+// without redirecting, isn't marked noindex, and doesn't name
+// another page as canonical. The results are sorted by URL.
+func (c *Crawler) Verify(ctx context.Context, pages []Page) []VerifyResult {
+	c.limiter = newHostLimiter(c.RateLimit)
+	n := c.Concurrency
+	if n < 1 {
+		n = 1
+	}
+
+	jobs := make(chan string)
+	var mu sync.Mutex
+	var results []VerifyResult
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range jobs {
+				r := c.verify(ctx, u)
+				mu.Lock()
+				results = append(results, r)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	urls, _ := indexPages(pages)
+	for _, u := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- u
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].URL < results[j].URL })
+	return results
+}
+
+// verify fetches and checks one page.
+func (c *Crawler) verify(ctx context.Context, loc string) VerifyResult {
+	r := VerifyResult{URL: loc}
+	f := fetch{method: http.MethodGet, url: loc, status: &URLStatus{URL: loc}}
+	var hm headMeta
+	var final *url.URL
+	err := c.get(ctx, f, func(resp *http.Response) error {
+		final = resp.Request.URL
+		if hasToken(strings.Replace(resp.Header.Get("X-Robots-Tag"), ",", " ", -1), "noindex") {
+			hm.noindex = true
+		}
+		if resp.StatusCode == http.StatusOK && isHTML(resp.Header.Get("Content-Type")) {
+			head := scanHead(resp.Body)
+			head.noindex = head.noindex || hm.noindex
+			hm = head
+		}
+		return nil
+	})
+	r.Status = *f.status
+	if err != nil {
+		r.Problems = append(r.Problems, err.Error())
+		return r
+	}
+
+	if r.Status.FinalURL != "" {
+		r.Problems = append(r.Problems, "redirects to "+r.Status.FinalURL)
+	}
+	if r.Status.Status != http.StatusOK {
+		r.Problems = append(r.Problems, fmt.Sprintf("status %d", r.Status.Status))
+	}
+	if hm.noindex {
+		r.Problems = append(r.Problems, "noindex")
+	}
+	if hm.canonical != "" {
+		if cu, err := url.Parse(hm.canonical); err == nil {
+			canonical := NormalizeURL(final.ResolveReference(cu)).String()
+			if !sameURL(canonical, final.String()) {
+				r.Problems = append(r.Problems, "canonical is "+canonical)
+			}
+		}
+	}
+	return r
+}
+
+// sameURL reports whether two URLs are the same once
+// normalized, ignoring trailing slashes.
+func sameURL(a, b string) bool {
+	norm := func(s string) string {
+		u, err := url.Parse(s)
+		if err != nil {
+			return s
+		}
+		s = NormalizeURL(u).String()
+		clean(&s)
+		return s
+	}
+	return norm(a) == norm(b)
+}
+
+// writeVerifyResults prints the pages with problems to w,
+// and returns how many there were.
+func writeVerifyResults(w io.Writer, results []VerifyResult) (int, error) {
+	ew := &errWriter{w: w}
+	bad := 0
+	for _, r := range results {
+		if len(r.Problems) == 0 {
+			continue
+		}
+		bad++
+		ew.printf("%s: %s\n", r.URL, strings.Join(r.Problems, ", "))
+	}
+	ew.printf("%d of %d pages have problems\n", bad, len(results))
+	return bad, ew.err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCrawler_Verify(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/", "/ok/":
+			fmt.Fprint(w, `<head><link rel="canonical" href="/ok"></head>`)
+		case "/self":
+			fmt.Fprintf(w, `<head><link rel="canonical" href="http://%s/self#top"></head>`, r.Host)
+		case "/noindex":
+			fmt.Fprint(w, `<head><meta name="robots" content="noindex,follow"></head>`)
+		case "/header-noindex":
+			w.Header().Set("X-Robots-Tag", "noindex")
+		case "/moved":
+			http.Redirect(w, r, "/self", http.StatusFound)
+		case "/body-meta":
+			fmt.Fprint(w, `<body><meta name="robots" content="noindex"></body>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	var pages []Page
+	for _, p := range []string{"/", "/ok/", "/self", "/noindex", "/header-noindex", "/moved", "/missing", "/body-meta"} {
+		pages = append(pages, Page{URL: srv.URL + p})
+	}
+	c := testCrawler()
+	c.Retries = 0
+	results := c.Verify(context.Background(), pages)
+
+	got := make(map[string][]string)
+	for _, r := range results {
+		got[strings.TrimPrefix(r.URL, srv.URL)] = r.Problems
+	}
+	want := map[string][]string{
+		"/":               {"canonical is " + srv.URL + "/ok"},
+		"/ok/":            nil,
+		"/self":           nil,
+		"/noindex":        {"noindex"},
+		"/header-noindex": {"noindex"},
+		"/moved":          {"redirects to " + srv.URL + "/self"},
+		"/missing":        {"status 404"},
+		"/body-meta":      nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify() problems =\n%q\nwant\n%q", got, want)
+	}
+
+	var out bytes.Buffer
+	bad, err := writeVerifyResults(&out, results)
+	if err != nil || bad != 5 {
+		t.Errorf("writeVerifyResults() = %d, %v, want 5 bad", bad, err)
+	}
+	if !strings.HasSuffix(out.String(), "5 of 8 pages have problems\n") {
+		t.Errorf("writeVerifyResults() printed %q", out.String())
+	}
+}
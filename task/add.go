@@ -9,24 +9,32 @@ import (
 
 // addCmd represents the add command
 var addCmd = &cobra.Command{
-	Use:   "add",
+	Use:   "add <task>",
 	Short: "Add something to your task list",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 {
-			return
-		}
-
+	Long: `Add something to your task list. Along with the text a task
+can have +tags, a project:name, a priority p:high, p:medium or
+p:low, and a due date such as due:friday, due:tomorrow,
+due:next monday, due:in 3 days, due:eom or due:2020-06-12.
+every:3d, every:2w, every:monthly or every:mon,thu makes it
+recur: when it's done, the next one is added to the list.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		// Get the task.
-		task := strings.Join(args, " ")
+		task, err := parseTask(strings.Join(args, " "), now())
+		if err != nil {
+			return err
+		}
+		if task.Text == "" {
+			return fmt.Errorf("a task needs some text")
+		}
 
 		// Put the task in the database.
-		err := AddToDB(task)
-		if err != nil {
-			fmt.Print("Error when adding to DB:", err)
+		if task, err = AddToDB(task); err != nil {
+			return fmt.Errorf("adding to database: %s", err)
 		}
 
-		fmt.Printf("added '%s' to your task list\n", task)
+		fmt.Fprintf(cmd.OutOrStdout(), "added '%s' to your task list\n", task)
+		return nil
 	},
 }
 
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	completedSince   string
+	completedBetween string
+	summarySince     string
+	summaryBetween   string
+	summaryBy        string
+)
+
+// completedCmd represents the completed command
+var completedCmd = &cobra.Command{
+	Use:   "completed",
+	Short: "List the tasks you've done, today unless you say otherwise",
+	Long: `List the tasks you've done today, or since a time ago with
+--since 7d (or 12h, 2w), or between two dates with
+--between 2020-06-01,2020-06-07. The numbers shown are the
+ones task undo takes.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		from, to, label, err := completedRange(completedSince, completedBetween, now())
+		if err != nil {
+			return err
+		}
+		tasks, err := CompletedTasks()
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		count := 0
+		for i, t := range tasks {
+			if !inRange(t.Completed, from, to) {
+				continue
+			}
+			if count == 0 {
+				fmt.Fprintf(out, "You've done the following tasks %s:\n", label)
+			}
+			count++
+			fmt.Fprintf(out, "%d. %s (%s)\n", i+1, t, t.Completed.Format("Mon Jan 2 15:04"))
+		}
+		if count == 0 {
+			fmt.Fprintf(out, "...nothing done %s yet!\n", label)
+		}
+		return nil
+	},
+}
+
+// summaryCmd represents the summary command
+var summaryCmd = &cobra.Command{
+	Use:   "summary",
+	Short: "Summarize the tasks done this past week by project or tag",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if summaryBy != "project" && summaryBy != "tag" {
+			return fmt.Errorf("can't summarize by '%s', only by project or tag", summaryBy)
+		}
+		since := summarySince
+		if !cmd.Flags().Changed("since") && summaryBetween != "" {
+			since = "" // only the default
+		}
+		from, to, label, err := completedRange(since, summaryBetween, now())
+		if err != nil {
+			return err
+		}
+		tasks, err := CompletedTasks()
+		if err != nil {
+			return err
+		}
+		var done []Task
+		for _, t := range tasks {
+			if inRange(t.Completed, from, to) {
+				done = append(done, t)
+			}
+		}
+		writeSummary(cmd.OutOrStdout(), done, summaryBy, label)
+		return nil
+	},
+}
+
+// undoCmd represents the undo command
+var undoCmd = &cobra.Command{
+	Use:   "undo <number>...",
+	Short: "Put completed tasks back on your task list",
+	Long: `Put completed tasks back on your task list, using the
+numbers task completed shows.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tasks, err := CompletedTasks()
+		if err != nil {
+			return err
+		}
+		picked, err := pickByNumber(tasks, args)
+		if err != nil {
+			return err
+		}
+		for _, t := range picked {
+			if _, err := UndoTask(t.ID); err != nil {
+				return fmt.Errorf("undoing task error: %s", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "put '%s' back on your task list\n", t)
+		}
+		return nil
+	},
+}
+
+func init() {
+	completedCmd.Flags().StringVar(&completedSince, "since", "", "show tasks done this long ago or since, e.g. 7d, 2w, 12h")
+	completedCmd.Flags().StringVar(&completedBetween, "between", "", "show tasks done between two dates, e.g. 2020-06-01,2020-06-07")
+	summaryCmd.Flags().StringVar(&summarySince, "since", "7d", "summarize tasks done this long ago or since")
+	summaryCmd.Flags().StringVar(&summaryBetween, "between", "", "summarize tasks done between two dates")
+	summaryCmd.Flags().StringVar(&summaryBy, "by", "project", "group tasks by project or tag")
+	rootCmd.AddCommand(completedCmd)
+	rootCmd.AddCommand(summaryCmd)
+	rootCmd.AddCommand(undoCmd)
+}
+
+// completedRange works out the time range to show completed
+// tasks for, from the --since and --between flags, and says
+// what it is. With neither, it's today so far.
+func completedRange(since, between string, t time.Time) (from, to time.Time, label string, err error) {
+	today := startOfDay(t)
+	switch {
+	case since != "" && between != "":
+		return from, to, "", fmt.Errorf("use either --since or --between, not both")
+
+	case between != "":
+		parts := strings.Split(between, ",")
+		if len(parts) != 2 {
+			return from, to, "", fmt.Errorf("--between takes two dates like 2020-06-01,2020-06-07")
+		}
+		if from, err = parseDate(parts[0], t.Location()); err != nil {
+			return from, to, "", err
+		}
+		if to, err = parseDate(parts[1], t.Location()); err != nil {
+			return from, to, "", err
+		}
+		if to.Before(from) {
+			return from, to, "", fmt.Errorf("%s is before %s", parts[1], parts[0])
+		}
+		label = fmt.Sprintf("between %s and %s", from.Format("Mon Jan 2"), to.Format("Mon Jan 2"))
+		return from, to.AddDate(0, 0, 1).Add(-time.Nanosecond), label, nil // to the end of the last day
+
+	case since != "":
+		d, err := parseAgo(since)
+		if err != nil {
+			return from, to, "", err
+		}
+		from = t.Add(-d)
+		if d%(24*time.Hour) == 0 {
+			// whole days count from the start of the day
+			from = today.AddDate(0, 0, -int(d/(24*time.Hour))+1)
+		}
+		return from, t, "since " + from.Format("Mon Jan 2 15:04"), nil
+
+	default:
+		return today, t, "today", nil
+	}
+}
+
+// parseAgo parses a length of time like 7d or 2w, or
+// anything time.ParseDuration takes.
+func parseAgo(s string) (time.Duration, error) {
+	unit := map[byte]time.Duration{'d': 24 * time.Hour, 'w': 7 * 24 * time.Hour}
+	if len(s) > 1 && unit[s[len(s)-1]] != 0 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n > 0 {
+			return time.Duration(n) * unit[s[len(s)-1]], nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("'%s' isn't a length of time like 7d, 2w or 12h", s)
+	}
+	return d, nil
+}
+
+// parseDate parses a date like 2020-06-01 in loc.
+func parseDate(s string, loc *time.Location) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), loc)
+	if err != nil {
+		return t, fmt.Errorf("'%s' isn't a date like 2020-06-01", s)
+	}
+	return t, nil
+}
+
+// startOfDay returns midnight at the start of t's day.
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// inRange reports whether from <= t <= to.
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && !t.After(to)
+}
+
+// writeSummary prints the tasks grouped by project or tag,
+// the biggest groups first. A task with several tags is
+// counted under each.
+func writeSummary(w io.Writer, tasks []Task, by, label string) {
+	groups := make(map[string][]Task)
+	for _, t := range tasks {
+		keys := []string{t.Project}
+		if by == "tag" {
+			keys = t.Tags
+		}
+		if len(keys) == 0 || keys[0] == "" {
+			keys = []string{"(no " + by + ")"}
+		}
+		for _, k := range keys {
+			groups[k] = append(groups[k], t)
+		}
+	}
+	var names []string
+	for k := range groups {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := groups[names[i]], groups[names[j]]
+		return len(a) > len(b) || (len(a) == len(b) && names[i] < names[j])
+	})
+
+	fmt.Fprintf(w, "%d tasks done %s\n", len(tasks), label)
+	for _, k := range names {
+		fmt.Fprintf(w, "\n%s (%d)\n", k, len(groups[k]))
+		for _, t := range groups[k] {
+			fmt.Fprintf(w, "  %s\n", t)
+		}
+	}
+}
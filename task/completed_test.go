@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// setClock makes now return t until the returned func is called.
+func setClock(t time.Time) func() {
+	old := now
+	now = func() time.Time { return t }
+	return func() { now = old }
+}
+
+// clearTasks removes every task and completed task, in every list.
+func clearTasks(t *testing.T) {
+	t.Helper()
+	if err := OpenDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseDB()
+	err := db.Update(func(tx *bolt.Tx) error {
+		var names [][]byte
+		tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, append([]byte(nil), name...))
+			return nil
+		})
+		for _, name := range names {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompleted(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	day := time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local) // a Wednesday
+
+	// Do a task a day for a week, ending today.
+	for i, name := range []string{"six", "five", "four", "three", "two", "one", "zero"} {
+		reset := setClock(day.AddDate(0, 0, i-6))
+		runTask("add", name+" +chores project:house")
+		runTask("do", "1")
+		reset()
+	}
+	defer setClock(day.Add(3 * time.Hour))()
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"today", nil, `You've done the following tasks today:
+1. zero +chores project:house (Wed Jun 10 09:00)
+`},
+		{"since 2d", []string{"--since", "2d"}, `You've done the following tasks since Tue Jun 9 00:00:
+1. zero +chores project:house (Wed Jun 10 09:00)
+2. one +chores project:house (Tue Jun 9 09:00)
+`},
+		{"since hours", []string{"--since", "30h"}, `You've done the following tasks since Tue Jun 9 06:00:
+1. zero +chores project:house (Wed Jun 10 09:00)
+2. one +chores project:house (Tue Jun 9 09:00)
+`},
+		{"between", []string{"--between", "2020-06-05,2020-06-06"}, `You've done the following tasks between Fri Jun 5 and Sat Jun 6:
+5. four +chores project:house (Sat Jun 6 09:00)
+6. five +chores project:house (Fri Jun 5 09:00)
+`},
+		{"nothing", []string{"--between", "2020-01-01,2020-01-02"}, "...nothing done between Wed Jan 1 and Thu Jan 2 yet!\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err, got := runTask("completed", tt.args...)
+			if err != nil {
+				t.Fatalf("completed %v: %s", tt.args, err)
+			}
+			if got != tt.want {
+				t.Errorf("completed %v =\n%s\nwant\n%s", tt.args, got, tt.want)
+			}
+		})
+	}
+
+	for _, args := range [][]string{
+		{"--since", "soon"},
+		{"--between", "2020-06-05"},
+		{"--between", "2020-06-06,2020-06-05"},
+		{"--since", "2d", "--between", "2020-06-05,2020-06-06"},
+	} {
+		if err, _ := runTask("completed", args...); err == nil {
+			t.Errorf("completed %v should be an error", args)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+
+	for _, name := range []string{"mop +chores project:house", "pay rent +money project:house", "write report project:work", "stretch"} {
+		runTask("add", name)
+	}
+	runTask("do", "1", "2", "3", "4")
+
+	err, got := runTask("summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `4 tasks done since Thu Jun 4 00:00
+
+house (2)
+  mop +chores project:house
+  pay rent +money project:house
+
+(no project) (1)
+  stretch
+
+work (1)
+  write report project:work
+`
+	if got != want {
+		t.Errorf("summary =\n%s\nwant\n%s", got, want)
+	}
+
+	err, got = runTask("summary", "--by", "tag", "--between", "2020-06-10,2020-06-10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "4 tasks done between Wed Jun 10 and Wed Jun 10\n\n(no tag) (2)\n") || !strings.Contains(got, "\nchores (1)\n  mop") {
+		t.Errorf("summary by tag =\n%s", got)
+	}
+
+	if err, _ := runTask("summary", "--by", "colour"); err == nil {
+		t.Error("summary --by colour should be an error")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+
+	for _, name := range []string{"one", "two", "three"} {
+		runTask("add", name)
+	}
+	runTask("do", "1", "3")
+
+	// The most recently done task is number 1.
+	err, got := runTask("undo", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "put 'three' back on your task list\n"; got != want {
+		t.Errorf("undo output is %q, want %q", got, want)
+	}
+	if _, got := runTask("list"); !strings.HasSuffix(got, "\n1. two\n2. three\n") {
+		t.Errorf("After undo, list output is %q", got)
+	}
+
+	if err, _ := runTask("undo", "2"); err == nil {
+		t.Error("undo of a number that isn't there should be an error")
+	}
+
+	var out bytes.Buffer
+	if err := run([]string{"completed", "--since", "1d"}, &out); err != nil || !strings.Contains(out.String(), "1. one") {
+		t.Errorf("completed after undo = %q, %v", out.String(), err)
+	}
+}
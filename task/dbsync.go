@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/boltdb/bolt"
+)
+
+// sameTask reports whether two tasks look like the same task:
+// the same text, project, tags and due date. Import uses it to
+// skip duplicates, and sync to match tasks without a uid.
+func sameTask(a, b Task) bool {
+	if !strings.EqualFold(a.Text, b.Text) || a.Project != b.Project || !a.Due.Equal(b.Due) || len(a.Tags) != len(b.Tags) {
+		return false
+	}
+	tags := make(map[string]bool)
+	for _, tag := range a.Tags {
+		tags[tag] = true
+	}
+	for _, tag := range b.Tags {
+		if !tags[tag] {
+			return false
+		}
+	}
+	return true
+}
+
+// listTasks reads a list's tasks and completed tasks.
+func listTasks(tx *bolt.Tx) ([]Task, error) {
+	tasks, err := readBucket(tx.Bucket(taskBucket(listName)))
+	if err != nil {
+		return nil, err
+	}
+	done, err := readBucket(tx.Bucket(completedBucket(listName)))
+	return append(tasks, done...), err
+}
+
+// ImportTasks adds tasks to the list, done ones to its
+// completed tasks, skipping any that are already there. It
+// returns the tasks added and how many were skipped.
+func ImportTasks(tasks []Task) (added []Task, skipped int, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		have, err := listTasks(tx)
+		if err != nil {
+			return err
+		}
+	next:
+		for _, t := range tasks {
+			for _, h := range have {
+				if sameTask(t, h) {
+					skipped++
+					continue next
+				}
+			}
+			t.ID, t.Next = 0, 0
+			if t.UID == "" {
+				t.UID = newUID()
+			}
+			if t.Created.IsZero() {
+				t.Created = now()
+			}
+			t.Modified = now()
+			if t, err = putListTask(tx, t); err != nil {
+				return err
+			}
+			have = append(have, t)
+			added = append(added, t)
+		}
+		return nil
+	})
+	return added, skipped, err
+}
+
+// putListTask stores a task in the list, or its completed tasks
+// if it's done. A task without an ID gets the list's next one.
+func putListTask(tx *bolt.Tx, t Task) (Task, error) {
+	b, err := tx.CreateBucketIfNotExists(taskBucket(listName))
+	if err != nil {
+		return t, err
+	}
+	done, err := tx.CreateBucketIfNotExists(completedBucket(listName))
+	if err != nil {
+		return t, err
+	}
+	if t.ID == 0 {
+		if t.ID, err = b.NextSequence(); err != nil {
+			return t, err
+		}
+	}
+	if !t.Completed.IsZero() {
+		b = done
+	}
+	return t, putTask(b, t)
+}
+
+// SyncResult counts the tasks a sync changed.
+type SyncResult struct {
+	Here  int // tasks added, changed or removed in the list
+	There int // tasks added, changed or removed in the file
+}
+
+// SyncedBefore reports whether the list has been synced with
+// the file key names.
+func SyncedBefore(key string) (bool, error) {
+	var synced bool
+	err := db.View(func(tx *bolt.Tx) error {
+		if sb := tx.Bucket([]byte(SYNC_BUCKET)); sb != nil {
+			synced = sb.Get(syncKey(key)) != nil
+		}
+		return nil
+	})
+	return synced, err
+}
+
+func syncKey(key string) []byte {
+	return []byte(listName + "\x00" + key)
+}
+
+// SyncTasks merges the tasks in a file with the list, both
+// ways, and calls write with the merged tasks to write back
+// to the file. key names the file, so the next sync can tell
+// what's changed on each side since this one. If write fails,
+// the list is left as it was.
+func SyncTasks(key string, remote []Task, write func([]Task) error) (SyncResult, error) {
+	var res SyncResult
+	err := db.Update(func(tx *bolt.Tx) error {
+		local, err := listTasks(tx)
+		if err != nil {
+			return err
+		}
+		sb, err := tx.CreateBucketIfNotExists([]byte(SYNC_BUCKET))
+		if err != nil {
+			return err
+		}
+		synced := make(map[string]string)
+		k := syncKey(key)
+		if v := sb.Get(k); v != nil {
+			if err := json.Unmarshal(v, &synced); err != nil {
+				return err
+			}
+		}
+
+		var merged []Task
+		merged, res, err = mergeTasks(local, remote, synced)
+		if err != nil {
+			return err
+		}
+
+		// Write the list as merged, then remember it. New
+		// tasks are numbered on from the old list, so a removed
+		// task's ID isn't given to a new one.
+		seq := uint64(0)
+		if b := tx.Bucket(taskBucket(listName)); b != nil {
+			seq = b.Sequence()
+		}
+		for _, name := range [][]byte{taskBucket(listName), completedBucket(listName)} {
+			if tx.Bucket(name) == nil {
+				continue
+			}
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+		}
+		b, err := tx.CreateBucket(taskBucket(listName))
+		if err != nil {
+			return err
+		}
+		if err := b.SetSequence(seq); err != nil {
+			return err
+		}
+		synced = make(map[string]string)
+		for i, t := range merged {
+			if merged[i], err = putListTask(tx, t); err != nil {
+				return err
+			}
+			synced[t.UID] = todoTxtLine(t, false)
+		}
+		v, err := json.Marshal(synced)
+		if err != nil {
+			return err
+		}
+		if err := sb.Put(k, v); err != nil {
+			return err
+		}
+		sort.SliceStable(merged, func(i, j int) bool { return merged[i].ID < merged[j].ID })
+		return write(merged)
+	})
+	return res, err
+}
+
+// mergeTasks merges local and remote tasks by uid. synced has
+// each task as it was at the last sync, written as a todo.txt
+// line. A task changed on one side since then takes that
+// side's version; one changed on both takes the most recently
+// modified. A task missing from one side that was there at the
+// last sync was removed, and is removed from the other side,
+// unless the other side changed it since; then it's kept.
+// Remote tasks without a uid are matched to local ones with
+// sameTask. Recurring tasks done in the file come back like
+// they do with task do.
+func mergeTasks(local, remote []Task, synced map[string]string) ([]Task, SyncResult, error) {
+	var res SyncResult
+	byUID := make(map[string]int)
+	for i := range local {
+		if local[i].UID == "" {
+			local[i].UID = newUID()
+		}
+		byUID[local[i].UID] = i
+	}
+
+	remoteByUID := make(map[string]Task)
+	var order []string
+	for _, r := range remote {
+		if r.UID == "" {
+			r.UID = newUID()
+			for _, l := range local {
+				if _, taken := remoteByUID[l.UID]; !taken && sameTask(l, r) {
+					r.UID = l.UID
+					break
+				}
+			}
+		}
+		if _, dup := remoteByUID[r.UID]; dup {
+			continue
+		}
+		remoteByUID[r.UID] = r
+		if _, ok := byUID[r.UID]; !ok {
+			order = append(order, r.UID)
+		}
+	}
+
+	var merged []Task
+	for _, l := range local {
+		r, inFile := remoteByUID[l.UID]
+		base, wasSynced := synced[l.UID]
+		switch {
+		case !inFile && wasSynced && todoTxtLine(l, false) == base:
+			// removed from the file
+			res.Here++
+		case !inFile:
+			merged = append(merged, l)
+			res.There++
+		case todoTxtLine(l, false) == todoTxtLine(r, false):
+			merged = append(merged, l)
+		default:
+			lChanged := !wasSynced || todoTxtLine(l, false) != base
+			rChanged := !wasSynced || todoTxtLine(r, false) != base
+			if rChanged && (!lChanged || modTime(r).After(modTime(l))) {
+				next, err := takeRemote(l, r)
+				if err != nil {
+					return nil, res, err
+				}
+				merged = append(merged, next...)
+				res.Here++
+				res.There += len(next) - 1
+			} else {
+				merged = append(merged, l)
+				res.There++
+			}
+		}
+	}
+	for _, uid := range order {
+		r := remoteByUID[uid]
+		if base, wasSynced := synced[uid]; wasSynced && todoTxtLine(r, false) == base {
+			// removed from the list
+			res.There++
+			continue
+		}
+		r.ID, r.Next = 0, 0
+		if r.Modified.IsZero() {
+			r.Modified = now()
+		}
+		merged = append(merged, r)
+		res.Here++
+	}
+	return merged, res, nil
+}
+
+// takeRemote returns the remote version of local task l, along
+// with the task that comes next if it's a recurring task that
+// was done in the file.
+func takeRemote(l, r Task) ([]Task, error) {
+	r.ID, r.Next = l.ID, l.Next
+	if r.Modified.IsZero() || !r.Modified.After(l.Modified) {
+		r.Modified = now()
+	}
+	if r.Recur == "" || r.Completed.IsZero() || !l.Completed.IsZero() {
+		return []Task{r}, nil
+	}
+	next, err := nextInstance(r)
+	return []Task{r, next}, err
+}
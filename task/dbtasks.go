@@ -1,33 +1,469 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/boltdb/bolt"
+	homedir "github.com/mitchellh/go-homedir"
 )
 
 var db *bolt.DB
 
-// OpenDB opens the database.
-func OpenDB() error { // take in the path to the db (tasks.db)
+// dbPath is the database file opened when none is configured.
+var dbPath = defaultDBPath()
+
+// listName is the task list the commands work on. Each list is
+// kept in its own buckets, and "" is the default list.
+var listName string
+
+// now is the clock used to timestamp tasks, swapped out in tests.
+var now = time.Now
+
+// dbTimeout is how long OpenDB waits for another task
+// command to let go of the database.
+var dbTimeout = 1 * time.Second
+
+// ErrNoTask is the error for a task ID that isn't in the list.
+type ErrNoTask uint64
+
+func (id ErrNoTask) Error() string {
+	return fmt.Sprintf("no task with id %d", uint64(id))
+}
+
+// Task is a task in the list. Tasks are stored as JSON under
+// their ID, which comes from the bucket's sequence. A recurring
+// task keeps its rule in Recur, and once done, the ID of the
+// task made to take its place in Next. UID names the task
+// across databases and files, and Modified is when it last
+// changed, for task sync.
+type Task struct {
+	ID        uint64    `json:"id"`
+	Text      string    `json:"text"`
+	Project   string    `json:"project,omitempty"`
+	Tags      []string  `json:"tags,omitempty"`
+	Priority  Priority  `json:"priority,omitempty"`
+	Due       time.Time `json:"due,omitempty"`
+	Recur     string    `json:"recur,omitempty"`
+	Next      uint64    `json:"next,omitempty"`
+	UID       string    `json:"uid,omitempty"`
+	Modified  time.Time `json:"modified,omitempty"`
+	Created   time.Time `json:"created,omitempty"`
+	Completed time.Time `json:"completed,omitempty"`
+}
+
+// OpenDB opens the database at path, creating it and the
+// default list's buckets if they're missing.
+func OpenDB(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
 	var err error
-	db, err = bolt.Open("tasks.db", 0600, &bolt.Options{Timeout: 1 * time.Second})
+	db, err = bolt.Open(path, 0600, &bolt.Options{Timeout: dbTimeout})
 	if err != nil {
 		return err
 	}
 
 	return db.Update(func(tx *bolt.Tx) error {
-		_, err = tx.CreateBucketIfNotExists([]byte("TaskBucket"))
+		if _, err := tx.CreateBucketIfNotExists([]byte(COMPLETED_BUCKET)); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists([]byte(DB_BUCKET))
+		if err != nil {
+			return err
+		}
+		return upgradeBucket(b)
+	})
+}
+
+// CloseDB closes the database if it's open.
+func CloseDB() error {
+	if db == nil {
+		return nil
+	}
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// upgradeBucket moves tasks stored the old way, as keys
+// with empty values, to JSON values under sequence keys.
+func upgradeBucket(b *bolt.Bucket) error {
+	var old [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		if len(v) == 0 {
+			old = append(old, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range old {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+		if _, err := putNewTask(b, Task{Text: string(k)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// String returns the task the way it's written on the
+// command line, with its tags, project, priority and due date.
+func (t Task) String() string {
+	s := t.Text
+	for _, tag := range t.Tags {
+		s += " +" + tag
+	}
+	if t.Project != "" {
+		s += " project:" + t.Project
+	}
+	if t.Priority != PriorityNone {
+		s += " p:" + t.Priority.String()
+	}
+	if !t.Due.IsZero() {
+		s += " due:" + t.Due.Format("2006-01-02")
+	}
+	if t.Recur != "" {
+		s += " every:" + t.Recur
+	}
+	return s
+}
+
+// Overdue reports whether the task was due before the day of now.
+func (t Task) Overdue(now time.Time) bool {
+	return !t.Due.IsZero() && t.Due.Before(startOfDay(now))
+}
+
+// AddToDB adds a task to the database, stamped with the
+// time it was created.
+func AddToDB(t Task) (Task, error) {
+	t.Created = now()
+	t.UID, t.Modified = newUID(), t.Created
+	err := db.Update(func(tx *bolt.Tx) error {
+		var err error
+		b, err := tx.CreateBucketIfNotExists(taskBucket(listName))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(completedBucket(listName)); err != nil {
+			return err
+		}
+		t, err = putNewTask(b, t)
+		return err
+	})
+	return t, err
+}
+
+// putNewTask stores a task under the bucket's next sequence number.
+func putNewTask(b *bolt.Bucket, t Task) (Task, error) {
+	id, err := b.NextSequence()
+	if err != nil {
+		return Task{}, err
+	}
+	t.ID = id
+	return t, putTask(b, t)
+}
+
+// putTask stores a task under its ID.
+func putTask(b *bolt.Bucket, t Task) error {
+	v, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(t.ID), v)
+}
+
+// AllTasks returns the tasks in the order they were added.
+func AllTasks() ([]Task, error) {
+	return bucketTasks(taskBucket(listName))
+}
+
+// CompletedTasks returns the completed tasks, the most
+// recently completed first.
+func CompletedTasks() ([]Task, error) {
+	tasks, err := bucketTasks(completedBucket(listName))
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Completed.After(tasks[j].Completed)
+	})
+	return tasks, err
+}
+
+// bucketTasks reads every task in a bucket. A list that
+// hasn't been added to yet has no bucket, and no tasks.
+func bucketTasks(bucket []byte) ([]Task, error) {
+	var tasks []Task
+	err := db.View(func(tx *bolt.Tx) error {
+		var err error
+		tasks, err = readBucket(tx.Bucket(bucket))
+		return err
+	})
+	return tasks, err
+}
+
+// readBucket reads every task in b, which may be nil.
+func readBucket(b *bolt.Bucket) ([]Task, error) {
+	var tasks []Task
+	if b == nil {
+		return nil, nil
+	}
+	err := b.ForEach(func(k, v []byte) error {
+		var t Task
+		if err := json.Unmarshal(v, &t); err != nil {
+			return fmt.Errorf("reading task %d: %s", btoi(k), err)
+		}
+		tasks = append(tasks, t)
+		return nil
+	})
+	return tasks, err
+}
+
+// CompleteTask moves a task to the completed bucket,
+// stamped with the time it was done. If the task recurs, the
+// next one is added to the list, due when the rule next gives,
+// and returned as next.
+func CompleteTask(id uint64) (done, next Task, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		var err error
+		done, err = moveTaskTx(tx, id, taskBucket(listName), completedBucket(listName), func(t *Task) error {
+			t.Completed = now()
+			t.Modified = t.Completed
+			if t.Recur == "" {
+				return nil
+			}
+			next, err = nextInstance(*t)
+			if err != nil {
+				return err
+			}
+			next, err = putNewTask(tx.Bucket(taskBucket(listName)), next)
+			t.Next = next.ID
+			return err
+		})
 		return err
 	})
+	return done, next, err
+}
+
+// nextInstance returns the task that takes the place of
+// a recurring task once it's done.
+func nextInstance(t Task) (Task, error) {
+	due, err := nextDue(t.Recur, t.Due, t.Completed)
+	if err != nil {
+		return Task{}, err
+	}
+	next := t
+	next.ID, next.Due, next.Created, next.Completed, next.Next = 0, due, t.Completed, time.Time{}, 0
+	next.UID, next.Modified = newUID(), now()
+	return next, nil
 }
 
-// AddToDB adds an entry to the database.
-func AddToDB(task string) error {
+// UndoTask moves a completed task back to the task list.
+// If it recurs, the task made to take its place is removed
+// if it hasn't been done since.
+func UndoTask(id uint64) (Task, error) {
+	var t Task
 	err := db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("TaskBucket"))
-		err := b.Put([]byte(task), []byte(""))
+		var err error
+		t, err = moveTaskTx(tx, id, completedBucket(listName), taskBucket(listName), func(t *Task) error {
+			t.Completed, t.Modified = time.Time{}, now()
+			if t.Next != 0 {
+				if err := tx.Bucket(taskBucket(listName)).Delete(itob(t.Next)); err != nil {
+					return err
+				}
+				t.Next = 0
+			}
+			return nil
+		})
 		return err
 	})
-	return err
+	return t, err
+}
+
+// moveTaskTx moves a task between buckets, keeping its ID,
+// and changes it with fn on the way.
+func moveTaskTx(tx *bolt.Tx, id uint64, from, to []byte, fn func(*Task) error) (Task, error) {
+	var t Task
+	src := tx.Bucket(from)
+	if src == nil {
+		return t, ErrNoTask(id)
+	}
+	v := src.Get(itob(id))
+	if v == nil {
+		return t, ErrNoTask(id)
+	}
+	if err := json.Unmarshal(v, &t); err != nil {
+		return t, fmt.Errorf("reading task %d: %s", id, err)
+	}
+	if err := fn(&t); err != nil {
+		return t, err
+	}
+	if err := src.Delete(itob(id)); err != nil {
+		return t, err
+	}
+	return t, putTask(tx.Bucket(to), t)
+}
+
+// GetTask returns the task with the given ID, from the
+// list or its completed tasks.
+func GetTask(id uint64) (Task, error) {
+	var t Task
+	err := db.View(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{taskBucket(listName), completedBucket(listName)} {
+			if b := tx.Bucket(name); b != nil {
+				if v := b.Get(itob(id)); v != nil {
+					return json.Unmarshal(v, &t)
+				}
+			}
+		}
+		return ErrNoTask(id)
+	})
+	return t, err
+}
+
+// EditTask replaces the text and fields of a task with those
+// of t, keeping its ID, its uid and when it was made.
+func EditTask(id uint64, t Task) (Task, error) {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(taskBucket(listName))
+		var v []byte
+		if b != nil {
+			v = b.Get(itob(id))
+		}
+		if v == nil {
+			return ErrNoTask(id)
+		}
+		var old Task
+		if err := json.Unmarshal(v, &old); err != nil {
+			return fmt.Errorf("reading task %d: %s", id, err)
+		}
+		t.ID, t.UID, t.Created, t.Completed, t.Next = old.ID, old.UID, old.Created, old.Completed, old.Next
+		t.Modified = now()
+		return putTask(b, t)
+	})
+	return t, err
+}
+
+// DeleteTask removes the task with the given ID.
+func DeleteTask(id uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(taskBucket(listName))
+		if b == nil || b.Get(itob(id)) == nil {
+			return ErrNoTask(id)
+		}
+		return b.Delete(itob(id))
+	})
+}
+
+// TaskList is a named task list and how many tasks it has.
+type TaskList struct {
+	Name      string
+	Tasks     int
+	Completed int
+}
+
+// Lists returns the task lists in the database, the
+// default list first and the rest in order of name.
+func Lists() ([]TaskList, error) {
+	var lists []TaskList
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+			var list string
+			switch {
+			case string(name) == DB_BUCKET:
+				list = DEFAULT_LIST
+			case strings.HasPrefix(string(name), DB_BUCKET+":"):
+				list = strings.TrimPrefix(string(name), DB_BUCKET+":")
+			default:
+				return nil
+			}
+			l := TaskList{Name: list, Tasks: b.Stats().KeyN}
+			if done := tx.Bucket(completedBucket(list)); done != nil {
+				l.Completed = done.Stats().KeyN
+			}
+			lists = append(lists, l)
+			return nil
+		})
+	})
+	sort.SliceStable(lists, func(i, j int) bool {
+		return lists[i].Name == DEFAULT_LIST && lists[j].Name != DEFAULT_LIST
+	})
+	return lists, err
+}
+
+// taskBucket returns the name of the bucket holding a list's tasks.
+func taskBucket(list string) []byte {
+	if list == "" || list == DEFAULT_LIST {
+		return []byte(DB_BUCKET)
+	}
+	return []byte(DB_BUCKET + ":" + list)
+}
+
+// completedBucket returns the name of the bucket holding
+// a list's completed tasks.
+func completedBucket(list string) []byte {
+	if list == "" || list == DEFAULT_LIST {
+		return []byte(COMPLETED_BUCKET)
+	}
+	return []byte(COMPLETED_BUCKET + ":" + list)
+}
+
+// defaultDBPath returns where the database goes when none is
+// configured: tasks.db in $XDG_DATA_HOME/task, or in
+// ~/.local/share/task if XDG_DATA_HOME isn't set.
+func defaultDBPath() string {
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return DB_NAME
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "task", DB_NAME)
+}
+
+// newUID returns a random ID for a task.
+func newUID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// modTime returns when a task last changed, going by when it
+// was done or made if it's from before tasks kept track.
+func modTime(t Task) time.Time {
+	switch {
+	case !t.Modified.IsZero():
+		return t.Modified
+	case !t.Completed.IsZero():
+		return t.Completed
+	}
+	return t.Created
+}
+
+// itob returns the 8-byte big endian key for an ID,
+// so keys sort in the order tasks were added.
+func itob(id uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, id)
+	return b
+}
+
+func btoi(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
 }
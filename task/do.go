@@ -1,51 +1,35 @@
 package main
 
 import (
-	"strings"
+	"fmt"
 
 	"github.com/spf13/cobra"
 )
 
 // doCmd represents the do command
 var doCmd = &cobra.Command{
-	Use:   "do",
+	Use:   "do <number>...",
 	Short: "Mark something as done",
 	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 {
-			return
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tasks, err := tasksByNumber(args)
+		if err != nil {
+			return err
 		}
 
-		task := strings.Join(args, " ")
-		_ = task
-
-		// // Open the database.
-		// db, err := bolt.Open(DB_NAME, 0600, &bolt.Options{Timeout: 1 * time.Second})
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-		// defer db.Close()
-
-		// // Delete the task from the database.
-		// err = db.Update(func(tx *bolt.Tx) error {
-
-		// 	b := tx.Bucket([]byte(DB_BUCKET))
-
-		// 	// If the task doesn't exist, return an error.
-		// 	if ok := b.Get([]byte(task)); ok == nil {
-		// 		return fmt.Errorf("task '%s' not in task list", task)
-		// 	}
-
-		// 	if err := b.Delete([]byte(task)); err != nil {
-		// 		return fmt.Errorf("remove from database error: %s", err)
-		// 	}
-
-		// 	fmt.Printf("hooray! you've done it: '%s'. removing from your task list\n", task)
-		// 	return nil
-		// })
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
+		// Move the done tasks to the completed bucket.
+		for _, t := range tasks {
+			_, next, err := CompleteTask(t.ID)
+			if err != nil {
+				return fmt.Errorf("completing task error: %s", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "hooray! you've done it: '%s'. moving it to your completed tasks\n", t)
+			if next.ID != 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "it's next due %s\n", next.Due.Format("Mon Jan 2"))
+			}
+		}
+		return nil
 	},
 }
 
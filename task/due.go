@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseDue parses a due date relative to now, returning the
+// start of that day. It understands
+//
+//	today, tomorrow, yesterday
+//	friday, fri           the next friday, or today if it's friday
+//	next friday           a week after that
+//	next week, next month the monday or first day after this one
+//	eow, eom              the end of this week (sunday) or month
+//	in 3 days, 3d, +2w    days, weeks or months from today
+//	2020-06-12, jun 12    a date, this year or next
+//
+// Words can be joined with - instead of spaces, as in next-friday.
+func parseDue(s string, now time.Time) (time.Time, error) {
+	phrase := strings.ToLower(strings.TrimSpace(strings.Replace(s, "-", " ", -1)))
+	today := startOfDay(now)
+	if d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), now.Location()); err == nil {
+		return d, nil
+	}
+
+	words := strings.Fields(phrase)
+	switch {
+	case len(words) == 0:
+		return time.Time{}, fmt.Errorf("no due date given")
+	case phrase == "today" || phrase == "tod":
+		return today, nil
+	case phrase == "tomorrow" || phrase == "tom":
+		return today.AddDate(0, 0, 1), nil
+	case phrase == "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	case phrase == "eow" || phrase == "end of week":
+		return today.AddDate(0, 0, (7-int(today.Weekday()))%7), nil
+	case phrase == "eom" || phrase == "end of month":
+		return time.Date(today.Year(), today.Month()+1, 0, 0, 0, 0, 0, today.Location()), nil
+	case phrase == "next week":
+		return today.AddDate(0, 0, 7-(int(today.Weekday())+6)%7), nil
+	case phrase == "next month":
+		return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), nil
+	}
+
+	if wd, ok := weekdays[phrase]; ok {
+		return nextWeekday(today, wd), nil
+	}
+	if len(words) == 2 && words[0] == "next" {
+		if wd, ok := weekdays[words[1]]; ok {
+			return nextWeekday(today, wd).AddDate(0, 0, 7), nil
+		}
+	}
+	if n, unit, ok := parseOffset(words); ok {
+		switch unit {
+		case 'd':
+			return today.AddDate(0, 0, n), nil
+		case 'w':
+			return today.AddDate(0, 0, 7*n), nil
+		case 'm':
+			return today.AddDate(0, n, 0), nil
+		}
+	}
+	for _, layout := range []string{"Jan 2", "January 2", "2 Jan", "2 January"} {
+		if d, err := time.ParseInLocation(layout, phrase, now.Location()); err == nil {
+			d = time.Date(today.Year(), d.Month(), d.Day(), 0, 0, 0, 0, today.Location())
+			if d.Before(today) {
+				d = d.AddDate(1, 0, 0)
+			}
+			return d, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("can't understand due date '%s'", s)
+}
+
+// parseOffset parses "in 3 days", "3 days", "3d" or "+3d",
+// returning the count and unit: d, w or m.
+func parseOffset(words []string) (int, byte, bool) {
+	if len(words) > 0 && words[0] == "in" {
+		words = words[1:]
+	}
+	var num, unit string
+	switch len(words) {
+	case 1:
+		w := strings.TrimPrefix(words[0], "+")
+		if len(w) < 2 {
+			return 0, 0, false
+		}
+		num, unit = w[:len(w)-1], w[len(w)-1:]
+	case 2:
+		num, unit = words[0], strings.TrimSuffix(words[1], "s")
+	default:
+		return 0, 0, false
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n < 0 {
+		return 0, 0, false
+	}
+	switch unit {
+	case "d", "day":
+		return n, 'd', true
+	case "w", "week":
+		return n, 'w', true
+	case "m", "month":
+		return n, 'm', true
+	}
+	return 0, 0, false
+}
+
+// nextWeekday returns the first day on or after day
+// that falls on wd.
+func nextWeekday(day time.Time, wd time.Weekday) time.Time {
+	return day.AddDate(0, 0, (int(wd)-int(day.Weekday())+7)%7)
+}
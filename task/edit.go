@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// editCmd represents the edit command
+var editCmd = &cobra.Command{
+	Use:   "edit <number> <task>",
+	Short: "Change a task",
+	Long: `Change a task, giving it new text, tags, project, priority,
+due date and recurrence the same way as task add.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tasks, err := tasksByNumber(args[:1])
+		if err != nil {
+			return err
+		}
+		task, err := parseTask(strings.Join(args[1:], " "), now())
+		if err != nil {
+			return err
+		}
+		if task.Text == "" {
+			return fmt.Errorf("a task needs some text")
+		}
+
+		if task, err = EditTask(tasks[0].ID, task); err != nil {
+			return fmt.Errorf("editing task error: %s", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "changed '%s' to '%s'\n", tasks[0], task)
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(editCmd)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The formats tasks can be imported and exported in.
+const (
+	FormatTodoTxt = "todo.txt"
+	FormatJSON    = "json"
+	FormatCSV     = "csv"
+)
+
+// formatFor returns the format to use for a file: format if it's
+// given, or the one its extension suggests, todo.txt by default.
+func formatFor(format, path string) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatTodoTxt, "todotxt", "txt":
+		return FormatTodoTxt, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unknown format '%s', use todo.txt, json or csv", format)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON, nil
+	case ".csv":
+		return FormatCSV, nil
+	}
+	return FormatTodoTxt, nil
+}
+
+// readTasks reads tasks written in format.
+func readTasks(r io.Reader, format string) ([]Task, error) {
+	switch format {
+	case FormatJSON:
+		var tasks []Task
+		if err := json.NewDecoder(r).Decode(&tasks); err != nil && err != io.EOF {
+			return nil, err
+		}
+		return tasks, nil
+	case FormatCSV:
+		return readCSV(r)
+	}
+	return readTodoTxt(r)
+}
+
+// writeTasks writes tasks in format. With ids, todo.txt lines
+// keep each task's uid and modification time, for task sync;
+// the other formats always have them.
+func writeTasks(w io.Writer, tasks []Task, format string, ids bool) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(tasks)
+	case FormatCSV:
+		return writeCSV(w, tasks)
+	}
+	for _, t := range tasks {
+		if _, err := fmt.Fprintln(w, todoTxtLine(t, ids)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// todo.txt priorities, A the highest. Anything below C
+// is read as low.
+var todoPriorities = map[Priority]string{
+	PriorityHigh:   "A",
+	PriorityMedium: "B",
+	PriorityLow:    "C",
+}
+
+func todoPriority(s string) Priority {
+	if len(s) != 1 || s[0] < 'A' || s[0] > 'Z' {
+		return PriorityNone
+	}
+	for p, name := range todoPriorities {
+		if name == s {
+			return p
+		}
+	}
+	return PriorityLow
+}
+
+// todoTxtLine writes a task as a line of todo.txt:
+//
+//	x 2020-06-11 2020-06-01 pay rent +house @home due:2020-06-12 pri:A
+//	(A) 2020-06-01 pay rent +house @home due:2020-06-12 rec:1m
+//
+// The project is a +project, tags are @contexts, and the due
+// date and recurrence rule are due: and rec:. Done tasks keep
+// their priority as pri:, as todo.txt drops the (A) when a
+// task is done.
+func todoTxtLine(t Task, ids bool) string {
+	var words []string
+	pri := todoPriorities[t.Priority]
+	switch {
+	case !t.Completed.IsZero():
+		words = append(words, "x", t.Completed.Format("2006-01-02"))
+	case pri != "":
+		words = append(words, "("+pri+")")
+	}
+	if !t.Created.IsZero() {
+		words = append(words, t.Created.Format("2006-01-02"))
+	}
+	if t.Text != "" {
+		words = append(words, t.Text)
+	}
+	if t.Project != "" {
+		words = append(words, "+"+t.Project)
+	}
+	for _, tag := range t.Tags {
+		words = append(words, "@"+tag)
+	}
+	if !t.Due.IsZero() {
+		words = append(words, "due:"+t.Due.Format("2006-01-02"))
+	}
+	if t.Recur != "" {
+		words = append(words, "rec:"+t.Recur)
+	}
+	if !t.Completed.IsZero() && pri != "" {
+		words = append(words, "pri:"+pri)
+	}
+	if ids {
+		words = append(words, "uid:"+t.UID, "modified:"+modTime(t).UTC().Format(time.RFC3339))
+	}
+	return strings.Join(words, " ")
+}
+
+// readTodoTxt reads tasks from todo.txt lines, the way
+// todoTxtLine writes them. A +project past the first, and
+// key:value pairs task doesn't know, are kept in the text.
+func readTodoTxt(r io.Reader) ([]Task, error) {
+	var tasks []Task
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		t, err := parseTodoTxt(s.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, s.Err()
+}
+
+func parseTodoTxt(line string) (Task, error) {
+	var t Task
+	words := strings.Fields(line)
+	date := func() (time.Time, bool) {
+		if len(words) == 0 {
+			return time.Time{}, false
+		}
+		d, err := time.ParseInLocation("2006-01-02", words[0], time.Local)
+		if err != nil {
+			return time.Time{}, false
+		}
+		words = words[1:]
+		return d, true
+	}
+
+	if len(words) > 0 && words[0] == "x" {
+		words = words[1:]
+		t.Completed, _ = date()
+		if t.Completed.IsZero() {
+			return t, fmt.Errorf("a done task needs the date it was done")
+		}
+	} else if len(words) > 0 && len(words[0]) == 3 && words[0][0] == '(' && words[0][2] == ')' {
+		t.Priority = todoPriority(words[0][1:2])
+		words = words[1:]
+	}
+	t.Created, _ = date()
+
+	var rest []string
+	for _, w := range words {
+		key, val := splitField(w)
+		var err error
+		switch {
+		case strings.HasPrefix(w, "+") && len(w) > 1 && t.Project == "":
+			t.Project = strings.ToLower(w[1:])
+		case strings.HasPrefix(w, "@") && len(w) > 1:
+			t.Tags = appendTag(t.Tags, strings.ToLower(w[1:]))
+		case key == "due" && val != "":
+			t.Due, err = time.ParseInLocation("2006-01-02", val, time.Local)
+		case key == "rec" && val != "":
+			_, err = parseRecur(strings.TrimPrefix(val, "+"))
+			t.Recur = strings.ToLower(strings.TrimPrefix(val, "+"))
+		case key == "pri" && val != "":
+			t.Priority = todoPriority(strings.ToUpper(val))
+		case key == "uid" && val != "":
+			t.UID = val
+		case key == "modified" && val != "":
+			t.Modified, err = time.Parse(time.RFC3339, val)
+		default:
+			rest = append(rest, w)
+		}
+		if err != nil {
+			return t, fmt.Errorf("reading %s: %s", w, err)
+		}
+	}
+	t.Text = strings.Join(rest, " ")
+	return t, nil
+}
+
+var csvHeader = []string{"uid", "text", "project", "tags", "priority", "due", "recur", "created", "completed", "modified"}
+
+// writeCSV writes tasks as CSV, with a header row. Tags are
+// separated by spaces, due dates are written as dates and
+// the other times in RFC 3339.
+func writeCSV(w io.Writer, tasks []Task) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	for _, t := range tasks {
+		due := ""
+		if !t.Due.IsZero() {
+			due = t.Due.Format("2006-01-02")
+		}
+		cw.Write([]string{
+			t.UID, t.Text, t.Project, strings.Join(t.Tags, " "), t.Priority.String(),
+			due, t.Recur, csvTime(t.Created), csvTime(t.Completed), csvTime(t.Modified),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// readCSV reads tasks written by writeCSV. Columns are found by
+// the header, so ones that are missing or moved are fine.
+func readCSV(r io.Reader) ([]Task, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	col := make(map[string]int)
+	for i, name := range rows[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := col["text"]; !ok {
+		return nil, fmt.Errorf("no text column")
+	}
+
+	var tasks []Task
+	for n, row := range rows[1:] {
+		get := func(name string) string {
+			if i, ok := col[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		var t Task
+		var err error
+		t.UID, t.Text, t.Project = get("uid"), get("text"), strings.ToLower(get("project"))
+		for _, tag := range strings.Fields(strings.ToLower(get("tags"))) {
+			t.Tags = appendTag(t.Tags, tag)
+		}
+		if p := get("priority"); p != "" {
+			var ok bool
+			if t.Priority, ok = priorityNames[strings.ToLower(p)]; !ok {
+				return nil, fmt.Errorf("row %d: '%s' isn't a priority", n+2, p)
+			}
+		}
+		if t.Recur = strings.ToLower(get("recur")); t.Recur != "" {
+			_, err = parseRecur(t.Recur)
+		}
+		if d := get("due"); d != "" && err == nil {
+			t.Due, err = time.ParseInLocation("2006-01-02", d, time.Local)
+		}
+		for _, f := range []struct {
+			name string
+			t    *time.Time
+		}{{"created", &t.Created}, {"completed", &t.Completed}, {"modified", &t.Modified}} {
+			if s := get(f.name); s != "" && err == nil {
+				*f.t, err = time.Parse(time.RFC3339, s)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %s", n+2, err)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_todoTxt(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 6, d, 0, 0, 0, 0, time.Local) }
+	tests := []struct {
+		line string
+		task Task
+		same bool // whether the task is written as the same line
+	}{
+		{"(A) 2020-06-01 pay rent +house @home @money due:2020-06-12 rec:1m",
+			Task{Text: "pay rent", Project: "house", Tags: []string{"home", "money"}, Priority: PriorityHigh, Due: day(12), Recur: "1m", Created: day(1)}, true},
+		{"x 2020-06-11 2020-06-01 pay rent +house pri:B",
+			Task{Text: "pay rent", Project: "house", Priority: PriorityMedium, Created: day(1), Completed: day(11)}, true},
+		{"(C) call mum", Task{Text: "call mum", Priority: PriorityLow}, true},
+		{"read about +go and +rust url:http://example.com",
+			Task{Text: "read about and +rust url:http://example.com", Project: "go"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := parseTodoTxt(tt.line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.task) {
+				t.Errorf("parseTodoTxt() = %+v, want %+v", got, tt.task)
+			}
+			if line := todoTxtLine(tt.task, false); tt.same && line != tt.line {
+				t.Errorf("todoTxtLine() = %q, want %q", line, tt.line)
+			}
+		})
+	}
+
+	got, _ := parseTodoTxt("(D) low one")
+	if got.Priority != PriorityLow {
+		t.Errorf("(D) priority = %v, want low", got.Priority)
+	}
+	for _, line := range []string{"x done without a date", "bad due:friday", "bad rec:sometimes"} {
+		if _, err := parseTodoTxt(line); err == nil {
+			t.Errorf("parseTodoTxt(%q) should be an error", line)
+		}
+	}
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	mod := time.Date(2020, 6, 10, 9, 30, 0, 0, time.UTC)
+	tasks := []Task{
+		{UID: "a1", Text: "pay rent, again", Project: "house", Tags: []string{"home"}, Priority: PriorityHigh,
+			Due: time.Date(2020, 6, 12, 0, 0, 0, 0, time.Local), Recur: "mon,thu",
+			Created: time.Date(2020, 6, 1, 0, 0, 0, 0, time.Local), Modified: mod},
+		{UID: "b2", Text: "call mum", Created: time.Date(2020, 6, 2, 0, 0, 0, 0, time.Local),
+			Completed: time.Date(2020, 6, 3, 0, 0, 0, 0, time.Local), Modified: mod},
+	}
+	for _, format := range []string{FormatTodoTxt, FormatJSON, FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeTasks(&buf, tasks, format, true); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readTasks(&buf, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// compare as JSON, as times read back
+			// can be in another *time.Location
+			g, _ := json.Marshal(got)
+			w, _ := json.Marshal(tasks)
+			if string(g) != string(w) {
+				t.Errorf("round trip =\n%s\nwant\n%s", g, w)
+			}
+		})
+	}
+}
+
+func Test_formatFor(t *testing.T) {
+	tests := []struct {
+		format, path, want string
+	}{
+		{"", "todo.txt", FormatTodoTxt},
+		{"", "tasks.JSON", FormatJSON},
+		{"", "tasks.csv", FormatCSV},
+		{"", "", FormatTodoTxt},
+		{"csv", "tasks.json", FormatCSV},
+		{"txt", "", FormatTodoTxt},
+		{"xml", "", ""},
+	}
+	for _, tt := range tests {
+		got, err := formatFor(tt.format, tt.path)
+		if got != tt.want || (err != nil) != (tt.want == "") {
+			t.Errorf("formatFor(%q, %q) = %q, %v, want %q", tt.format, tt.path, got, err, tt.want)
+		}
+	}
+}
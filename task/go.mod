@@ -4,7 +4,10 @@ go 1.13
 
 require (
 	github.com/boltdb/bolt v1.3.1
+	github.com/gdamore/tcell v1.4.0
+	github.com/mattn/go-runewidth v0.0.7
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.3
 	github.com/spf13/viper v1.7.0
 )
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat string
+	exportFormat string
+	exportOut    string
+	syncFormat   string
+)
+
+// importCmd represents the import command
+var importCmd = &cobra.Command{
+	Use:   "import <file>",
+	Short: "Add tasks from a todo.txt, JSON or CSV file",
+	Long: `Add tasks from a todo.txt, JSON or CSV file, or - for stdin.
+The format goes by the file's extension unless --format is given.
+Done tasks go to your completed tasks, and tasks already on your
+list, with the same text, project, tags and due date, are skipped.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := formatFor(importFormat, args[0])
+		if err != nil {
+			return err
+		}
+		tasks, err := readTaskFile(args[0], format)
+		if err != nil {
+			return err
+		}
+		added, skipped, err := ImportTasks(tasks)
+		if err != nil {
+			return fmt.Errorf("importing tasks: %s", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "imported %s from %s", plural(len(added), "task"), args[0])
+		if skipped > 0 {
+			fmt.Fprintf(cmd.OutOrStdout(), ", skipped %d already on your list", skipped)
+		}
+		fmt.Fprintln(cmd.OutOrStdout())
+		return nil
+	},
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write your tasks as todo.txt, JSON or CSV",
+	Long: `Write your tasks, and the ones you've done, as todo.txt,
+JSON or CSV. Priorities, projects, tags (as todo.txt @contexts),
+due dates and when tasks were made and done are kept, so the
+file can be read back with task import.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, err := formatFor(exportFormat, exportOut)
+		if err != nil {
+			return err
+		}
+		tasks, err := AllTasks()
+		if err != nil {
+			return err
+		}
+		done, err := CompletedTasks()
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(done, func(i, j int) bool { return done[i].ID < done[j].ID })
+		tasks = append(tasks, done...)
+
+		if exportOut == "" || exportOut == "-" {
+			return writeTasks(cmd.OutOrStdout(), tasks, format, false)
+		}
+		return writeTaskFile(exportOut, func(w io.Writer) error {
+			return writeTasks(w, tasks, format, false)
+		})
+	},
+}
+
+func init() {
+	importCmd.Flags().StringVar(&importFormat, "format", "", "todo.txt, json or csv (default from the file's extension)")
+	exportCmd.Flags().StringVar(&exportFormat, "format", "", "todo.txt, json or csv (default from the file's extension, or todo.txt)")
+	exportCmd.Flags().StringVarP(&exportOut, "output", "o", "", "file to write to (default is stdout)")
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(exportCmd)
+}
+
+// readTaskFile reads tasks from a file, or stdin for -.
+func readTaskFile(path, format string) ([]Task, error) {
+	if path == "-" {
+		return readTasks(os.Stdin, format)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tasks, err := readTasks(f, format)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %s", path, err)
+	}
+	return tasks, nil
+}
+
+// writeTaskFile writes a file with fn, to a temp file that's
+// renamed over it once it's written, so it's never half done.
+func writeTaskFile(path string, fn func(io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := fn(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,47 +1,254 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/spf13/cobra"
 )
 
+var (
+	listSort  string
+	listColor string
+)
+
 // listCmd represents the list command
 var listCmd = &cobra.Command{
-	Use:   "list",
+	Use:   "list [filter]",
 	Short: "List your current tasks",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		// // Open the database.
-		// db, err := bolt.Open(DB_NAME, 0600, &bolt.Options{Timeout: 1 * time.Second})
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-		// defer db.Close()
-
-		// // View the contents of the database.
-		// err = db.Update(func(tx *bolt.Tx) error { // why am I using Update only to view tasks, not update them?
-
-		// 	b := tx.Bucket([]byte(DB_BUCKET))
-
-		// 	// List the tasks.
-		// 	fmt.Println("You have the following tasks:")
-		// 	count := 1
-		// 	c := b.Cursor()
-		// 	for k, _ := c.First(); k != nil; k, _ = c.Next() {
-		// 		fmt.Printf("%d. %s\n", count, k)
-		// 		count++
-		// 	}
-		// 	if count == 1 {
-		// 		fmt.Println("...no tasks for now!")
-		// 	}
-
-		// 	return nil
-		// })
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
+	Long: `List your current tasks. Tasks can be filtered by +tag,
+project:name, p:priority, due:date, overdue, or words of their
+text, and sorted by due date or priority. Tasks keep the numbers
+they have in the full list, so do and rm work on them as shown.`,
+	Example: `  task list +home
+  task list due:today
+  task list overdue --sort priority`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		today := now()
+		filter, err := parseFilter(args, today)
+		if err != nil {
+			return err
+		}
+		colors, err := useColor(listColor, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		tasks, err := AllTasks()
+		if err != nil {
+			return err
+		}
+
+		// Number the tasks before they're filtered and sorted.
+		var shown []numberedTask
+		for i, t := range tasks {
+			if filter.match(t, today) {
+				shown = append(shown, numberedTask{i + 1, t})
+			}
+		}
+		if err := sortTasks(shown, listSort); err != nil {
+			return err
+		}
+
+		// List the tasks.
+		out := cmd.OutOrStdout()
+		switch {
+		case len(tasks) == 0:
+			fmt.Fprintln(out, "...no tasks for now!")
+			return nil
+		case len(shown) == 0:
+			fmt.Fprintf(out, "...no tasks match '%s'\n", strings.Join(args, " "))
+			return nil
+		}
+		fmt.Fprintln(out, "You have the following tasks:")
+		for _, t := range shown {
+			line := fmt.Sprintf("%d. %s", t.n, t.Task)
+			switch {
+			case !colors:
+			case t.Overdue(today):
+				line = colorRed + line + colorReset
+			case t.Due.Equal(startOfDay(today)):
+				line = colorYellow + line + colorReset
+			}
+			fmt.Fprintln(out, line)
+		}
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVar(&listSort, "sort", "added", "sort by added, due or priority")
+	listCmd.Flags().StringVar(&listColor, "color", "auto", "highlight overdue tasks: auto, always or never")
+}
+
+// numberedTask is a task with its number in the full list.
+type numberedTask struct {
+	n int
+	Task
+}
+
+// taskFilter picks the tasks task list shows. A task matches
+// if it has all the filter's tags, its project, priority and
+// due day, and all the words of its text.
+type taskFilter struct {
+	Task
+	overdue bool
+}
+
+// parseFilter parses filter arguments, which are written the
+// same way as a task, plus the word overdue.
+func parseFilter(args []string, now time.Time) (taskFilter, error) {
+	var f taskFilter
+	var words []string
+	for _, arg := range args {
+		if strings.ToLower(arg) == "overdue" {
+			f.overdue = true
+			continue
+		}
+		words = append(words, arg)
+	}
+	var err error
+	f.Task, err = parseTask(strings.Join(words, " "), now)
+	return f, err
+}
+
+func (f taskFilter) match(t Task, now time.Time) bool {
+	if f.overdue && !t.Overdue(now) {
+		return false
+	}
+	if f.Project != "" && f.Project != t.Project {
+		return false
+	}
+	if f.Priority != PriorityNone && f.Priority != t.Priority {
+		return false
+	}
+	if !f.Due.IsZero() && !f.Due.Equal(t.Due) {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !hasTag(t, tag) {
+			return false
+		}
+	}
+	text := strings.ToLower(t.Text)
+	for _, w := range strings.Fields(strings.ToLower(f.Text)) {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasTag(t Task, tag string) bool {
+	for _, tt := range t.Tags {
+		if tt == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// sortTasks sorts tasks by the order they were added, their
+// due date, soonest first, or their priority, highest first.
+// Ties are broken by the other of due date and priority, then
+// by the order the tasks were added.
+func sortTasks(tasks []numberedTask, by string) error {
+	byDue := func(a, b Task) int {
+		switch {
+		case a.Due.Equal(b.Due):
+			return 0
+		case b.Due.IsZero(), !a.Due.IsZero() && a.Due.Before(b.Due):
+			return -1
+		}
+		return 1
+	}
+	byPriority := func(a, b Task) int {
+		return int(b.Priority) - int(a.Priority)
+	}
+
+	var order []func(a, b Task) int
+	switch by {
+	case "added", "":
+		return nil
+	case "due":
+		order = append(order, byDue, byPriority)
+	case "priority":
+		order = append(order, byPriority, byDue)
+	default:
+		return fmt.Errorf("can't sort by '%s', use added, due or priority", by)
+	}
+	sort.SliceStable(tasks, func(i, j int) bool {
+		for _, cmp := range order {
+			if c := cmp(tasks[i].Task, tasks[j].Task); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+const (
+	colorRed    = "\x1b[31m"
+	colorYellow = "\x1b[33m"
+	colorReset  = "\x1b[0m"
+)
+
+// useColor decides whether to colour output to w. With auto,
+// it's coloured when w is a terminal and NO_COLOR isn't set.
+func useColor(mode string, w io.Writer) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		f, ok := w.(*os.File)
+		if !ok {
+			return false, nil
+		}
+		fi, err := f.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("--color must be auto, always or never, not '%s'", mode)
+}
+
+// tasksByNumber looks up tasks by the numbers task list
+// shows them with. All the numbers are checked before any
+// task is returned, so a typo doesn't act on half the list.
+func tasksByNumber(args []string) ([]Task, error) {
+	tasks, err := AllTasks()
+	if err != nil {
+		return nil, err
+	}
+	return pickByNumber(tasks, args)
+}
+
+// pickByNumber picks tasks out of a list by their 1-based
+// positions in it.
+func pickByNumber(tasks []Task, args []string) ([]Task, error) {
+	var picked []Task
+	seen := make(map[int]bool)
+	for _, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' isn't a task number", arg)
+		}
+		if n < 1 || n > len(tasks) {
+			return nil, fmt.Errorf("no task number %d", n)
+		}
+		if !seen[n] {
+			seen[n] = true
+			picked = append(picked, tasks[n-1])
+		}
+	}
+	return picked, nil
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestListFilters(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))() // a Wednesday
+
+	for _, task := range []string{
+		"pay rent due:friday +home p:high",
+		"water plants due:today +home",
+		"file taxes due:yesterday p:medium project:money",
+		"read a book p:low",
+	} {
+		if err, _ := runTask("add", task); err != nil {
+			t.Fatalf("add %q: %s", task, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"all", nil, `You have the following tasks:
+1. pay rent +home p:high due:2020-06-12
+2. water plants +home due:2020-06-10
+3. file taxes project:money p:medium due:2020-06-09
+4. read a book p:low
+`},
+		{"tag", []string{"+home"}, `You have the following tasks:
+1. pay rent +home p:high due:2020-06-12
+2. water plants +home due:2020-06-10
+`},
+		{"due today", []string{"due:today"}, `You have the following tasks:
+2. water plants +home due:2020-06-10
+`},
+		{"overdue", []string{"overdue"}, `You have the following tasks:
+3. file taxes project:money p:medium due:2020-06-09
+`},
+		{"text", []string{"taxes", "project:money"}, `You have the following tasks:
+3. file taxes project:money p:medium due:2020-06-09
+`},
+		{"sort due", []string{"--sort", "due"}, `You have the following tasks:
+3. file taxes project:money p:medium due:2020-06-09
+2. water plants +home due:2020-06-10
+1. pay rent +home p:high due:2020-06-12
+4. read a book p:low
+`},
+		{"sort priority", []string{"--sort", "priority"}, `You have the following tasks:
+1. pay rent +home p:high due:2020-06-12
+3. file taxes project:money p:medium due:2020-06-09
+4. read a book p:low
+2. water plants +home due:2020-06-10
+`},
+		{"no match", []string{"+work"}, "...no tasks match '+work'\n"},
+		{"color", []string{"+home", "overdue", "--color", "always"}, "...no tasks match '+home overdue'\n"},
+		{"colored", []string{"due:yesterday", "--color", "always"}, "You have the following tasks:\n" +
+			colorRed + "3. file taxes project:money p:medium due:2020-06-09" + colorReset + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := run(append([]string{"list"}, tt.args...), &out); err != nil {
+				t.Fatalf("list %v: %s", tt.args, err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("list %v =\n%s\nwant\n%s", tt.args, out.String(), tt.want)
+			}
+		})
+	}
+
+	// Numbers shown in a filtered list are the ones do takes.
+	if err, _ := runTask("do", "3"); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if err := run([]string{"list", "overdue"}, &out); err != nil || out.String() != "...no tasks match 'overdue'\n" {
+		t.Errorf("list overdue after do = %q, %v", out.String(), err)
+	}
+
+	for _, args := range [][]string{{"list", "--sort", "size"}, {"list", "--color", "sometimes"}, {"add", "due:friday"}} {
+		if err := run(args, &out); err == nil {
+			t.Errorf("%v should be an error", args)
+		}
+	}
+}
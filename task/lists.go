@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// listsCmd represents the lists command
+var listsCmd = &cobra.Command{
+	Use:   "lists",
+	Short: "Show your task lists",
+	Long: `Show your task lists and how many tasks are on each.
+Use --list with any command to work on a list other than the
+default one, which is made the first time something is added.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lists, err := Lists()
+		if err != nil {
+			return err
+		}
+
+		current := listName
+		if current == "" {
+			current = DEFAULT_LIST
+		}
+		tw := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "You have the following lists:")
+		for _, l := range lists {
+			mark := " "
+			if l.Name == current {
+				mark = "*"
+			}
+			fmt.Fprintf(tw, "%s %s\t%s\t%d done\n", mark, l.Name, plural(l.Tasks, "task"), l.Completed)
+		}
+		return tw.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listsCmd)
+}
+
+// plural returns n and the noun, with an s if n isn't 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
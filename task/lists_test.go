@@ -0,0 +1,126 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLists(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+
+	runTask("add", "walk minnie")
+	runTask("--list", "work", "add", "write report")
+	runTask("-l", "work", "add", "file expenses")
+	runTask("-l", "work", "do", "1")
+	runTask("-l", "home", "add", "fix sink")
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"default list", []string{"list"}, "You have the following tasks:\n1. walk minnie\n"},
+		{"named list", []string{"--list", "work", "list"}, "You have the following tasks:\n1. file expenses\n"},
+		{"named completed", []string{"--list", "work", "completed"}, "You've done the following tasks today:\n1. write report ("},
+		{"new list", []string{"--list", "garden", "list"}, "...no tasks for now!\n"},
+		{"lists", []string{"lists"}, `You have the following lists:
+* default  1 task  0 done
+  home     1 task  0 done
+  work     1 task  1 done
+`},
+		{"current list", []string{"-l", "home", "lists"}, `You have the following lists:
+  default  1 task  0 done
+* home     1 task  0 done
+  work     1 task  1 done
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err, got := runTask(tt.args[0], tt.args[1:]...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) < len(tt.want) || got[:len(tt.want)] != tt.want {
+				t.Errorf("%v =\n%s\nwant\n%s", tt.args, got, tt.want)
+			}
+		})
+	}
+
+	if err, _ := runTask("--list", "garden", "do", "1"); err == nil {
+		t.Error("do on an empty list should be an error")
+	}
+}
+
+func TestDBPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	inList := func(path string) bool {
+		t.Helper()
+		_, out := runTask("--db", path, "list")
+		return out == "You have the following tasks:\n1. walk minnie\n"
+	}
+
+	// The --db flag.
+	flagDB := filepath.Join(dir, "flag", "tasks.db")
+	if err, _ := runTask("--db", flagDB, "add", "walk minnie"); err != nil {
+		t.Fatal(err)
+	}
+	if !inList(flagDB) {
+		t.Errorf("task not added to %s", flagDB)
+	}
+
+	// The TASK_DB env var.
+	envDB := filepath.Join(dir, "env.db")
+	os.Setenv("TASK_DB", envDB)
+	runTask("add", "walk minnie")
+	os.Unsetenv("TASK_DB")
+	if !inList(envDB) {
+		t.Errorf("task not added to %s", envDB)
+	}
+
+	// A db in the config file.
+	cfgDB := filepath.Join(dir, "cfg.db")
+	cfg := filepath.Join(dir, "task.yaml")
+	if err := ioutil.WriteFile(cfg, []byte("db: "+cfgDB+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	runTask("--config", cfg, "add", "walk minnie")
+	ioutil.WriteFile(cfg, nil, 0600)
+	runTask("--config", cfg, "list") // forget the config again
+	if !inList(cfgDB) {
+		t.Errorf("task not added to %s", cfgDB)
+	}
+
+	if _, out := runTask("list"); out != "...no tasks for now!\n" {
+		t.Errorf("the default database got %q", out)
+	}
+}
+
+func Test_defaultDBPath(t *testing.T) {
+	old, set := os.LookupEnv("XDG_DATA_HOME")
+	defer func() {
+		if set {
+			os.Setenv("XDG_DATA_HOME", old)
+		} else {
+			os.Unsetenv("XDG_DATA_HOME")
+		}
+	}()
+
+	os.Setenv("XDG_DATA_HOME", "/data")
+	if got, want := defaultDBPath(), filepath.Join("/data", "task", DB_NAME); got != want {
+		t.Errorf("defaultDBPath() = %q, want %q", got, want)
+	}
+	os.Unsetenv("XDG_DATA_HOME")
+	want := filepath.Join(".local", "share", "task", DB_NAME)
+	if got := defaultDBPath(); !filepath.IsAbs(got) || !strings.HasSuffix(got, want) {
+		t.Errorf("defaultDBPath() = %q, want it under ~/%s", got, want)
+	}
+}
@@ -1,8 +1,5 @@
 package main
 
-import "github.com/spf13/cobra/cobra/cmd"
-
 func main() {
-	OpenDB()
-	cmd.Execute()
+	Execute()
 }
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Priority is how urgent a task is.
+type Priority int
+
+// The priorities a task can have.
+const (
+	PriorityNone Priority = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
+var priorityNames = map[string]Priority{
+	"low": PriorityLow, "l": PriorityLow,
+	"medium": PriorityMedium, "med": PriorityMedium, "m": PriorityMedium,
+	"high": PriorityHigh, "h": PriorityHigh,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityMedium:
+		return "medium"
+	case PriorityHigh:
+		return "high"
+	default:
+		return ""
+	}
+}
+
+// MarshalJSON writes a priority as its name.
+func (p Priority) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.String())
+}
+
+// UnmarshalJSON reads a priority's name, or the number
+// tasks were stored with before priorities had names.
+func (p *Priority) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		*p = Priority(n)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	if name == "" {
+		*p = PriorityNone
+		return nil
+	}
+	pri, ok := priorityNames[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("'%s' isn't a priority, use high, medium or low", name)
+	}
+	*p = pri
+	return nil
+}
+
+// parseTask parses the words of a task, like
+//
+//	pay rent due:friday +home p:high project:house
+//
+// into its text and fields. Tags are words starting with +,
+// the project is given with project:name, the priority with
+// p:high, p:medium or p:low, and the due date with due: and
+// a date parseDue understands, which may run over a few words,
+// like due:next friday or due:in 3 days. every: makes the task
+// recur, with a rule parseRecur understands.
+func parseTask(text string, now time.Time) (Task, error) {
+	var t Task
+	var rest []string
+	words := strings.Fields(text)
+	for i := 0; i < len(words); i++ {
+		w := words[i]
+		key, val := splitField(w)
+		switch {
+		case strings.HasPrefix(w, "+") && len(w) > 1:
+			t.Tags = appendTag(t.Tags, strings.ToLower(w[1:]))
+
+		case key == "project" && val != "":
+			t.Project = strings.ToLower(val)
+
+		case (key == "p" || key == "priority") && val != "":
+			p, ok := priorityNames[strings.ToLower(val)]
+			if !ok {
+				return t, fmt.Errorf("'%s' isn't a priority, use high, medium or low", val)
+			}
+			t.Priority = p
+
+		case key == "due" && val != "":
+			// take as many of the following words as still
+			// make a date, so "due:next friday" works
+			phrase, n := val, 0
+			due, err := parseDue(phrase, now)
+			for j := 1; j <= 3 && i+j < len(words); j++ {
+				longer := phrase + " " + strings.Join(words[i+1:i+j+1], " ")
+				if d, lerr := parseDue(longer, now); lerr == nil {
+					due, n, err = d, j, nil
+				}
+			}
+			if err != nil {
+				return t, err
+			}
+			t.Due = due
+			i += n
+
+		case key == "every" && val != "":
+			if _, err := parseRecur(val); err != nil {
+				return t, err
+			}
+			t.Recur = strings.ToLower(val)
+
+		default:
+			rest = append(rest, w)
+		}
+	}
+	t.Text = strings.Join(rest, " ")
+
+	// a recurring task without a due date is first due
+	// the first day its rule gives, from today
+	if t.Recur != "" && t.Due.IsZero() {
+		r, _ := parseRecur(t.Recur)
+		t.Due = r.first(startOfDay(now))
+	}
+	return t, nil
+}
+
+// splitField splits a word like key:value.
+func splitField(w string) (key, val string) {
+	i := strings.Index(w, ":")
+	if i < 0 {
+		return "", ""
+	}
+	return strings.ToLower(w[:i]), w[i+1:]
+}
+
+func appendTag(tags []string, tag string) []string {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
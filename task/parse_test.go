@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseTask(t *testing.T) {
+	now := time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local) // a Wednesday
+	day := func(d int) time.Time { return time.Date(2020, 6, d, 0, 0, 0, 0, time.Local) }
+
+	tests := []struct {
+		text    string
+		want    Task
+		wantErr bool
+	}{
+		{"pay rent due:friday +home p:high", Task{Text: "pay rent", Tags: []string{"home"}, Priority: PriorityHigh, Due: day(12)}, false},
+		{"pay rent +Home +money project:House +", Task{Text: "pay rent +", Project: "house", Tags: []string{"home", "money"}}, false},
+		{"call mum due:next friday please", Task{Text: "call mum please", Due: day(19)}, false},
+		{"call mum due:in 3 days", Task{Text: "call mum", Due: day(13)}, false},
+		{"call mum due:tomorrow p:m", Task{Text: "call mum", Priority: PriorityMedium, Due: day(11)}, false},
+		{"water plants every:Mon,Thu", Task{Text: "water plants", Recur: "mon,thu", Due: day(11)}, false},
+		{"gym every:3d due:friday", Task{Text: "gym", Recur: "3d", Due: day(12)}, false},
+		{"gym every:sometimes", Task{}, true},
+		{"ratio 1:2", Task{Text: "ratio 1:2"}, false},
+		{"call mum due:someday", Task{}, true},
+		{"call mum p:urgent", Task{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := parseTask(tt.text, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTask() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTask() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parseDue(t *testing.T) {
+	now := time.Date(2020, 6, 10, 21, 30, 0, 0, time.Local) // a Wednesday
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"today", "2020-06-10"},
+		{"tomorrow", "2020-06-11"},
+		{"yesterday", "2020-06-09"},
+		{"wed", "2020-06-10"},
+		{"friday", "2020-06-12"},
+		{"Monday", "2020-06-15"},
+		{"next friday", "2020-06-19"},
+		{"next-wed", "2020-06-17"},
+		{"next week", "2020-06-15"},
+		{"next month", "2020-07-01"},
+		{"eow", "2020-06-14"},
+		{"end-of-month", "2020-06-30"},
+		{"3d", "2020-06-13"},
+		{"+2w", "2020-06-24"},
+		{"in 1 month", "2020-07-10"},
+		{"in-10-days", "2020-06-20"},
+		{"2020-06-01", "2020-06-01"},
+		{"jun 12", "2020-06-12"},
+		{"1 june", "2021-06-01"},
+		{"someday", ""},
+		{"3x", ""},
+		{"next", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseDue(tt.in, now)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("parseDue(%q) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDue(%q): %s", tt.in, err)
+			}
+			if s := got.Format("2006-01-02 15:04"); s != tt.want+" 00:00" {
+				t.Errorf("parseDue(%q) = %s, want %s", tt.in, s, tt.want)
+			}
+		})
+	}
+}
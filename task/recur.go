@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrence is how often a task comes back: every n days,
+// weeks, months or years, or on certain days of the week.
+type recurrence struct {
+	n    int
+	unit byte // d, w, m or y, or 0 for days of the week
+	days [7]bool
+}
+
+var recurUnits = map[string]string{
+	"day": "1d", "daily": "1d",
+	"week": "1w", "weekly": "1w",
+	"month": "1m", "monthly": "1m",
+	"year": "1y", "yearly": "1y",
+	"weekday": "mon,tue,wed,thu,fri", "weekdays": "mon,tue,wed,thu,fri",
+	"weekend": "sat,sun", "weekends": "sat,sun",
+}
+
+// parseRecur parses a rule like 3d, 2w, 1m, 1y, daily, weekly,
+// monthly, yearly, weekdays, or a list of days like mon,thu.
+func parseRecur(rule string) (recurrence, error) {
+	var r recurrence
+	s := strings.ToLower(rule)
+	if alias, ok := recurUnits[s]; ok {
+		s = alias
+	}
+
+	if len(s) >= 2 {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err == nil {
+			unit := s[len(s)-1]
+			if n < 1 || !strings.ContainsRune("dwmy", rune(unit)) {
+				return r, fmt.Errorf("can't understand every:%s, try every:3d, every:2w or every:mon,thu", rule)
+			}
+			r.n, r.unit = n, unit
+			return r, nil
+		}
+	}
+
+	for _, day := range strings.Split(s, ",") {
+		wd, ok := weekdays[day]
+		if !ok {
+			return r, fmt.Errorf("can't understand every:%s, try every:3d, every:2w or every:mon,thu", rule)
+		}
+		r.days[wd] = true
+	}
+	return r, nil
+}
+
+// after returns the next time the task is due after day.
+func (r recurrence) after(day time.Time) time.Time {
+	switch r.unit {
+	case 'd':
+		return day.AddDate(0, 0, r.n)
+	case 'w':
+		return day.AddDate(0, 0, 7*r.n)
+	case 'm':
+		return day.AddDate(0, r.n, 0)
+	case 'y':
+		return day.AddDate(r.n, 0, 0)
+	}
+	for i := 1; i <= 7; i++ {
+		if d := day.AddDate(0, 0, i); r.days[d.Weekday()] {
+			return d
+		}
+	}
+	return day
+}
+
+// first returns the first day on or after today the task is due.
+func (r recurrence) first(today time.Time) time.Time {
+	if r.unit == 0 && !r.days[today.Weekday()] {
+		return r.after(today)
+	}
+	return today
+}
+
+// nextDue returns when a recurring task done on now is next
+// due: the first time the rule gives after its last due date
+// that's also after today, so a task done late doesn't come
+// back already overdue.
+func nextDue(rule string, due, now time.Time) (time.Time, error) {
+	r, err := parseRecur(rule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	today := startOfDay(now)
+	if due.IsZero() {
+		due = today
+	}
+	next := r.after(due)
+	for !next.After(today) {
+		next = r.after(next)
+	}
+	return next, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func Test_nextDue(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 6, d, 0, 0, 0, 0, time.Local) }
+	wed := day(10).Add(15 * time.Hour)
+
+	tests := []struct {
+		name string
+		rule string
+		due  time.Time
+		now  time.Time
+		want time.Time
+	}{
+		{"on time", "3d", day(10), wed, day(13)},
+		{"early", "3d", day(12), wed, day(15)},
+		{"late", "3d", day(5), wed, day(11)},
+		{"no due date", "1w", time.Time{}, wed, day(17)},
+		{"monthly", "monthly", day(10), wed, time.Date(2020, 7, 10, 0, 0, 0, 0, time.Local)},
+		{"days", "mon,thu", day(8), day(8), day(11)},
+		{"days late", "mon,thu", day(8), wed, day(11)},
+		{"days wrap", "mon,thu", day(11), day(11), day(15)},
+		{"weekdays", "weekdays", day(12), day(12), day(15)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextDue(tt.rule, tt.due, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("nextDue(%q, %v) = %v, want %v", tt.rule, tt.due, got, tt.want)
+			}
+		})
+	}
+
+	for _, rule := range []string{"0d", "3x", "mon,funday", ""} {
+		if _, err := parseRecur(rule); err == nil {
+			t.Errorf("parseRecur(%q) should be an error", rule)
+		}
+	}
+}
+
+func TestDoRecurring(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	wed := time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local)
+	reset := setClock(wed)
+
+	if err, _ := runTask("add", "water plants every:mon,thu"); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := runTask("add", "take bins out"); err != nil {
+		t.Fatal(err)
+	}
+	reset()
+
+	// Done a day late, on Friday.
+	defer setClock(wed.AddDate(0, 0, 2))()
+	err, got := runTask("do", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "hooray! you've done it: 'water plants due:2020-06-11 every:mon,thu'. moving it to your completed tasks\nit's next due Mon Jun 15\n"
+	if got != want {
+		t.Errorf("do = %q, want %q", got, want)
+	}
+
+	var out bytes.Buffer
+	run([]string{"list"}, &out)
+	want = "You have the following tasks:\n1. take bins out\n2. water plants due:2020-06-15 every:mon,thu\n"
+	if out.String() != want {
+		t.Errorf("list = %q, want %q", out.String(), want)
+	}
+
+	// Done instances are kept, and undoing one takes
+	// back the task made to replace it.
+	out.Reset()
+	run([]string{"completed"}, &out)
+	want = "You've done the following tasks today:\n1. water plants due:2020-06-11 every:mon,thu (Fri Jun 12 09:00)\n"
+	if out.String() != want {
+		t.Errorf("completed = %q, want %q", out.String(), want)
+	}
+	if err, _ := runTask("undo", "1"); err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	run([]string{"list"}, &out)
+	want = "You have the following tasks:\n1. water plants due:2020-06-11 every:mon,thu\n2. take bins out\n"
+	if out.String() != want {
+		t.Errorf("list after undo = %q, want %q", out.String(), want)
+	}
+}
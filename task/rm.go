@@ -16,51 +16,30 @@ limitations under the License.
 package main
 
 import (
-	"strings"
+	"fmt"
 
 	"github.com/spf13/cobra"
 )
 
 // rmCmd represents the rm command
 var rmCmd = &cobra.Command{
-	Use:   "rm",
+	Use:   "rm <number>...",
 	Short: "Remove a task",
-	Run: func(cmd *cobra.Command, args []string) {
-		if len(args) == 0 {
-			return
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		tasks, err := tasksByNumber(args)
+		if err != nil {
+			return err
 		}
 
-		task := strings.Join(args, " ")
-		_ = task
-
-		// // Open the database.
-		// db, err := bolt.Open(DB_NAME, 0600, &bolt.Options{Timeout: 1 * time.Second})
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-		// defer db.Close()
-
-		// // Delete the task from the database.
-		// err = db.Update(func(tx *bolt.Tx) error {
-
-		// 	b := tx.Bucket([]byte(DB_BUCKET))
-
-		// 	// If the task doesn't exist, return an error.
-		// 	if ok := b.Get([]byte(task)); ok == nil {
-		// 		return fmt.Errorf("task '%s' not in task list", task)
-		// 	}
-
-		// 	if err := b.Delete([]byte(task)); err != nil {
-		// 		return fmt.Errorf("remove from database error: %s", err)
-		// 	}
-
-		// 	fmt.Printf("removed '%s' from your task list\n", task)
-		// 	return nil
-		// })
-		// if err != nil {
-		// 	log.Fatal(err)
-		// }
-
+		// Delete the tasks from the database.
+		for _, t := range tasks {
+			if err := DeleteTask(t.ID); err != nil {
+				return fmt.Errorf("remove from database error: %s", err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "removed '%s' from your task list\n", t)
+		}
+		return nil
 	},
 }
 
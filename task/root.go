@@ -2,9 +2,11 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/viper"
@@ -13,28 +15,55 @@ import (
 var cfgFile string
 
 const (
-	DB_NAME   = "tasks.db"
-	DB_BUCKET = "TaskBucket"
+	DB_NAME          = "tasks.db"
+	DB_BUCKET        = "TaskBucket"
+	COMPLETED_BUCKET = "CompletedBucket"
+	SYNC_BUCKET      = "SyncBucket"
+	DEFAULT_LIST     = "default"
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "task",
-	Short: "task is a CLI for managing TODOs.",
-	Long:  ``,
+	Use:           "task",
+	Short:         "task is a CLI for managing TODOs.",
+	Long:          ``,
+	SilenceUsage:  true,
+	SilenceErrors: true,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return OpenDB(configure())
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// run runs the command line args, writing output to out,
+// and closes the database afterwards. Flags start from their
+// defaults each time, so it can be called more than once.
+func run(args []string, out io.Writer) error {
+	defer CloseDB()
+	resetFlags(rootCmd)
+	rootCmd.SetArgs(args)
+	rootCmd.SetOut(out)
+	return rootCmd.Execute()
+}
+
 func init() {
 	cobra.OnInitialize(initConfig)
+
+	// The database and list can also be set with db and list in
+	// the config file, or the TASK_DB and TASK_LIST env vars.
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.task.yaml)")
+	rootCmd.PersistentFlags().String("db", "", "database file (default is $XDG_DATA_HOME/task/tasks.db)")
+	rootCmd.PersistentFlags().StringP("list", "l", "", "task list to use (default is the default list)")
+	viper.BindPFlag("db", rootCmd.PersistentFlags().Lookup("db"))
+	viper.BindPFlag("list", rootCmd.PersistentFlags().Lookup("list"))
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -55,10 +84,37 @@ func initConfig() {
 		viper.SetConfigName(".task")
 	}
 
+	viper.SetEnvPrefix("task")
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
+	}
+}
+
+// configure sets the list from the config, and returns
+// the path of the database to open.
+func configure() string {
+	listName = viper.GetString("list")
+	if path := viper.GetString("db"); path != "" {
+		return path
+	}
+	return dbPath
+}
+
+// resetFlags sets the flags of cmd and its subcommands
+// back to their defaults.
+func resetFlags(cmd *cobra.Command) {
+	reset := func(f *pflag.Flag) {
+		if f.Changed {
+			f.Value.Set(f.DefValue)
+			f.Changed = false
+		}
+	}
+	cmd.Flags().VisitAll(reset)
+	cmd.PersistentFlags().VisitAll(reset)
+	for _, c := range cmd.Commands() {
+		resetFlags(c)
 	}
 }
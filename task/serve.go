@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/spf13/cobra"
+)
+
+var serveAddr string
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve your tasks as a JSON REST API",
+	Long: `Serve your tasks as a JSON REST API:
+
+  GET    /tasks              list tasks, with ?filter= and ?sort= like task list
+  POST   /tasks              add a task, {"text": "pay rent due:friday +home"}
+  GET    /tasks/{id}         get a task
+  PUT    /tasks/{id}         change a task, with the same body as POST
+  POST   /tasks/{id}/do      mark a task done
+  DELETE /tasks/{id}         remove a task
+
+Every request can take ?list= to use a list other than the one
+task serve was started with. Tasks come with an ETag, and
+requests with If-Match only go ahead if the task hasn't changed.
+
+The database is only opened while a request is handled, so
+other task commands can be used as the server runs. A request
+that can't get at it in time gets a 503 with Retry-After.`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ln, err := net.Listen("tcp", serveAddr)
+		if err != nil {
+			return err
+		}
+		srv := &http.Server{Handler: newTaskServer(configure(), listName)}
+		fmt.Fprintf(cmd.OutOrStdout(), "serving tasks on http://%s\n", ln.Addr())
+
+		errc := make(chan error, 1)
+		go func() { errc <- srv.Serve(ln) }()
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		defer signal.Stop(stop)
+
+		select {
+		case err := <-errc:
+			return err
+		case <-stop:
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			return srv.Shutdown(ctx)
+		}
+	},
+}
+
+func init() {
+	serveCmd.Flags().StringVar(&serveAddr, "addr", ":7070", "address to serve on")
+	rootCmd.AddCommand(serveCmd)
+}
+
+// taskServer serves the tasks in a database over HTTP,
+// using the same storage functions as the commands.
+type taskServer struct {
+	path string // the database
+	list string // the list used when a request doesn't give one
+	mu   sync.Mutex
+	mux  *http.ServeMux
+}
+
+func newTaskServer(path, list string) *taskServer {
+	s := &taskServer{path: path, list: list, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/tasks", s.handleTasks)
+	s.mux.HandleFunc("/tasks/", s.handleTask)
+	return s
+}
+
+func (s *taskServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the HTTP status to send for it.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string { return e.msg }
+
+// withDB runs fn with the database open on the request's list,
+// one request at a time, and sends any error fn returns.
+func (s *taskServer) withDB(w http.ResponseWriter, r *http.Request, fn func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listName = s.list
+	if list := r.URL.Query().Get("list"); list != "" {
+		listName = list
+	}
+	err := OpenDB(s.path)
+	if err == nil {
+		err = fn()
+		CloseDB()
+	}
+	if err != nil {
+		writeError(w, err)
+	}
+}
+
+// writeError sends err as JSON, with the status that fits it.
+// A database another task command is holding is a 503, to be
+// tried again in a second.
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var herr *httpError
+	var noTask ErrNoTask
+	switch {
+	case errors.As(err, &herr):
+		status = herr.status
+	case errors.As(err, &noTask):
+		status = http.StatusNotFound
+	case err == bolt.ErrTimeout:
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "1")
+		err = errors.New("the task database is busy, try again")
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// listedTask is a task as GET /tasks lists it, with the
+// number task list shows it with.
+type listedTask struct {
+	Number int `json:"number"`
+	Task
+}
+
+// handleTasks lists and adds tasks.
+func (s *taskServer) handleTasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.withDB(w, r, func() error {
+			q := r.URL.Query()
+			today := now()
+			filter, err := parseFilter(strings.Fields(q.Get("filter")), today)
+			if err != nil {
+				return &httpError{http.StatusBadRequest, err.Error()}
+			}
+			tasks, err := AllTasks()
+			if err != nil {
+				return err
+			}
+			var shown []numberedTask
+			for i, t := range tasks {
+				if filter.match(t, today) {
+					shown = append(shown, numberedTask{i + 1, t})
+				}
+			}
+			if err := sortTasks(shown, q.Get("sort")); err != nil {
+				return &httpError{http.StatusBadRequest, err.Error()}
+			}
+			list := make([]listedTask, 0, len(shown))
+			for _, t := range shown {
+				list = append(list, listedTask{t.n, t.Task})
+			}
+			writeTagged(w, r, http.StatusOK, list)
+			return nil
+		})
+
+	case http.MethodPost:
+		in, err := readTaskInput(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		s.withDB(w, r, func() error {
+			t, err := AddToDB(in)
+			if err != nil {
+				return err
+			}
+			w.Header().Set("Location", fmt.Sprintf("/tasks/%d", t.ID))
+			writeTagged(w, r, http.StatusCreated, t)
+			return nil
+		})
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, &httpError{http.StatusMethodNotAllowed, r.Method + " isn't allowed on /tasks"})
+	}
+}
+
+// handleTask gets, changes, does or removes a task.
+func (s *taskServer) handleTask(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/tasks/"), "/")
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil || len(parts) > 2 || (len(parts) == 2 && parts[1] != "do") {
+		writeError(w, &httpError{http.StatusNotFound, "no such path " + r.URL.Path})
+		return
+	}
+
+	allow := []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+	if len(parts) == 2 {
+		allow = []string{http.MethodPost}
+	}
+	if !allowed(r.Method, allow) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		writeError(w, &httpError{http.StatusMethodNotAllowed, r.Method + " isn't allowed on " + r.URL.Path})
+		return
+	}
+
+	var in Task
+	if r.Method == http.MethodPut {
+		if in, err = readTaskInput(r); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	s.withDB(w, r, func() error {
+		t, err := GetTask(id)
+		if err != nil {
+			return err
+		}
+		if r.Method != http.MethodGet && !matchETag(r.Header.Get("If-Match"), etag(t)) {
+			return &httpError{http.StatusPreconditionFailed, "the task has changed, get it again"}
+		}
+
+		switch {
+		case r.Method == http.MethodGet:
+			writeTagged(w, r, http.StatusOK, t)
+		case r.Method == http.MethodPut:
+			if !t.Completed.IsZero() {
+				return &httpError{http.StatusConflict, "the task is done, so it can't be changed"}
+			}
+			if t, err = EditTask(id, in); err != nil {
+				return err
+			}
+			writeTagged(w, r, http.StatusOK, t)
+		case r.Method == http.MethodDelete:
+			if err := DeleteTask(id); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost:
+			if !t.Completed.IsZero() {
+				return &httpError{http.StatusConflict, "the task is already done"}
+			}
+			done, next, err := CompleteTask(id)
+			if err != nil {
+				return err
+			}
+			res := struct {
+				Done Task  `json:"done"`
+				Next *Task `json:"next,omitempty"`
+			}{Done: done}
+			if next.ID != 0 {
+				res.Next = &next
+			}
+			w.Header().Set("ETag", etag(done))
+			writeJSON(w, http.StatusOK, res)
+		}
+		return nil
+	})
+}
+
+// allowed reports whether method is one of methods.
+func allowed(method string, methods []string) bool {
+	for _, m := range methods {
+		if method == m {
+			return true
+		}
+	}
+	return false
+}
+
+// taskInput is the body of a request to add or change a task.
+// The text is read like task add reads it, and the other
+// fields, if they're given, are set on top of that.
+type taskInput struct {
+	Text     string   `json:"text"`
+	Project  string   `json:"project"`
+	Tags     []string `json:"tags"`
+	Priority Priority `json:"priority"`
+	Due      string   `json:"due"`
+	Recur    string   `json:"recur"`
+}
+
+func readTaskInput(r *http.Request) (Task, error) {
+	var in taskInput
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(&in); err != nil {
+		return Task{}, &httpError{http.StatusBadRequest, "reading the task: " + err.Error()}
+	}
+
+	bad := func(err error) (Task, error) {
+		return Task{}, &httpError{http.StatusBadRequest, err.Error()}
+	}
+	today := now()
+	t, err := parseTask(in.Text, today)
+	if err != nil {
+		return bad(err)
+	}
+	if t.Text == "" {
+		return bad(errors.New("a task needs some text"))
+	}
+	if in.Project != "" {
+		t.Project = strings.ToLower(in.Project)
+	}
+	for _, tag := range in.Tags {
+		t.Tags = appendTag(t.Tags, strings.ToLower(strings.TrimPrefix(tag, "+")))
+	}
+	if in.Priority != PriorityNone {
+		t.Priority = in.Priority
+	}
+	if in.Due != "" {
+		if t.Due, err = parseDue(in.Due, today); err != nil {
+			return bad(err)
+		}
+	}
+	if in.Recur != "" {
+		r, err := parseRecur(in.Recur)
+		if err != nil {
+			return bad(err)
+		}
+		t.Recur = strings.ToLower(in.Recur)
+		if t.Due.IsZero() {
+			t.Due = r.first(startOfDay(today))
+		}
+	}
+	return t, nil
+}
+
+// writeTagged sends v as JSON with an ETag, or just
+// 304 Not Modified if the request has that ETag already.
+func writeTagged(w http.ResponseWriter, r *http.Request, status int, v interface{}) {
+	tag := etag(v)
+	w.Header().Set("ETag", tag)
+	if status == http.StatusOK && r.Header.Get("If-None-Match") != "" && matchETag(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeJSON(w, status, v)
+}
+
+// etag returns the ETag for a value sent as JSON: a hash of it,
+// so it changes whenever the value does.
+func etag(v interface{}) string {
+	b, _ := json.Marshal(v)
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchETag reports whether an If-Match or If-None-Match
+// header matches tag. A missing header or * matches anything.
+func matchETag(header, tag string) bool {
+	if header == "" || strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, t := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(t), "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
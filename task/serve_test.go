@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// request sends a request to the server, returning the response
+// and its body decoded into v, if it's not nil.
+func request(t *testing.T, srv http.Handler, method, path, body string, header map[string]string, v interface{}) *http.Response {
+	t.Helper()
+	var rd io.Reader
+	if body != "" {
+		rd = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, rd)
+	for k, val := range header {
+		req.Header.Set(k, val)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: decoding %q: %s", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Result()
+}
+
+func TestServe(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+	srv := newTaskServer(dbPath, "")
+
+	// Add tasks, from text and from fields.
+	var added Task
+	resp := request(t, srv, "POST", "/tasks", `{"text": "pay rent due:friday +home p:high"}`, nil, &added)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/tasks/1" || added.String() != "pay rent +home p:high due:2020-06-12" {
+		t.Errorf("POST /tasks = %d %q %v", resp.StatusCode, resp.Header.Get("Location"), added)
+	}
+	resp = request(t, srv, "POST", "/tasks", `{"text": "water plants", "tags": ["+garden"], "priority": "low", "recur": "3d"}`, nil, &added)
+	if resp.StatusCode != http.StatusCreated || added.String() != "water plants +garden p:low due:2020-06-10 every:3d" {
+		t.Errorf("POST /tasks with fields = %d %v", resp.StatusCode, added)
+	}
+	for _, body := range []string{`{"text": ""}`, `{"text": "x due:someday"}`, `{"text": "x", "priority": "urgent"}`, `nope`} {
+		if resp := request(t, srv, "POST", "/tasks", body, nil, nil); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("POST /tasks %s = %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	// The commands see what the server did.
+	if err, got := runTask("list"); err != nil || got != "You have the following tasks:\n1. pay rent +home p:high due:2020-06-12\n2. water plants +garden p:low due:2020-06-10 every:3d\n" {
+		t.Errorf("task list = %q, %v", got, err)
+	}
+
+	var list []listedTask
+	resp = request(t, srv, "GET", "/tasks?filter=%2Bgarden&sort=priority", "", nil, &list)
+	if resp.StatusCode != http.StatusOK || len(list) != 1 || list[0].Number != 2 || list[0].Text != "water plants" {
+		t.Errorf("GET /tasks?filter=+garden = %d %v", resp.StatusCode, list)
+	}
+	listTag := request(t, srv, "GET", "/tasks", "", nil, nil).Header.Get("ETag")
+	if resp := request(t, srv, "GET", "/tasks", "", map[string]string{"If-None-Match": listTag}, nil); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("GET /tasks with its ETag = %d, want 304", resp.StatusCode)
+	}
+	if resp := request(t, srv, "GET", "/tasks?sort=size", "", nil, nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("GET /tasks?sort=size = %d, want 400", resp.StatusCode)
+	}
+
+	// Edit with If-Match.
+	var got Task
+	resp = request(t, srv, "GET", "/tasks/1", "", nil, &got)
+	tag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || tag == "" || got.Text != "pay rent" {
+		t.Errorf("GET /tasks/1 = %d %q %v", resp.StatusCode, tag, got)
+	}
+	got = Task{}
+	resp = request(t, srv, "PUT", "/tasks/1", `{"text": "pay rent +home due:monday"}`, map[string]string{"If-Match": tag}, &got)
+	if resp.StatusCode != http.StatusOK || got.String() != "pay rent +home due:2020-06-15" || got.ID != 1 {
+		t.Errorf("PUT /tasks/1 = %d %v", resp.StatusCode, got)
+	}
+	if resp.Header.Get("ETag") == tag {
+		t.Error("the ETag didn't change with the task")
+	}
+	resp = request(t, srv, "PUT", "/tasks/1", `{"text": "pay rent"}`, map[string]string{"If-Match": tag}, nil)
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("PUT /tasks/1 with an old ETag = %d, want 412", resp.StatusCode)
+	}
+
+	// Do a recurring task.
+	var done struct {
+		Done Task  `json:"done"`
+		Next *Task `json:"next"`
+	}
+	resp = request(t, srv, "POST", "/tasks/2/do", "", nil, &done)
+	if resp.StatusCode != http.StatusOK || done.Done.Completed.IsZero() || done.Next == nil || done.Next.Due.Format("2006-01-02") != "2020-06-13" {
+		t.Errorf("POST /tasks/2/do = %d %+v", resp.StatusCode, done)
+	}
+	if resp := request(t, srv, "POST", "/tasks/2/do", "", nil, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("doing a done task = %d, want 409", resp.StatusCode)
+	}
+
+	// Remove.
+	if resp := request(t, srv, "DELETE", "/tasks/1", "", map[string]string{"If-Match": `"stale"`}, nil); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a stale ETag = %d, want 412", resp.StatusCode)
+	}
+	if resp := request(t, srv, "DELETE", "/tasks/1", "", nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE /tasks/1 = %d, want 204", resp.StatusCode)
+	}
+
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{"GET", "/tasks/1", http.StatusNotFound},
+		{"GET", "/tasks/x", http.StatusNotFound},
+		{"GET", "/tasks/3/undo", http.StatusNotFound},
+		{"PATCH", "/tasks", http.StatusMethodNotAllowed},
+		{"GET", "/tasks/3/do", http.StatusMethodNotAllowed},
+		{"DEL", "/tasks/3", http.StatusMethodNotAllowed},
+		{"PU", "/tasks/3", http.StatusMethodNotAllowed},
+		{"T", "/tasks/3", http.StatusMethodNotAllowed},
+		{"OS", "/tasks/3/do", http.StatusMethodNotAllowed},
+		{"GET", "/tasks/3", http.StatusOK},
+		{"GET", "/tasks/3?list=work", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if resp := request(t, srv, tt.method, tt.path, "", nil, nil); resp.StatusCode != tt.status {
+			t.Errorf("%s %s = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.status)
+		}
+	}
+
+	// None of the unknown methods did anything to the task.
+	var three Task
+	if request(t, srv, "GET", "/tasks/3", "", nil, &three); three.ID != 3 || !three.Completed.IsZero() {
+		t.Errorf("task 3 was done by an unknown method: %+v", three)
+	}
+}
+
+func TestServeBusy(t *testing.T) {
+	defer func(d time.Duration) { dbTimeout = d }(dbTimeout)
+	dbTimeout = 50 * time.Millisecond
+
+	// Another task command has the database.
+	held, err := bolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newTaskServer(dbPath, "")
+	resp := request(t, srv, "GET", "/tasks", "", nil, nil)
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "1" {
+		t.Errorf("GET /tasks while busy = %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+
+	held.Close()
+	if resp := request(t, srv, "GET", "/tasks", "", nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /tasks once free = %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// syncCmd represents the sync command
+var syncCmd = &cobra.Command{
+	Use:   "sync <file>",
+	Short: "Merge your tasks with a todo.txt, JSON or CSV file",
+	Long: `Merge your tasks with a todo.txt, JSON or CSV file both ways,
+so each ends up with the changes made to the other since the
+last sync. A task changed in both places keeps the most recent
+change, and one removed from either is removed from both, unless
+it was changed in the other since. A file that was synced before
+has to still be there.
+todo.txt lines get uid: and modified: to keep track of tasks.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := filepath.Abs(args[0])
+		if err != nil {
+			return err
+		}
+		format, err := formatFor(syncFormat, path)
+		if err != nil {
+			return err
+		}
+		remote, err := readTaskFile(path, format)
+		if os.IsNotExist(err) {
+			// A file that's gone isn't a file with no tasks, or
+			// syncing would remove them all here too.
+			synced, serr := SyncedBefore(path)
+			if serr != nil {
+				return serr
+			}
+			if synced {
+				return fmt.Errorf("%s was synced before but is gone, put it back or write it again with task export -o %s", args[0], args[0])
+			}
+		} else if err != nil {
+			return err
+		}
+
+		res, err := SyncTasks(path, remote, func(tasks []Task) error {
+			return writeTaskFile(path, func(w io.Writer) error {
+				return writeTasks(w, tasks, format, true)
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("syncing with %s: %s", args[0], err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "synced with %s: %s here, %s in the file\n",
+			args[0], plural(res.Here, "change"), plural(res.There, "change"))
+		return nil
+	},
+}
+
+func init() {
+	syncCmd.Flags().StringVar(&syncFormat, "format", "", "todo.txt, json or csv (default from the file's extension)")
+	rootCmd.AddCommand(syncCmd)
+}
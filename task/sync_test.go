@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_mergeTasks(t *testing.T) {
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+	at := func(h int) time.Time { return time.Date(2020, 6, 10, h, 0, 0, 0, time.Local) }
+	task := func(uid, text string, mod time.Time) Task {
+		return Task{UID: uid, Text: text, Modified: mod}
+	}
+	line := func(uid, text string) string { return todoTxtLine(task(uid, text, time.Time{}), false) }
+
+	tests := []struct {
+		name   string
+		local  []Task
+		remote []Task
+		synced map[string]string
+		want   []string // texts of the merged tasks
+		res    SyncResult
+	}{
+		{"first sync",
+			[]Task{task("a", "walk minnie", at(1))},
+			[]Task{task("b", "feed minnie", at(1))},
+			nil,
+			[]string{"walk minnie", "feed minnie"}, SyncResult{1, 1}},
+		{"nothing changed",
+			[]Task{task("a", "walk minnie", at(1))},
+			[]Task{task("a", "walk minnie", at(1))},
+			map[string]string{"a": line("a", "walk minnie")},
+			[]string{"walk minnie"}, SyncResult{}},
+		{"changed in the file",
+			[]Task{task("a", "walk minnie", at(2))},
+			[]Task{task("a", "walk minnie twice", at(1))},
+			map[string]string{"a": line("a", "walk minnie")},
+			[]string{"walk minnie twice"}, SyncResult{1, 0}},
+		{"changed here",
+			[]Task{task("a", "walk minnie twice", at(1))},
+			[]Task{task("a", "walk minnie", at(2))},
+			map[string]string{"a": line("a", "walk minnie")},
+			[]string{"walk minnie twice"}, SyncResult{0, 1}},
+		{"changed in both, file newer",
+			[]Task{task("a", "walk minnie here", at(1))},
+			[]Task{task("a", "walk minnie there", at(2))},
+			map[string]string{"a": line("a", "walk minnie")},
+			[]string{"walk minnie there"}, SyncResult{1, 0}},
+		{"changed in both, list newer",
+			[]Task{task("a", "walk minnie here", at(3))},
+			[]Task{task("a", "walk minnie there", at(2))},
+			map[string]string{"a": line("a", "walk minnie")},
+			[]string{"walk minnie here"}, SyncResult{0, 1}},
+		{"removed from the file",
+			[]Task{task("a", "walk minnie", at(1)), task("b", "feed minnie", at(1))},
+			[]Task{task("b", "feed minnie", at(1))},
+			map[string]string{"a": line("a", "walk minnie"), "b": line("b", "feed minnie")},
+			[]string{"feed minnie"}, SyncResult{1, 0}},
+		{"removed here",
+			[]Task{task("b", "feed minnie", at(1))},
+			[]Task{task("a", "walk minnie", at(1)), task("b", "feed minnie", at(1))},
+			map[string]string{"a": line("a", "walk minnie"), "b": line("b", "feed minnie")},
+			[]string{"feed minnie"}, SyncResult{0, 1}},
+		{"changed here, removed from the file",
+			[]Task{task("a", "walk minnie twice", at(2)), task("b", "feed minnie", at(1))},
+			[]Task{task("b", "feed minnie", at(1))},
+			map[string]string{"a": line("a", "walk minnie"), "b": line("b", "feed minnie")},
+			[]string{"walk minnie twice", "feed minnie"}, SyncResult{0, 1}},
+		{"changed in the file, removed here",
+			[]Task{task("b", "feed minnie", at(1))},
+			[]Task{task("a", "walk minnie twice", at(2)), task("b", "feed minnie", at(1))},
+			map[string]string{"a": line("a", "walk minnie"), "b": line("b", "feed minnie")},
+			[]string{"feed minnie", "walk minnie twice"}, SyncResult{1, 0}},
+		{"no uid in the file",
+			[]Task{task("a", "walk minnie", at(1))},
+			[]Task{task("", "Walk Minnie", time.Time{}), task("", "feed minnie", time.Time{})},
+			nil,
+			[]string{"walk minnie", "feed minnie"}, SyncResult{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, res, err := mergeTasks(tt.local, tt.remote, tt.synced)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range merged {
+				got = append(got, m.Text)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") || res != tt.res {
+				t.Errorf("mergeTasks() = %q, %+v, want %q, %+v", got, res, tt.want, tt.res)
+			}
+		})
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+
+	dir, err := ioutil.TempDir("", "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	todo := filepath.Join(dir, "todo.txt")
+	ioutil.WriteFile(todo, []byte(`(A) 2020-06-01 pay rent +house @home due:2020-06-12
+x 2020-06-09 2020-06-01 call mum pri:B
+
+walk minnie
+`), 0600)
+
+	runTask("add", "walk minnie")
+	err, got := runTask("import", todo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "imported 2 tasks from " + todo + ", skipped 1 already on your list\n"; got != want {
+		t.Errorf("import = %q, want %q", got, want)
+	}
+	if err, got = runTask("import", todo); got != "imported 0 tasks from "+todo+", skipped 3 already on your list\n" {
+		t.Errorf("second import = %q, %v", got, err)
+	}
+
+	err, got = runTask("export", "--format", "todo.txt")
+	want := `2020-06-10 walk minnie
+(A) 2020-06-01 pay rent +house @home due:2020-06-12
+x 2020-06-09 2020-06-01 call mum pri:B
+`
+	if err != nil || got != want {
+		t.Errorf("export =\n%s\nwant\n%s", got, want)
+	}
+
+	// Export as CSV to a file, and read it into another list.
+	out := filepath.Join(dir, "tasks.csv")
+	if err, _ := runTask("export", "-o", out); err != nil {
+		t.Fatal(err)
+	}
+	if err, got = runTask("--list", "copy", "import", out); err != nil || !strings.HasPrefix(got, "imported 3 tasks") {
+		t.Errorf("import csv = %q, %v", got, err)
+	}
+	if err, got = runTask("--list", "copy", "export"); got != want {
+		t.Errorf("export of the csv import =\n%s\nwant\n%s", got, want)
+	}
+
+	if err, _ := runTask("export", "--format", "xml"); err == nil {
+		t.Error("export --format xml should be an error")
+	}
+}
+
+func TestSync(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	reset := setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))
+
+	dir, err := ioutil.TempDir("", "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	todo := filepath.Join(dir, "todo.txt")
+	ioutil.WriteFile(todo, []byte("feed minnie\n"), 0600)
+
+	runTask("add", "walk minnie")
+	runTask("add", "water plants every:3d")
+	if err, got := runTask("sync", todo); err != nil || got != "synced with "+todo+": 1 change here, 2 changes in the file\n" {
+		t.Fatalf("first sync = %q, %v", got, err)
+	}
+	if err, got := runTask("sync", todo); err != nil || got != "synced with "+todo+": 0 changes here, 0 changes in the file\n" {
+		t.Errorf("second sync = %q, %v", got, err)
+	}
+	reset()
+
+	// Do one thing in the file and another here.
+	defer setClock(time.Date(2020, 6, 11, 9, 0, 0, 0, time.Local))()
+	b, _ := ioutil.ReadFile(todo)
+	var lines []string
+	for _, l := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		switch {
+		case strings.Contains(l, "walk minnie"):
+			// removed
+		case strings.HasPrefix(l, "2020-06-10 water plants"):
+			lines = append(lines, "x 2020-06-11 "+l)
+		default:
+			lines = append(lines, l)
+		}
+	}
+	ioutil.WriteFile(todo, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	runTask("add", "buy food +shop")
+
+	if err, got := runTask("sync", todo); err != nil || got != "synced with "+todo+": 2 changes here, 2 changes in the file\n" {
+		t.Errorf("third sync = %q, %v", got, err)
+	}
+	var out bytes.Buffer
+	run([]string{"list"}, &out)
+	want := "You have the following tasks:\n1. feed minnie\n2. buy food +shop\n3. water plants due:2020-06-13 every:3d\n"
+	if out.String() != want {
+		t.Errorf("list after sync = %q, want %q", out.String(), want)
+	}
+	b, _ = ioutil.ReadFile(todo)
+	for _, s := range []string{"x 2020-06-11 2020-06-10 water plants due:2020-06-10 rec:3d", "buy food @shop", "2020-06-11 water plants due:2020-06-13 rec:3d"} {
+		if !strings.Contains(string(b), s) {
+			t.Errorf("synced file doesn't have %q:\n%s", s, b)
+		}
+	}
+	if strings.Contains(string(b), "walk minnie") {
+		t.Errorf("synced file still has walk minnie:\n%s", b)
+	}
+
+	// A synced file that's gone is an error, not a file with no tasks.
+	os.Remove(todo)
+	if err, _ := runTask("sync", todo); err == nil || !strings.Contains(err.Error(), "synced before but is gone") {
+		t.Errorf("sync with a removed file = %v, want an error", err)
+	}
+	out.Reset()
+	run([]string{"list"}, &out)
+	if out.String() != want {
+		t.Errorf("list after syncing with a removed file = %q, want %q", out.String(), want)
+	}
+	if err, _ := runTask("sync", filepath.Join(dir, "new.txt")); err != nil {
+		t.Errorf("sync with a new file = %v", err)
+	}
+}
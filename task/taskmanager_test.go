@@ -3,18 +3,37 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"log"
-	"os/exec"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/boltdb/bolt"
+	homedir "github.com/mitchellh/go-homedir"
 )
 
-const (
-	DB_NAME   = "tasks.db"
-	DB_BUCKET = "TaskBucket"
-)
+func TestMain(m *testing.M) {
+	// Point the commands at a throwaway database.
+	dir, err := ioutil.TempDir("", "task")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	dbPath = filepath.Join(dir, DB_NAME)
+
+	// Keep the developer's own ~/.task.yaml and env vars out
+	// of it, or the tests would change their real tasks.
+	os.Unsetenv("TASK_DB")
+	os.Unsetenv("TASK_LIST")
+	os.Setenv("HOME", dir)
+	homedir.Reset()
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
 
 func TestAdd(t *testing.T) {
 	t.Run("normal add", func(t *testing.T) {
@@ -38,12 +57,29 @@ func TestAdd(t *testing.T) {
 		}
 
 		// Remove the test task.
-		err, _ = runTask("rm", taskName)
+		err, _ = runTask("rm", "1")
 		if err != nil {
 			t.Errorf("Error removing task '%s' from database.", taskName)
 		}
 
 	})
+
+	t.Run("duplicates are kept", func(t *testing.T) {
+		runTask("add", "feed", "minnie")
+		runTask("add", "feed", "minnie")
+		defer runTask("rm", "1", "2")
+
+		_, output := runTask("list")
+		if want := "1. feed minnie\n2. feed minnie\n"; !strings.HasSuffix(output, want) {
+			t.Errorf("list output is %q, want it to end %q", output, want)
+		}
+	})
+
+	t.Run("nothing to add", func(t *testing.T) {
+		if err, _ := runTask("add"); err == nil {
+			t.Error("Adding nothing should be an error.")
+		}
+	})
 }
 
 func TestDo(t *testing.T) {
@@ -57,7 +93,7 @@ func TestDo(t *testing.T) {
 		}
 
 		// Do the task.
-		err, _ = runTask("do", taskName)
+		err, _ = runTask("do", "1")
 		if err != nil {
 			t.Errorf("Error using do command for task '%s'.", taskName)
 		}
@@ -74,23 +110,60 @@ func TestDo(t *testing.T) {
 		}
 
 	})
-}
 
-func TestList(t *testing.T) {
-	// add 1 item
-	// test the list command
-	// delete the bucket
+	t.Run("do several", func(t *testing.T) {
+		for _, name := range []string{"one", "two", "three"} {
+			runTask("add", name)
+		}
+		defer runTask("rm", "1")
+
+		err, output := runTask("do", "1", "3")
+		if err != nil {
+			t.Fatalf("Error doing tasks 1 and 3: %s", err)
+		}
+		if !strings.Contains(output, "'one'") || !strings.Contains(output, "'three'") {
+			t.Errorf("do output is %q, should mention one and three", output)
+		}
+		if _, output := runTask("list"); !strings.HasSuffix(output, "\n1. two\n") {
+			t.Errorf("After doing 1 and 3, list output is %q, want only two left", output)
+		}
+	})
 
-	// idea: flag for test mode which "runtask" can pass in and cmd
-	//  will use the test bucket & delete it
+	t.Run("bad numbers", func(t *testing.T) {
+		runTask("add", "keep me")
+		defer runTask("rm", "1")
+
+		for _, args := range [][]string{{"2"}, {"0"}, {"one"}, {"1", "5"}} {
+			if err, _ := runTask("do", args...); err == nil {
+				t.Errorf("do %v should be an error.", args)
+			}
+		}
+		if got, _ := inDB("keep me"); !got {
+			t.Error("A failed do shouldn't remove any task.")
+		}
+	})
+}
 
+func TestList(t *testing.T) {
 	// Run list and get the results in a buffer.
-	err, output := runTask("list", "")
+	err, output := runTask("list")
 	if err != nil {
-		t.Errorf("Error adding task '%s' to database.", "")
+		t.Errorf("Error listing tasks: %s", err)
+	}
+	if want := "...no tasks for now!\n"; output != want {
+		t.Errorf("Empty list output is %q, want %q", output, want)
 	}
-	fmt.Println("output of test list operation is:", output)
 
+	runTask("add", "walk minnie")
+	runTask("add", "pay rent")
+	defer runTask("rm", "1", "2")
+	err, output = runTask("list")
+	if err != nil {
+		t.Errorf("Error listing tasks: %s", err)
+	}
+	if want := "You have the following tasks:\n1. walk minnie\n2. pay rent\n"; output != want {
+		t.Errorf("List output is %q, want %q", output, want)
+	}
 }
 
 func TestRM(t *testing.T) {
@@ -104,7 +177,7 @@ func TestRM(t *testing.T) {
 		}
 
 		// Remove the task.
-		err, _ = runTask("rm", taskName)
+		err, _ = runTask("rm", "1")
 		if err != nil {
 			t.Errorf("Error removing task '%s' from database.", taskName)
 		}
@@ -121,17 +194,71 @@ func TestRM(t *testing.T) {
 		}
 
 	})
+
+	t.Run("remove by number", func(t *testing.T) {
+		for _, name := range []string{"one", "two", "three"} {
+			runTask("add", name)
+		}
+		defer runTask("rm", "1", "2")
+
+		if err, _ := runTask("rm", "2"); err != nil {
+			t.Fatalf("Error removing task 2: %s", err)
+		}
+		if _, output := runTask("list"); !strings.HasSuffix(output, "\n1. one\n2. three\n") {
+			t.Errorf("After removing 2, list output is %q", output)
+		}
+	})
 }
 
-func runTask(subCmd, taskName string) (error, string) {
-	cmd := exec.Command("task", subCmd, taskName)
-	var out, serr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &serr
+func TestEdit(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+
+	runTask("add", "walk minnie +dog")
+	err, got := runTask("edit", "1", "walk", "minnie", "twice", "+dog", "due:friday")
+	if want := "changed 'walk minnie +dog' to 'walk minnie twice +dog due:2020-06-12'\n"; err != nil || got != want {
+		t.Errorf("edit = %q, %v, want %q", got, err, want)
+	}
+	if ok, _ := inDB("walk minnie twice"); !ok {
+		t.Error("edited task not found in the database")
+	}
+
+	for _, args := range [][]string{{"2", "walk minnie"}, {"1", "+dog"}, {"1", "walk due:someday"}} {
+		if err, _ := runTask("edit", args...); err == nil {
+			t.Errorf("edit %v should be an error", args)
+		}
+	}
+}
 
-	err := cmd.Run()
+func TestUpgradeBucket(t *testing.T) {
+	// Tasks stored the old way, as keys, become numbered tasks.
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(DB_BUCKET))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("old task"), []byte(""))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer runTask("rm", "1")
+	if _, output := runTask("list"); !strings.HasSuffix(output, "\n1. old task\n") {
+		t.Errorf("List output is %q, want the old task", output)
+	}
+}
+
+func runTask(subCmd string, args ...string) (error, string) {
+	var out bytes.Buffer
+	err := run(append([]string{subCmd}, args...), &out)
 	if err != nil {
-		fmt.Println(fmt.Sprint(err) + ":" + fmt.Sprint(serr.String()))
 		return err, ""
 	}
 	// fmt.Println(out.String()) // Prints command output if necessary.
@@ -139,32 +266,19 @@ func runTask(subCmd, taskName string) (error, string) {
 }
 
 func inDB(taskName string) (bool, error) {
-	db, err := bolt.Open(DB_NAME, 0600, &bolt.Options{Timeout: 1 * time.Second})
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer db.Close()
-
-	// Start a writable transaction.
-	tx, err := db.Begin(true)
-	if err != nil {
+	if err := OpenDB(dbPath); err != nil {
 		return false, err
 	}
-	defer tx.Rollback()
+	defer CloseDB()
 
-	// Use the transaction...
-	b := tx.Bucket([]byte(DB_BUCKET))
-	v := b.Get([]byte(taskName))
-
-	// Commit the transaction and check for an error.
-	if err := tx.Commit(); err != nil {
+	tasks, err := AllTasks()
+	if err != nil {
 		return false, err
 	}
-
-	exists := false
-	if v != nil {
-		exists = true
+	for _, t := range tasks {
+		if t.Text == taskName {
+			return true, nil
+		}
 	}
-
-	return exists, nil
+	return false, nil
 }
@@ -0,0 +1,532 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/mattn/go-runewidth"
+	"github.com/spf13/cobra"
+)
+
+// uiCmd represents the ui command
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Work on your tasks full screen",
+	Long: `Work on your tasks full screen. Move with the arrow keys or
+j and k, mark tasks done (or not) with space, add with a, edit
+with e, filter with /, change the sort with s, and quit with q.
+Filters are written like the ones task list takes. The database
+is only opened while a change is saved, so other task commands
+can be used as the ui runs.`,
+	Args: cobra.NoArgs,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		screen, err := tcell.NewScreen()
+		if err != nil {
+			return err
+		}
+		if err := screen.Init(); err != nil {
+			return err
+		}
+		defer screen.Fini()
+
+		ui, err := newTaskUI(screen, configure())
+		if err != nil {
+			return err
+		}
+		return ui.run()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(uiCmd)
+}
+
+// uiMode is what keys do in the ui: move around the list,
+// or type a task or filter.
+type uiMode int
+
+const (
+	modeList uiMode = iota
+	modeAdd
+	modeEdit
+	modeFilter
+)
+
+var uiPrompts = map[uiMode]string{
+	modeAdd:    "add: ",
+	modeEdit:   "edit: ",
+	modeFilter: "filter: ",
+}
+
+var uiSorts = []string{"added", "due", "priority"}
+
+const uiHelp = "j/k move  space done  a add  e edit  / filter  s sort  q quit"
+
+// uiItem is a task in the ui. Tasks done in the ui stay on
+// screen, so they can be undone.
+type uiItem struct {
+	Task
+	done bool
+}
+
+// taskUI is the state of the full screen ui.
+type taskUI struct {
+	path   string // the database
+	screen tcell.Screen
+	items  []uiItem
+	view   []int // indexes of the items shown, in order
+	cursor int   // index into view
+	top    int   // first row of view on screen
+
+	sortBy string
+	filter taskFilter
+	query  string
+
+	mode    uiMode
+	input   []rune
+	pos     int
+	oldText string // the filter before it was changed
+	status  string
+	failed  bool // whether status is an error
+}
+
+// newTaskUI returns a ui for the tasks on the current list
+// in the database at path, drawn on screen.
+func newTaskUI(screen tcell.Screen, path string) (*taskUI, error) {
+	ui := &taskUI{path: path, screen: screen, sortBy: uiSorts[0], status: uiHelp}
+	var tasks []Task
+	err := ui.withDB(func() (err error) {
+		tasks, err = AllTasks()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		ui.items = append(ui.items, uiItem{Task: t})
+	}
+	ui.refresh()
+	return ui, nil
+}
+
+// withDB runs fn with the database open, so it's only
+// kept from other task commands while a change is saved.
+func (ui *taskUI) withDB(fn func() error) error {
+	if err := OpenDB(ui.path); err != nil {
+		return err
+	}
+	defer CloseDB()
+	return fn()
+}
+
+// run draws the ui and handles events until it's quit.
+func (ui *taskUI) run() error {
+	for {
+		ui.draw()
+		switch ev := ui.screen.PollEvent().(type) {
+		case *tcell.EventKey:
+			if !ui.handleKey(ev) {
+				return nil
+			}
+		case *tcell.EventResize:
+			ui.screen.Sync()
+		case nil:
+			return nil
+		}
+	}
+}
+
+// handleKey acts on a key, returning false once the ui is quit.
+func (ui *taskUI) handleKey(ev *tcell.EventKey) bool {
+	if ev.Key() == tcell.KeyCtrlC {
+		return false
+	}
+	if ui.mode != modeList {
+		ui.handleInput(ev)
+		return true
+	}
+
+	ui.setStatus(uiHelp, nil)
+	switch ev.Key() {
+	case tcell.KeyUp:
+		ui.move(-1)
+	case tcell.KeyDown:
+		ui.move(1)
+	case tcell.KeyPgUp:
+		ui.move(-ui.rows())
+	case tcell.KeyPgDn:
+		ui.move(ui.rows())
+	case tcell.KeyHome:
+		ui.move(-len(ui.view))
+	case tcell.KeyEnd:
+		ui.move(len(ui.view))
+	case tcell.KeyEnter:
+		ui.toggle()
+	case tcell.KeyEscape:
+		if ui.query == "" {
+			return false
+		}
+		ui.setFilter("")
+	case tcell.KeyRune:
+		switch ev.Rune() {
+		case 'q':
+			return false
+		case 'k':
+			ui.move(-1)
+		case 'j':
+			ui.move(1)
+		case 'g':
+			ui.move(-len(ui.view))
+		case 'G':
+			ui.move(len(ui.view))
+		case ' ', 'x':
+			ui.toggle()
+		case 'a':
+			ui.prompt(modeAdd, "")
+		case 'e':
+			if t, ok := ui.selected(); ok && !t.done {
+				ui.prompt(modeEdit, t.String())
+			}
+		case '/':
+			ui.oldText = ui.query
+			ui.prompt(modeFilter, ui.query)
+		case 's':
+			for i, s := range uiSorts {
+				if s == ui.sortBy {
+					ui.sortBy = uiSorts[(i+1)%len(uiSorts)]
+					break
+				}
+			}
+			ui.refresh()
+			ui.setStatus("sorted by "+ui.sortBy, nil)
+		}
+	}
+	return true
+}
+
+// handleInput handles a key while a task or filter is typed.
+func (ui *taskUI) handleInput(ev *tcell.EventKey) {
+	switch ev.Key() {
+	case tcell.KeyEnter:
+		ui.submit()
+		return
+	case tcell.KeyEscape:
+		if ui.mode == modeFilter {
+			ui.setFilter(ui.oldText)
+		}
+		ui.mode = modeList
+		ui.setStatus(uiHelp, nil)
+		return
+	case tcell.KeyLeft:
+		if ui.pos > 0 {
+			ui.pos--
+		}
+	case tcell.KeyRight:
+		if ui.pos < len(ui.input) {
+			ui.pos++
+		}
+	case tcell.KeyHome, tcell.KeyCtrlA:
+		ui.pos = 0
+	case tcell.KeyEnd, tcell.KeyCtrlE:
+		ui.pos = len(ui.input)
+	case tcell.KeyBackspace, tcell.KeyBackspace2:
+		if ui.pos > 0 {
+			ui.input = append(ui.input[:ui.pos-1], ui.input[ui.pos:]...)
+			ui.pos--
+		}
+	case tcell.KeyDelete:
+		if ui.pos < len(ui.input) {
+			ui.input = append(ui.input[:ui.pos], ui.input[ui.pos+1:]...)
+		}
+	case tcell.KeyRune:
+		ui.input = append(ui.input[:ui.pos], append([]rune{ev.Rune()}, ui.input[ui.pos:]...)...)
+		ui.pos++
+	}
+
+	// Filter as it's typed.
+	if ui.mode == modeFilter {
+		ui.setFilter(string(ui.input))
+	}
+}
+
+// prompt starts typing in mode, starting with text.
+func (ui *taskUI) prompt(mode uiMode, text string) {
+	ui.mode = mode
+	ui.input = []rune(text)
+	ui.pos = len(ui.input)
+	ui.setStatus("enter to save, esc to cancel", nil)
+}
+
+// submit adds or edits the task typed, or keeps the filter.
+func (ui *taskUI) submit() {
+	text := strings.TrimSpace(string(ui.input))
+	mode := ui.mode
+	ui.mode = modeList
+	if mode == modeFilter {
+		ui.setStatus(uiHelp, nil)
+		return
+	}
+
+	t, err := parseTask(text, now())
+	if err == nil && t.Text == "" {
+		err = fmt.Errorf("a task needs some text")
+	}
+	if err != nil {
+		// let it be fixed instead of typed again
+		ui.mode = mode
+		ui.setStatus("", err)
+		return
+	}
+
+	if mode == modeAdd {
+		err = ui.withDB(func() (err error) {
+			t, err = AddToDB(t)
+			return err
+		})
+		if err != nil {
+			ui.setStatus("", err)
+			return
+		}
+		ui.items = append(ui.items, uiItem{Task: t})
+		ui.refresh()
+		ui.selectItem(len(ui.items) - 1)
+		ui.setStatus(fmt.Sprintf("added '%s'", t), nil)
+		return
+	}
+
+	item, _ := ui.selected()
+	err = ui.withDB(func() (err error) {
+		t, err = EditTask(item.ID, t)
+		return err
+	})
+	if err != nil {
+		ui.setStatus("", err)
+		return
+	}
+	i := ui.view[ui.cursor]
+	ui.items[i].Task = t
+	ui.refresh()
+	ui.selectItem(i)
+	ui.setStatus(fmt.Sprintf("changed to '%s'", t), nil)
+}
+
+// toggle marks the selected task done, or not done if it's
+// been done in the ui. A recurring task's next one is added
+// when it's done, and taken away again if it's undone.
+func (ui *taskUI) toggle() {
+	item, ok := ui.selected()
+	if !ok {
+		return
+	}
+	i := ui.view[ui.cursor]
+
+	if !item.done {
+		var done, next Task
+		err := ui.withDB(func() (err error) {
+			done, next, err = CompleteTask(item.ID)
+			return err
+		})
+		if err != nil {
+			ui.setStatus("", err)
+			return
+		}
+		ui.items[i] = uiItem{Task: done, done: true}
+		ui.setStatus(fmt.Sprintf("done: '%s'", item.Task), nil)
+		if next.ID != 0 {
+			ui.items = append(ui.items, uiItem{Task: next})
+			ui.setStatus(fmt.Sprintf("done: '%s', next due %s", item.Task, next.Due.Format("Mon Jan 2")), nil)
+		}
+		ui.refresh()
+		ui.selectItem(i)
+		return
+	}
+
+	var t Task
+	err := ui.withDB(func() (err error) {
+		t, err = UndoTask(item.ID)
+		return err
+	})
+	if err != nil {
+		ui.setStatus("", err)
+		return
+	}
+	ui.items[i] = uiItem{Task: t}
+	if item.Next != 0 {
+		for j, it := range ui.items {
+			if it.ID == item.Next && !it.done {
+				ui.items = append(ui.items[:j], ui.items[j+1:]...)
+				if j < i {
+					i--
+				}
+				break
+			}
+		}
+	}
+	ui.refresh()
+	ui.selectItem(i)
+	ui.setStatus(fmt.Sprintf("not done: '%s'", t), nil)
+}
+
+// setFilter filters the tasks shown by query, written like
+// the filters task list takes.
+func (ui *taskUI) setFilter(query string) {
+	f, err := parseFilter(strings.Fields(query), now())
+	if err != nil {
+		// probably not finished typing it yet
+		ui.setStatus("", err)
+		return
+	}
+	ui.query, ui.filter = query, f
+	ui.setStatus("", nil)
+	ui.refresh()
+}
+
+// refresh works out which items are shown and in what order,
+// keeping the same item selected where it can.
+func (ui *taskUI) refresh() {
+	sel := -1
+	if ui.cursor < len(ui.view) {
+		sel = ui.view[ui.cursor]
+	}
+
+	today := now()
+	var shown []numberedTask
+	for i, it := range ui.items {
+		if ui.filter.match(it.Task, today) {
+			shown = append(shown, numberedTask{i, it.Task})
+		}
+	}
+	sortTasks(shown, ui.sortBy)
+	ui.view = ui.view[:0]
+	for _, t := range shown {
+		ui.view = append(ui.view, t.n)
+	}
+
+	ui.cursor = 0
+	ui.selectItem(sel)
+}
+
+// selectItem moves the cursor to item i if it's shown.
+func (ui *taskUI) selectItem(i int) {
+	for c, v := range ui.view {
+		if v == i {
+			ui.cursor = c
+		}
+	}
+	ui.move(0)
+}
+
+func (ui *taskUI) selected() (uiItem, bool) {
+	if ui.cursor >= len(ui.view) {
+		return uiItem{}, false
+	}
+	return ui.items[ui.view[ui.cursor]], true
+}
+
+// move moves the cursor by n, keeping it on the list
+// and scrolling so it's on screen.
+func (ui *taskUI) move(n int) {
+	ui.cursor += n
+	if ui.cursor >= len(ui.view) {
+		ui.cursor = len(ui.view) - 1
+	}
+	if ui.cursor < 0 {
+		ui.cursor = 0
+	}
+	if ui.cursor < ui.top {
+		ui.top = ui.cursor
+	}
+	if rows := ui.rows(); ui.cursor >= ui.top+rows {
+		ui.top = ui.cursor - rows + 1
+	}
+}
+
+// rows returns how many tasks fit on screen, between
+// the title and status lines.
+func (ui *taskUI) rows() int {
+	_, h := ui.screen.Size()
+	if h < 3 {
+		return 1
+	}
+	return h - 2
+}
+
+func (ui *taskUI) setStatus(s string, err error) {
+	ui.status, ui.failed = s, err != nil
+	if err != nil {
+		ui.status = err.Error()
+	}
+}
+
+// draw draws the title, the tasks in view and the status
+// line, or what's being typed.
+func (ui *taskUI) draw() {
+	s := ui.screen
+	s.Clear()
+	w, h := s.Size()
+	today := now()
+
+	title := fmt.Sprintf(" %s, sorted by %s", plural(len(ui.view), "task"), ui.sortBy)
+	if ui.query != "" {
+		title += fmt.Sprintf(", filtered by '%s'", ui.query)
+	}
+	drawLine(s, 0, w, title, tcell.StyleDefault.Reverse(true))
+
+	for row := 0; row < ui.rows() && ui.top+row < len(ui.view); row++ {
+		it := ui.items[ui.view[ui.top+row]]
+		box := "[ ] "
+		style := tcell.StyleDefault
+		switch {
+		case it.done:
+			box = "[x] "
+			style = style.Dim(true)
+		case it.Overdue(today):
+			style = style.Foreground(tcell.ColorRed)
+		case it.Due.Equal(startOfDay(today)):
+			style = style.Foreground(tcell.ColorYellow)
+		}
+		if ui.top+row == ui.cursor {
+			style = style.Reverse(true)
+		}
+		drawLine(s, 1+row, w, " "+box+it.String(), style)
+	}
+
+	s.HideCursor()
+	if ui.mode != modeList {
+		prompt := uiPrompts[ui.mode]
+		drawLine(s, h-1, w, prompt+string(ui.input), tcell.StyleDefault)
+		s.ShowCursor(runewidth.StringWidth(prompt+string(ui.input[:ui.pos])), h-1)
+	} else {
+		style := tcell.StyleDefault.Dim(true)
+		if ui.failed {
+			style = tcell.StyleDefault.Foreground(tcell.ColorRed)
+		}
+		drawLine(s, h-1, w, ui.status, style)
+	}
+	if ui.mode != modeList && ui.failed {
+		// errors from typing show above what's typed
+		drawLine(s, h-2, w, ui.status, tcell.StyleDefault.Foreground(tcell.ColorRed))
+	}
+	s.Show()
+}
+
+// drawLine draws text on row y, filling the rest of the
+// line with style so a selected line shows across the screen.
+func drawLine(s tcell.Screen, y, w int, text string, style tcell.Style) {
+	x := 0
+	for _, r := range text {
+		rw := runewidth.RuneWidth(r)
+		if x+rw > w {
+			break
+		}
+		s.SetContent(x, y, r, nil, style)
+		x += rw
+	}
+	for ; x < w; x++ {
+		s.SetContent(x, y, ' ', nil, style)
+	}
+}
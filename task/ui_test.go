@@ -0,0 +1,204 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// newTestUI returns a ui on a simulated screen, for the tasks given.
+func newTestUI(t *testing.T, tasks ...string) (*taskUI, tcell.SimulationScreen) {
+	t.Helper()
+	if err := OpenDB(dbPath); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range tasks {
+		task, err := parseTask(text, now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := AddToDB(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	CloseDB()
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatal(err)
+	}
+	screen.SetSize(70, 8)
+	ui, err := newTaskUI(screen, dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ui, screen
+}
+
+// readDB returns the tasks and completed tasks in the database,
+// opening it like another task command would as the ui runs.
+func readDB(t *testing.T) (tasks, done []Task) {
+	t.Helper()
+	if err := OpenDB(dbPath); err != nil {
+		t.Fatalf("opening the database with the ui running: %s", err)
+	}
+	defer CloseDB()
+	tasks, err := AllTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done, err = CompletedTasks(); err != nil {
+		t.Fatal(err)
+	}
+	return tasks, done
+}
+
+// press sends keys to the ui: runes are typed, and these
+// stand for other keys.
+var uiKeys = map[string]tcell.Key{
+	"<enter>": tcell.KeyEnter, "<esc>": tcell.KeyEscape, "<end>": tcell.KeyEnd,
+	"<bs>": tcell.KeyBackspace2, "<down>": tcell.KeyDown, "<up>": tcell.KeyUp,
+}
+
+func press(ui *taskUI, keys ...string) bool {
+	for _, k := range keys {
+		if key, ok := uiKeys[k]; ok {
+			if !ui.handleKey(tcell.NewEventKey(key, 0, tcell.ModNone)) {
+				return false
+			}
+			continue
+		}
+		for _, r := range k {
+			if !ui.handleKey(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// screenLines returns the text on screen, a line per row.
+func screenLines(ui *taskUI, screen tcell.SimulationScreen) []string {
+	ui.draw()
+	cells, w, h := screen.GetContents()
+	lines := make([]string, h)
+	for y := 0; y < h; y++ {
+		var b strings.Builder
+		for _, c := range cells[y*w : (y+1)*w] {
+			b.WriteRune(c.Runes[0])
+		}
+		lines[y] = strings.TrimRight(b.String(), " ")
+	}
+	return lines
+}
+
+func viewTexts(ui *taskUI) string {
+	var texts []string
+	for _, i := range ui.view {
+		texts = append(texts, ui.items[i].Text)
+	}
+	return strings.Join(texts, ",")
+}
+
+func TestUI(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+	defer setClock(time.Date(2020, 6, 10, 9, 0, 0, 0, time.Local))()
+
+	ui, screen := newTestUI(t, "pay rent due:2020-06-12 p:high +home", "water plants every:3d", "read a book p:low")
+	lines := screenLines(ui, screen)
+	want := []string{
+		" 3 tasks, sorted by added",
+		" [ ] pay rent +home p:high due:2020-06-12",
+		" [ ] water plants due:2020-06-10 every:3d",
+		" [ ] read a book p:low",
+	}
+	for i, l := range want {
+		if lines[i] != l {
+			t.Errorf("line %d = %q, want %q", i, lines[i], l)
+		}
+	}
+	if lines[7] != uiHelp {
+		t.Errorf("status line = %q, want the help", lines[7])
+	}
+
+	// Done, then undone, with the recurring task's next one.
+	press(ui, "j", " ")
+	if _, done := readDB(t); len(done) != 1 || done[0].Text != "water plants" {
+		t.Errorf("after space, completed tasks = %v", done)
+	}
+	if tasks, _ := readDB(t); len(tasks) != 3 || !strings.Contains(screenLines(ui, screen)[2], "[x] water plants") {
+		t.Errorf("after space, tasks = %v, screen = %q", tasks, screenLines(ui, screen))
+	}
+	if !strings.Contains(ui.status, "next due Sat Jun 13") {
+		t.Errorf("status = %q, want when it's next due", ui.status)
+	}
+	press(ui, " ")
+	if _, done := readDB(t); len(done) != 0 || len(ui.items) != 3 {
+		t.Errorf("after undo, completed = %v, items = %v", done, ui.items)
+	}
+
+	// Add, then edit what was added.
+	press(ui, "a", "call mum due:tomorrow", "<enter>")
+	if item, _ := ui.selected(); item.Text != "call mum" || ui.mode != modeList {
+		t.Errorf("after add, selected %v in mode %v", item, ui.mode)
+	}
+	press(ui, "e", "<end>", " p:med", "<enter>")
+	tasks, _ := readDB(t)
+	if len(tasks) != 4 || tasks[3].String() != "call mum p:medium due:2020-06-11" {
+		t.Errorf("after edit, tasks = %v", tasks)
+	}
+
+	// A bad task is kept to be fixed.
+	press(ui, "a", "fix p:urgent", "<enter>")
+	if ui.mode != modeAdd || !ui.failed {
+		t.Errorf("after a bad add, mode = %v, status = %q", ui.mode, ui.status)
+	}
+	press(ui, "<bs>", "<bs>", "<bs>", "<bs>", "<bs>", "<bs>", "<bs>", "<bs>", "sink", "<enter>")
+	if item, _ := ui.selected(); item.Text != "fix sink" {
+		t.Errorf("after fixing the add, selected %v", item)
+	}
+
+	// Filter and sort.
+	press(ui, "/", "rent")
+	if got := viewTexts(ui); got != "pay rent" {
+		t.Errorf("filtered by rent = %q", got)
+	}
+	press(ui, "<enter>", "/", "<bs>", "<bs>", "<bs>", "<bs>", "+home", "<esc>")
+	if got := viewTexts(ui); got != "pay rent" || ui.query != "rent" {
+		t.Errorf("after a cancelled filter, view = %q, query %q", got, ui.query)
+	}
+	press(ui, "<esc>")
+	if got := viewTexts(ui); got != "pay rent,water plants,read a book,call mum,fix sink" {
+		t.Errorf("after esc, view = %q", got)
+	}
+	press(ui, "s")
+	if got := viewTexts(ui); got != "water plants,call mum,pay rent,read a book,fix sink" {
+		t.Errorf("sorted by due = %q", got)
+	}
+	press(ui, "s")
+	if got := viewTexts(ui); got != "pay rent,call mum,read a book,water plants,fix sink" {
+		t.Errorf("sorted by priority = %q", got)
+	}
+
+	if press(ui, "q") {
+		t.Error("q didn't quit")
+	}
+}
+
+func TestUIRun(t *testing.T) {
+	clearTasks(t)
+	defer clearTasks(t)
+
+	ui, screen := newTestUI(t, "walk minnie", "feed minnie")
+	screen.InjectKey(tcell.KeyDown, 0, tcell.ModNone)
+	screen.InjectKey(tcell.KeyRune, ' ', tcell.ModNone)
+	screen.InjectKey(tcell.KeyCtrlC, 0, tcell.ModNone)
+	if err := ui.run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, done := readDB(t); len(done) != 1 || done[0].Text != "feed minnie" {
+		t.Errorf("completed tasks = %v", done)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"unicode/utf8"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	secretsBucket = "secrets"
+	keysBucket    = "keys"
+	dataKeyName   = "data"
+	saltName      = "salt"
+)
+
+// BoltVault keeps secrets in a BoltDB file, each value
+// encrypted on its own with the encoding key, or with a data
+// key kept wrapped in the keys bucket. With a passphrase, the
+// keys bucket also keeps the salt every value's key is derived
+// with. The database is opened for each call, so vaults can
+// share the file.
+type BoltVault struct {
+	fp string
+	kr *keyring
+}
+
+// NewBoltVault is a factory function for BoltVaults
+// encrypted with a hex-encoded key.
+func NewBoltVault(encodingKey string, filePath string) (*BoltVault, error) {
+	return newBoltVault(Keys{EncodingKey: encodingKey}, filePath)
+}
+
+func newBoltVault(keys Keys, filePath string) (*BoltVault, error) {
+	kr, err := newKeyring(keys)
+	if err != nil {
+		return nil, err
+	}
+	if filePath == "" {
+		return nil, errors.New("filepath cannot be empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return nil, err
+	}
+
+	// Make sure the database and its bucket are there, and
+	// that every value uses the database's salt, so opening
+	// them all only takes one run of scrypt.
+	kr.detached = true
+	bv := &BoltVault{fp: filePath, kr: kr}
+	if err := bv.update(func(b *bolt.Bucket) error { return putSalt(b.Tx(), kr, false) }); err != nil {
+		return nil, fmt.Errorf("error creating secrets database at %s, err: %s", filePath, err)
+	}
+	return bv, nil
+}
+
+// Get retrieves the value associated with the key.
+func (bv *BoltVault) Get(key string) (string, error) {
+	if key == "" {
+		return "", errors.New("key not given for lookup in secrets store")
+	}
+
+	var val []byte
+	err := bv.view(func(b *bolt.Bucket) error {
+		ciphertext := b.Get([]byte(key))
+		if ciphertext == nil {
+			return notFound(key)
+		}
+		var err error
+		val, err = bv.kr.decrypt(ciphertext)
+		return err
+	})
+	return string(val), err
+}
+
+// Set adds a key-value pair to the BoltVault.
+func (bv *BoltVault) Set(key, val string) error {
+	if err := checkSecret(key, val); err != nil {
+		return err
+	}
+
+	return bv.update(func(b *bolt.Bucket) error {
+		ciphertext, err := bv.kr.encrypt([]byte(val))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), ciphertext)
+	})
+}
+
+// Delete removes the entry with a matching key.
+func (bv *BoltVault) Delete(key string) error {
+	if key == "" {
+		return errors.New("failed to delete secret because key value is empty")
+	}
+
+	return bv.update(func(b *bolt.Bucket) error {
+		if b.Get([]byte(key)) == nil {
+			return notFound(key)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// List returns all currently stored secrets, in key order.
+func (bv *BoltVault) List() ([]Secret, error) {
+	var secrets []Secret
+	err := bv.view(func(b *bolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			val, err := bv.kr.decrypt(v)
+			if err != nil {
+				return err
+			}
+			secrets = append(secrets, Secret{Key: string(k), Value: string(val)})
+			return nil
+		})
+	})
+	return secrets, err
+}
+
+// Migrate upgrades the values in the old format, keeping a copy
+// of the database at its path with .bak added. Each value is
+// encrypted on its own, so ones already upgraded are left be.
+func (bv *BoltVault) Migrate(legacyKey string) (string, int, error) {
+	if err := checkEncodingKey(legacyKey); err != nil {
+		return "", 0, err
+	}
+
+	backup := bv.fp + ".bak"
+	var n int
+	err := bv.update(func(b *bolt.Bucket) error {
+		old := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			if isVersioned(v) {
+				return nil
+			}
+			val, err := decryptLegacy(legacyKey, v)
+			if err != nil {
+				return err
+			}
+			if !utf8.Valid(val) {
+				return fmt.Errorf("failed to decrypt old secret '%s', is encoding_key the key it was encrypted with?", k)
+			}
+			old[string(k)] = val
+			return nil
+		})
+		if err != nil || len(old) == 0 {
+			return err
+		}
+
+		// The copy is of the database as it is in this
+		// transaction, before anything is changed.
+		if err := b.Tx().CopyFile(backup, 0600); err != nil {
+			return fmt.Errorf("error backing up secrets to %s, err: %s", backup, err)
+		}
+		for k, val := range old {
+			ciphertext, err := bv.kr.encrypt(val)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), ciphertext); err != nil {
+				return err
+			}
+		}
+		n = len(old)
+		return nil
+	})
+	if n == 0 {
+		backup = ""
+	}
+	return backup, n, err
+}
+
+// RotateKey encrypts the secrets again with to, in one
+// transaction that's only committed once they decrypt, with
+// keys made afresh from to, to what they were. With a data key
+// only the data key is encrypted again.
+func (bv *BoltVault) RotateKey(to Keys, envelope bool) (int, error) {
+	kr, err := newKeyring(to)
+	if err != nil {
+		return 0, err
+	}
+	kr.detached = true
+
+	var n int
+	err = bv.update(func(b *bolt.Bucket) error {
+		plaintexts := make(map[string][]byte)
+		err := b.ForEach(func(k, v []byte) error {
+			val, err := bv.kr.decrypt(v)
+			plaintexts[string(k)] = val
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		if bv.kr.dataKey != nil {
+			kr.useDataKey(bv.kr.dataKey)
+		} else if envelope {
+			if err := kr.newDataKey(); err != nil {
+				return err
+			}
+		}
+		if err := putSalt(b.Tx(), kr, true); err != nil {
+			return err
+		}
+		if kr.dataKey != nil {
+			wrapped, err := kr.wrap()
+			if err != nil {
+				return err
+			}
+			keys, err := b.Tx().CreateBucketIfNotExists([]byte(keysBucket))
+			if err != nil {
+				return err
+			}
+			if err := keys.Put([]byte(dataKeyName), wrapped); err != nil {
+				return err
+			}
+		}
+
+		for k, val := range plaintexts {
+			// Values sealed with the data key stay as they are.
+			if v := b.Get([]byte(k)); kr.dataKey != nil && v[5] == kdfData {
+				continue
+			}
+			ciphertext, err := kr.encrypt(val)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(k), ciphertext); err != nil {
+				return err
+			}
+		}
+
+		check, err := newKeyring(to)
+		if err != nil {
+			return err
+		}
+		check.detached = true
+		if err := loadDataKey(b.Tx(), check); err != nil {
+			return fmt.Errorf("failed to verify the re-encrypted secrets, err: %s", err)
+		}
+		for k, val := range plaintexts {
+			got, err := check.decrypt(b.Get([]byte(k)))
+			if err != nil {
+				return fmt.Errorf("failed to verify re-encrypted secret '%s', err: %s", k, err)
+			}
+			if !bytes.Equal(got, val) {
+				return fmt.Errorf("failed to verify re-encrypted secret '%s', it doesn't match the old one", k)
+			}
+		}
+		n = len(plaintexts)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	bv.kr = kr
+	return n, nil
+}
+
+// putSalt makes kr, if it has a passphrase, use the salt kept in
+// the keys bucket, or keeps kr's there if there isn't one or
+// replace is set.
+func putSalt(tx *bolt.Tx, kr *keyring, replace bool) error {
+	if kr.passphrase == "" {
+		if b := tx.Bucket([]byte(keysBucket)); b != nil && replace {
+			return b.Delete([]byte(saltName))
+		}
+		return nil
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(keysBucket))
+	if err != nil {
+		return err
+	}
+	if salt := b.Get([]byte(saltName)); len(salt) == saltSize && !replace {
+		kr.salt = append([]byte(nil), salt...)
+		return nil
+	}
+	return b.Put([]byte(saltName), kr.salt)
+}
+
+// loadDataKey unwraps the data key in the keys bucket,
+// if there is one, into kr.
+func loadDataKey(tx *bolt.Tx, kr *keyring) error {
+	b := tx.Bucket([]byte(keysBucket))
+	if b == nil {
+		return nil
+	}
+	wrapped := b.Get([]byte(dataKeyName))
+	if wrapped == nil || bytes.Equal(wrapped, kr.wrapped) {
+		return nil
+	}
+	return kr.unwrap(wrapped)
+}
+
+// view runs fn on the secrets bucket in a read-only transaction.
+func (bv *BoltVault) view(fn func(*bolt.Bucket) error) error {
+	db, err := bv.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		if err := loadDataKey(tx, bv.kr); err != nil {
+			return err
+		}
+		return fn(tx.Bucket([]byte(secretsBucket)))
+	})
+}
+
+// update runs fn on the secrets bucket in a read-write
+// transaction, creating the bucket if need be.
+func (bv *BoltVault) update(fn func(*bolt.Bucket) error) error {
+	db, err := bv.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		if err := loadDataKey(tx, bv.kr); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucketIfNotExists([]byte(secretsBucket))
+		if err != nil {
+			return err
+		}
+		return fn(b)
+	})
+}
+
+func (bv *BoltVault) open() (*bolt.DB, error) {
+	return bolt.Open(bv.fp, 0600, &bolt.Options{Timeout: time.Second})
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// Encrypted secrets start with a header saying how they were
+// encrypted, so the format can change without guessing:
+//
+//	magic    "VALT"
+//	version  1
+//	kdf      0 for the raw encoding key, 1 for scrypt, 2 for a data key
+//	scrypt   log2(N), r, p and a 16 byte salt, for kdf 1
+//	data key a 2 byte length and the data key wrapped by the master
+//	         key (the encoding key or passphrase), for kdf 2; a length
+//	         of 0 means the vault keeps the wrapped key apart
+//	nonce    12 bytes
+//
+// The rest is the AES-GCM sealed secrets, with the header
+// (up to the nonce) as additional data so it can't be
+// changed either. Secrets sealed with a data key only have the
+// first 6 bytes as additional data, so changing the master key
+// means wrapping the data key again and nothing else. Files from
+// before the header were AES-CFB with the raw key and no
+// authentication; vault migrate upgrades them.
+const (
+	headerMagic   = "VALT"
+	formatVersion = 1
+
+	kdfNone   = 0
+	kdfScrypt = 1
+	kdfData   = 2
+
+	saltSize    = 16
+	dataKeySize = 32
+)
+
+// The scrypt cost, from the scrypt package's advice for
+// interactive logins in 2017.
+var (
+	scryptLogN byte = 15
+	scryptR    byte = 8
+	scryptP    byte = 1
+)
+
+// The most scrypt cost decrypt runs, so secrets written with
+// a lower or somewhat higher cost still open, but a header
+// can't ask for more memory (128 * r * N bytes, 1 GiB here)
+// or time than that.
+const (
+	maxScryptLogN = 20
+	maxScryptR    = 8
+	maxScryptP    = 4
+)
+
+// errLegacyFormat is the error for secrets written before
+// the versioned format.
+var errLegacyFormat = errors.New("secrets are in the old unauthenticated format, run 'vault migrate' to upgrade them")
+
+// Keys is what secrets are encrypted with: keys derived from
+// a passphrase if there is one, or else the hex-encoded key.
+type Keys struct {
+	Passphrase  string
+	EncodingKey string
+}
+
+// keyring derives the keys secrets are encrypted with,
+// keeping the ones it's derived so each salt only costs
+// one run of scrypt. With envelope encryption, secrets are
+// sealed with a random data key, and the keys from Keys, the
+// master key, only wrap that.
+type keyring struct {
+	passphrase string
+	rawKey     []byte
+	salt       []byte            // for what's encrypted from now on
+	derived    map[string][]byte // keys by salt
+
+	dataKey  []byte
+	wrapped  []byte // dataKey wrapped by the master key
+	detached bool   // the wrapped key is kept apart from the secrets
+}
+
+func newKeyring(keys Keys) (*keyring, error) {
+	if keys.Passphrase != "" {
+		salt := make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+			return nil, err
+		}
+		return &keyring{passphrase: keys.Passphrase, salt: salt, derived: make(map[string][]byte)}, nil
+	}
+
+	if err := checkEncodingKey(keys.EncodingKey); err != nil {
+		return nil, err
+	}
+	key, _ := hex.DecodeString(keys.EncodingKey)
+	return &keyring{rawKey: key}, nil
+}
+
+// newDataKey starts envelope encryption with a new data key.
+func (kr *keyring) newDataKey() error {
+	key := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	kr.useDataKey(key)
+	return nil
+}
+
+// useDataKey seals secrets from now on with key, wrapped by
+// the keyring's master key.
+func (kr *keyring) useDataKey(key []byte) {
+	kr.dataKey, kr.wrapped = key, nil
+}
+
+// wrap returns the data key wrapped by the master key.
+func (kr *keyring) wrap() ([]byte, error) {
+	if kr.wrapped == nil {
+		wrapped, err := kr.sealMaster(kr.dataKey)
+		if err != nil {
+			return nil, err
+		}
+		kr.wrapped = wrapped
+	}
+	return kr.wrapped, nil
+}
+
+// unwrap opens a wrapped data key with the master key and uses it.
+func (kr *keyring) unwrap(wrapped []byte) error {
+	if len(wrapped) > 5 && wrapped[5] == kdfData {
+		return errors.New("a data key can't be wrapped by another data key")
+	}
+	key, err := kr.decrypt(wrapped)
+	if err != nil {
+		return err
+	}
+	if len(key) != dataKeySize {
+		return errors.New("the data key is the wrong size")
+	}
+	kr.dataKey, kr.wrapped = key, append([]byte(nil), wrapped...)
+	return nil
+}
+
+// masterHeader returns the header for what's encrypted
+// with the master key.
+func (kr *keyring) masterHeader() []byte {
+	h := []byte{headerMagic[0], headerMagic[1], headerMagic[2], headerMagic[3], formatVersion, kdfNone}
+	if kr.passphrase != "" {
+		h[5] = kdfScrypt
+		h = append(h, scryptLogN, scryptR, scryptP)
+		h = append(h, kr.salt...)
+	}
+	return h
+}
+
+// dataHeader returns the header for what's encrypted with
+// the data key, with the wrapped data key unless it's
+// kept apart.
+func (kr *keyring) dataHeader(wrapped []byte) []byte {
+	h := []byte{headerMagic[0], headerMagic[1], headerMagic[2], headerMagic[3], formatVersion, kdfData, 0, 0}
+	if !kr.detached {
+		binary.BigEndian.PutUint16(h[6:], uint16(len(wrapped)))
+		h = append(h, wrapped...)
+	}
+	return h
+}
+
+// key returns the key for a header's kdf and parameters.
+func (kr *keyring) key(kdf byte, params []byte) ([]byte, error) {
+	switch kdf {
+	case kdfNone:
+		if kr.rawKey == nil {
+			return nil, errors.New("secrets were encrypted with the encoding key, not a passphrase")
+		}
+		return kr.rawKey, nil
+	case kdfScrypt:
+		if kr.passphrase == "" {
+			return nil, errors.New("secrets were encrypted with a passphrase, but none is set")
+		}
+		if k, ok := kr.derived[string(params)]; ok {
+			return k, nil
+		}
+		// The parameters aren't authenticated until the key they
+		// make opens the secrets, so they're capped, or a
+		// tampered header could ask for more memory than there is.
+		logN, r, p, salt := params[0], params[1], params[2], params[3:]
+		if logN < 1 || logN > maxScryptLogN || r < 1 || r > maxScryptR || p < 1 || p > maxScryptP {
+			return nil, fmt.Errorf("secrets have scrypt parameters N=2^%d, r=%d, p=%d, this vault runs at most N=2^%d, r=%d, p=%d", logN, r, p, maxScryptLogN, maxScryptR, maxScryptP)
+		}
+		k, err := scrypt.Key([]byte(kr.passphrase), salt, 1<<logN, int(r), int(p), 32)
+		if err != nil {
+			return nil, err
+		}
+		kr.derived[string(params)] = k
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown key derivation %d", kdf)
+}
+
+// encrypt seals plaintext behind a header saying how, with
+// the data key if there is one and the master key if not.
+func (kr *keyring) encrypt(plaintext []byte) ([]byte, error) {
+	if kr.dataKey == nil {
+		return kr.sealMaster(plaintext)
+	}
+	wrapped, err := kr.wrap()
+	if err != nil {
+		return nil, err
+	}
+	header := kr.dataHeader(wrapped)
+	return seal(kr.dataKey, header, header[:6], plaintext)
+}
+
+func (kr *keyring) sealMaster(plaintext []byte) ([]byte, error) {
+	header := kr.masterHeader()
+	key, err := kr.key(header[5], header[6:])
+	if err != nil {
+		return nil, err
+	}
+	return seal(key, header, header, plaintext)
+}
+
+func seal(key, header, additional, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, additional), nil
+}
+
+// decrypt opens what encrypt sealed, with the key its
+// header calls for. A data key in the header is unwrapped
+// and used from then on.
+func (kr *keyring) decrypt(ciphertext []byte) ([]byte, error) {
+	size, err := headerSize(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var key, additional []byte
+	if kdf := ciphertext[5]; kdf == kdfData {
+		if size > 8 {
+			if err := kr.unwrap(ciphertext[8:size]); err != nil {
+				return nil, err
+			}
+		}
+		if kr.dataKey == nil {
+			return nil, errors.New("secrets were encrypted with a data key, but it's missing")
+		}
+		key, additional = kr.dataKey, ciphertext[:6]
+	} else {
+		additional = ciphertext[:size]
+		if key, err = kr.key(kdf, additional[6:]); err != nil {
+			return nil, err
+		}
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := ciphertext[size:]
+	if len(rest) < gcm.NonceSize()+gcm.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], additional)
+	if err != nil {
+		return nil, errors.New("failed to decrypt secrets: wrong key or passphrase, or they've been tampered with")
+	}
+	return plaintext, nil
+}
+
+// rewrap returns ciphertext, sealed with a data key that's in
+// its header, with the data key wrapped by this keyring's master
+// key instead. The sealed secrets are left as they are.
+func (kr *keyring) rewrap(ciphertext []byte) ([]byte, error) {
+	size, err := headerSize(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if ciphertext[5] != kdfData || size == 8 {
+		return nil, errors.New("secrets weren't encrypted with a data key in their header")
+	}
+	wrapped, err := kr.wrap()
+	if err != nil {
+		return nil, err
+	}
+	return append(kr.dataHeader(wrapped), ciphertext[size:]...), nil
+}
+
+// headerSize checks ciphertext's header and returns its size.
+func headerSize(ciphertext []byte) (int, error) {
+	if !isVersioned(ciphertext) {
+		return 0, errLegacyFormat
+	}
+	if len(ciphertext) < 6 {
+		return 0, errors.New("ciphertext too short")
+	}
+	if v := ciphertext[4]; v != formatVersion {
+		return 0, fmt.Errorf("secrets are in format version %d, this vault only knows version %d", v, formatVersion)
+	}
+
+	size := 6
+	switch ciphertext[5] {
+	case kdfScrypt:
+		size += 3 + saltSize
+	case kdfData:
+		if len(ciphertext) < 8 {
+			return 0, errors.New("ciphertext too short")
+		}
+		size += 2 + int(binary.BigEndian.Uint16(ciphertext[6:]))
+	}
+	if len(ciphertext) < size {
+		return 0, errors.New("ciphertext too short")
+	}
+	return size, nil
+}
+
+// isVersioned reports whether ciphertext has a header, as
+// opposed to being in the old format.
+func isVersioned(ciphertext []byte) bool {
+	return bytes.HasPrefix(ciphertext, []byte(headerMagic))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// decryptLegacy decrypts secrets in the old format: AES-CFB
+// with the hex-encoded key and a random IV at the start.
+func decryptLegacy(encodingKey string, ciphertext []byte) ([]byte, error) {
+	if err := checkEncodingKey(encodingKey); err != nil {
+		return nil, err
+	}
+	key, _ := hex.DecodeString(encodingKey)
+
+	// Create the necessary ingredients for decryption.
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < aes.BlockSize {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	iv := ciphertext[:aes.BlockSize]
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	stream := cipher.NewCFBDecrypter(block, iv)
+
+	// Decrypt.
+	stream.XORKeyStream(plaintext, ciphertext[aes.BlockSize:])
+
+	return plaintext, nil
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestMain(m *testing.M) {
+	// Keep scrypt cheap, it runs for every passphrase in the tests.
+	scryptLogN = 4
+	os.Exit(m.Run())
+}
+
+const testKey = "6D696E6E69657468656D6F6F63686572"
+
+func TestKeyring(t *testing.T) {
+	tests := []struct {
+		name  string
+		keys  Keys
+		other Keys // different keys, which mustn't decrypt
+	}{
+		{"encoding key", Keys{EncodingKey: testKey}, Keys{EncodingKey: "00000000000000000000000000000000"}},
+		{"passphrase", Keys{Passphrase: "correct horse", EncodingKey: testKey}, Keys{Passphrase: "battery staple"}},
+		{"passphrase, encoding key", Keys{Passphrase: "correct horse"}, Keys{EncodingKey: testKey}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr, err := newKeyring(tt.keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext := []byte(`{"Secrets":[{"Key":"garage","Value":"8366"}]}`)
+			c1, err := kr.encrypt(plaintext)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c2, _ := kr.encrypt(plaintext)
+			if !isVersioned(c1) || bytes.Equal(c1, c2) {
+				t.Errorf("encrypting twice gave %x and %x, want two different versioned ciphertexts", c1, c2)
+			}
+
+			// A keyring made again from the same keys, with a
+			// new salt, still decrypts what the first one sealed.
+			again, _ := newKeyring(tt.keys)
+			if got, err := again.decrypt(c1); err != nil || !bytes.Equal(got, plaintext) {
+				t.Errorf("decrypted %q, %v, want %q", got, err, plaintext)
+			}
+
+			other, err := newKeyring(tt.other)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := other.decrypt(c1); err == nil {
+				t.Errorf("decrypted %q with the wrong keys", got)
+			}
+		})
+	}
+}
+
+func TestKeyringDecrypt(t *testing.T) {
+	kr, _ := newKeyring(Keys{Passphrase: "correct horse"})
+	sealed, _ := kr.encrypt([]byte("8366"))
+	legacy, _ := encryptLegacy(testKey, []byte("8366"))
+
+	change := func(i int, b byte) []byte {
+		c := append([]byte(nil), sealed...)
+		c[i] = b
+		return c
+	}
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"legacy", legacy},
+		{"version", change(4, 2)},
+		{"kdf", change(5, kdfNone)},
+		{"scrypt cost", change(6, scryptLogN+1)},
+		{"scrypt huge cost", change(6, 30)},
+		{"scrypt huge r", change(7, 255)},
+		{"scrypt huge p", change(8, 255)},
+		{"salt", change(9, sealed[9]^1)},
+		{"nonce", change(25, sealed[25]^1)},
+		{"sealed", change(len(sealed)-1, sealed[len(sealed)-1]^1)},
+		{"truncated", sealed[:30]},
+		{"header only", []byte(headerMagic)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := kr.decrypt(tt.ciphertext); err == nil {
+				t.Errorf("decrypted %q, want an error", got)
+			}
+		})
+	}
+
+	if _, err := kr.decrypt(legacy); err != errLegacyFormat {
+		t.Errorf("decrypting the old format gave %v, want %v", err, errLegacyFormat)
+	}
+
+	// Secrets written with a lower cost than the vault
+	// writes now still open.
+	scryptLogN--
+	cheap, _ := kr.encrypt([]byte("8366"))
+	scryptLogN++
+	fresh, _ := newKeyring(Keys{Passphrase: "correct horse"})
+	if got, err := fresh.decrypt(cheap); err != nil || string(got) != "8366" {
+		t.Errorf("decrypting with a lower scrypt cost gave %q, %v, want 8366", got, err)
+	}
+
+	// A header asking scrypt for hundreds of GiB is turned
+	// down before scrypt runs.
+	huge := append([]byte(nil), sealed...)
+	huge[6], huge[7], huge[8] = 30, 255, 255
+	if _, err := kr.decrypt(huge); err == nil || !strings.Contains(err.Error(), "scrypt parameters") {
+		t.Errorf("decrypting with huge scrypt parameters gave %v, want an error about them", err)
+	}
+}
+
+func TestKeyringEnvelope(t *testing.T) {
+	kr, _ := newKeyring(Keys{EncodingKey: testKey})
+	if err := kr.newDataKey(); err != nil {
+		t.Fatal(err)
+	}
+	plaintext := []byte("8366")
+	sealed, err := kr.encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrapping the data key with a passphrase leaves what it
+	// sealed as it was.
+	to, _ := newKeyring(Keys{Passphrase: "correct horse"})
+	to.useDataKey(kr.dataKey)
+	rewrapped, err := to.rewrap(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, _ := headerSize(sealed)
+	if !bytes.HasSuffix(rewrapped, sealed[size:]) {
+		t.Error("rewrapping sealed the secrets again")
+	}
+
+	tests := []struct {
+		name string
+		keys Keys
+		ok   bool
+	}{
+		{"new passphrase", Keys{Passphrase: "correct horse"}, true},
+		{"old key", Keys{EncodingKey: testKey}, false},
+		{"wrong passphrase", Keys{Passphrase: "battery staple"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check, _ := newKeyring(tt.keys)
+			got, err := check.decrypt(rewrapped)
+			if tt.ok && (err != nil || !bytes.Equal(got, plaintext)) {
+				t.Errorf("decrypted %q, %v, want %q", got, err, plaintext)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("decrypted %q with the wrong keys", got)
+			}
+		})
+	}
+
+	// A vault that keeps the data key apart needs it to decrypt.
+	kr.detached = true
+	bare, _ := kr.encrypt(plaintext)
+	check, _ := newKeyring(Keys{EncodingKey: testKey})
+	if got, err := check.decrypt(bare); err == nil {
+		t.Errorf("decrypted %q without the data key", got)
+	}
+	wrapped, _ := kr.wrap()
+	if err := check.unwrap(wrapped); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := check.decrypt(bare); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("decrypted %q, %v, want %q", got, err, plaintext)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := AllSecrets{Secrets: []Secret{{"bank pin", "9994"}, {"garage code", "8366"}}}
+	backends := []struct {
+		backend string
+		fp      string
+		write   func(fp string) error // writes the secrets in the old format
+	}{
+		{"file", filepath.Join(dir, "data.d"), func(fp string) error {
+			plaintext, _ := json.Marshal(secrets)
+			ciphertext, err := encryptLegacy(testKey, plaintext)
+			if err != nil {
+				return err
+			}
+			return ioutil.WriteFile(fp, ciphertext, 0600)
+		}},
+		{"bolt", filepath.Join(dir, "data.db"), func(fp string) error {
+			db, err := bolt.Open(fp, 0600, nil)
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+			return db.Update(func(tx *bolt.Tx) error {
+				b, err := tx.CreateBucketIfNotExists([]byte(secretsBucket))
+				if err != nil {
+					return err
+				}
+				for _, s := range secrets.Secrets {
+					ciphertext, err := encryptLegacy(testKey, []byte(s.Value))
+					if err != nil {
+						return err
+					}
+					if err := b.Put([]byte(s.Key), ciphertext); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}},
+	}
+
+	for _, b := range backends {
+		t.Run(b.backend, func(t *testing.T) {
+			if err := b.write(b.fp); err != nil {
+				t.Fatal(err)
+			}
+
+			keys := Keys{Passphrase: "correct horse", EncodingKey: testKey}
+			v, err := NewVault(b.backend, keys, b.fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := v.Get("garage code"); err != errLegacyFormat {
+				t.Errorf("getting an old secret gave %v, want %v", err, errLegacyFormat)
+			}
+
+			m := v.(migrator)
+			if _, _, err := m.Migrate("00000000000000000000000000000000"); err == nil {
+				t.Error("should have received error migrating with the wrong key")
+			}
+			backup, n, err := m.Migrate(testKey)
+			if err != nil || n != len(secrets.Secrets) {
+				t.Fatalf("migrated %d secrets, err: %v, want %d", n, err, len(secrets.Secrets))
+			}
+
+			// The backup still has the old secrets.
+			bv, err := NewVault(b.backend, Keys{EncodingKey: testKey}, backup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, n, err := bv.(migrator).Migrate(testKey); err != nil || n != len(secrets.Secrets) {
+				t.Errorf("backup at %s had %d old secrets, err: %v, want %d", backup, n, err, len(secrets.Secrets))
+			}
+
+			// A new vault with just the passphrase reads them.
+			v, err = NewVault(b.backend, Keys{Passphrase: "correct horse"}, b.fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := v.List()
+			if err != nil || len(got) != len(secrets.Secrets) {
+				t.Fatalf("listed %v, err: %v, want %v", got, err, secrets.Secrets)
+			}
+			for i := range got {
+				if got[i] != secrets.Secrets[i] {
+					t.Errorf("listed %v, want %v", got, secrets.Secrets)
+				}
+			}
+
+			if backup, n, err := v.(migrator).Migrate(testKey); err != nil || backup != "" || n != 0 {
+				t.Errorf("migrating again gave %q, %d, %v, want nothing done", backup, n, err)
+			}
+		})
+	}
+}
+
+// encryptLegacy encrypts like vaults did before the versioned
+// format: AES-CFB with a random IV at the start.
+func encryptLegacy(encodingKey string, plaintext []byte) ([]byte, error) {
+	key, _ := hex.DecodeString(encodingKey)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
+	iv := ciphertext[:aes.BlockSize]
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	return ciphertext, nil
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"log"
 
 	"github.com/spf13/cobra"
 )
@@ -12,10 +12,22 @@ var deleteCmd = &cobra.Command{
 	Short: "A way to delete a secret",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("delete called")
+		key, err := cmd.Flags().GetString("key")
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := mustVault().Delete(key); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("===> deleted secret '%s'", key)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(deleteCmd)
+
+	var key string
+	deleteCmd.PersistentFlags().StringVarP(&key, "key", "k", "", "key of the secret to delete")
 }
@@ -4,7 +4,6 @@ import (
 	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // getCmd represents the get command.
@@ -18,15 +17,7 @@ var getCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		encodingKey := viper.GetString("encoding_key")
-		filePath := viper.GetString("filepath")
-
-		fv, err := NewFileVault(encodingKey, filePath)
-		if err != nil {
-			log.Fatalf("failed to create new file vault with encoding key '%s' and filepath '%s', err: %s", encodingKey, filePath, err)
-		}
-
-		value, err := fv.Get(key)
+		value, err := mustVault().Get(key)
 		if err != nil {
 			log.Fatal(err)
 		}
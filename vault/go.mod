@@ -3,6 +3,8 @@ module github.com/kristakoch/gophercises/vault
 go 1.13
 
 require (
+	github.com/boltdb/bolt v1.3.1
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.0
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
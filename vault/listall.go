@@ -1,10 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // listallCmd represents the listall command.
@@ -13,16 +13,17 @@ var listallCmd = &cobra.Command{
 	Short: "A way to list all secrets",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		encodingKey := viper.GetString("encoding_key")
-		filePath := viper.GetString("filepath")
-
-		fv, err := NewFileVault(encodingKey, filePath)
+		secrets, err := mustVault().List()
 		if err != nil {
-			log.Fatalf("failed to create new file vault with encoding key '%s' and filepath '%s', err: %s", encodingKey, filePath, err)
+			log.Fatalf("failed to list all secrets, err: %s", err)
 		}
 
-		if err := fv.ListAll(); err != nil {
-			log.Fatalf("failed to list all secrets, err: %s", err)
+		if len(secrets) == 0 {
+			log.Fatal("secrets store is empty")
+		}
+
+		for _, s := range secrets {
+			fmt.Println(s.Key + ": " + s.Value)
 		}
 	},
 }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// migrateCmd represents the migrate command.
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "A way to upgrade secrets to the current encryption",
+	Long: `Secrets used to be encrypted with AES-CFB, which can't tell
+when they've been tampered with. Now they're sealed with AES-GCM
+behind a versioned header, with the encoding key or a key derived
+from the passphrase (VAULT_PASSPHRASE or "passphrase" in the config).
+
+migrate decrypts the old secrets with encoding_key and encrypts them
+again the current way, keeping a copy of the old file with .bak added.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fp := viper.GetString("filepath")
+		m, ok := mustVault().(migrator)
+		if !ok {
+			log.Printf("===> %s vaults have nothing to migrate", backendName())
+			return
+		}
+
+		backup, n, err := m.Migrate(viper.GetString("encoding_key"))
+		if err != nil {
+			log.Fatalf("failed to migrate secrets at %s, err: %s", fp, err)
+		}
+		if backup == "" {
+			log.Printf("===> secrets at %s are already up to date", fp)
+			return
+		}
+		log.Printf("===> migrated %d %s at %s, the old ones are backed up at %s", n, plural(n, "secret"), fp, backup)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(migrateCmd)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
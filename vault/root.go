@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -10,6 +11,13 @@ import (
 
 var cfgFile string
 
+// vault is where the commands keep secrets, chosen by the
+// backend in the config: file, bolt or memory.
+var (
+	vault    Vault
+	vaultErr error
+)
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "vault",
@@ -47,8 +55,40 @@ func initConfig() {
 		viper.AddConfigPath(".") // wip: get the directory of this file
 	}
 
+	viper.SetEnvPrefix("vault")
+	viper.BindEnv("passphrase")
+
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err != nil {
 		fmt.Printf("error reading config file, err: %s", err)
 	}
+
+	// Set up the vault the config asks for.
+	vault, vaultErr = NewVault(viper.GetString("backend"), configKeys(), viper.GetString("filepath"))
+}
+
+// configKeys returns the keys secrets are encrypted with: keys
+// derived from the passphrase in VAULT_PASSPHRASE or the config,
+// or the encoding key if there's no passphrase.
+func configKeys() Keys {
+	return Keys{
+		Passphrase:  viper.GetString("passphrase"),
+		EncodingKey: viper.GetString("encoding_key"),
+	}
+}
+
+// mustVault returns the vault from the config, exiting
+// if it couldn't be set up.
+func mustVault() Vault {
+	if vaultErr != nil {
+		log.Fatalf("failed to create %s vault with filepath '%s', err: %s", backendName(), viper.GetString("filepath"), vaultErr)
+	}
+	return vault
+}
+
+func backendName() string {
+	if b := viper.GetString("backend"); b != "" {
+		return b
+	}
+	return "file"
 }
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// rotateKeyCmd represents the rotate-key command.
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "A way to encrypt the secrets with a new key",
+	Long: `rotate-key decrypts the secrets with the key from the config and
+encrypts them again with a new encoding key (--new-key) or a new
+passphrase (--new-passphrase or VAULT_NEW_PASSPHRASE). They're checked
+against the new key before the old ones are replaced, and then the
+config has to be changed to the new key.
+
+With --envelope the secrets are sealed with a random data key, and
+only that is encrypted with the key from the config. Once a vault uses
+a data key, rotating the key only encrypts the data key again.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		fp := viper.GetString("filepath")
+		to := Keys{
+			Passphrase:  viper.GetString("new_passphrase"),
+			EncodingKey: viper.GetString("new_key"),
+		}
+		if to.Passphrase == "" && to.EncodingKey == "" {
+			log.Fatal("failed to rotate key because neither --new-key nor --new-passphrase is given")
+		}
+
+		r, ok := mustVault().(rotator)
+		if !ok {
+			log.Fatalf("failed to rotate key because %s vaults aren't encrypted", backendName())
+		}
+
+		envelope, err := cmd.Flags().GetBool("envelope")
+		if err != nil {
+			log.Fatal(err)
+		}
+		n, err := r.RotateKey(to, envelope)
+		if err != nil {
+			log.Fatalf("failed to rotate key for secrets at %s, err: %s", fp, err)
+		}
+
+		log.Printf("===> rotated key for %d %s at %s", n, plural(n, "secret"), fp)
+		if to.Passphrase != "" {
+			log.Print("===> use the new passphrase from now on, with VAULT_PASSPHRASE or passphrase in the config")
+		} else {
+			log.Print("===> set encoding_key in the config to the new key")
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rotateKeyCmd)
+
+	rotateKeyCmd.Flags().String("new-key", "", "hex-encoded key to encrypt the secrets with")
+	rotateKeyCmd.Flags().String("new-passphrase", "", "passphrase to encrypt the secrets with, instead of a key")
+	rotateKeyCmd.Flags().Bool("envelope", false, "seal the secrets with a data key encrypted by the new key")
+
+	viper.BindPFlag("new_key", rotateKeyCmd.Flags().Lookup("new-key"))
+	viper.BindPFlag("new_passphrase", rotateKeyCmd.Flags().Lookup("new-passphrase"))
+	viper.BindEnv("new_passphrase", "VAULT_NEW_PASSPHRASE")
+}
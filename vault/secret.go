@@ -1,24 +1,26 @@
 package main
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/hex"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 )
 
-// NewFileVault is a factory function for FileVaults.
+// NewFileVault is a factory function for FileVaults
+// encrypted with a hex-encoded key.
 func NewFileVault(encodingKey string, filePath string) (*FileVault, error) {
-	if len(encodingKey) != 32 {
-		return nil, errors.New("encoding key must have a length of 32 (hex-encoded 16 character string)")
+	return newFileVault(Keys{EncodingKey: encodingKey}, filePath)
+}
+
+func newFileVault(keys Keys, filePath string) (*FileVault, error) {
+	kr, err := newKeyring(keys)
+	if err != nil {
+		return nil, err
 	}
 	if filePath == "" {
 		return nil, errors.New("filepath cannot be empty")
@@ -31,7 +33,7 @@ func NewFileVault(encodingKey string, filePath string) (*FileVault, error) {
 
 	var fv FileVault
 	fv.fp = filePath
-	fv.key = encodingKey
+	fv.kr = kr
 
 	return &fv, nil
 }
@@ -39,8 +41,8 @@ func NewFileVault(encodingKey string, filePath string) (*FileVault, error) {
 // FileVault holds data for getting & storing
 // encrypted data locally.
 type FileVault struct {
-	fp  string
-	key string
+	fp string
+	kr *keyring
 }
 
 // AllSecrets holds all stored secrets.
@@ -54,39 +56,28 @@ type Secret struct {
 	Value string
 }
 
-// Set adds a key-value pair to the FileVault.
+// Set adds a key-value pair to the FileVault, updating
+// the value if the key already exists.
 func (fv *FileVault) Set(key, val string) error {
+	if err := checkSecret(key, val); err != nil {
+		return err
+	}
 
 	// Grab the current secrets.
-	fb, err := fv.readEncrypted()
+	curSecrets, err := fv.load()
 	if err != nil {
 		return err
 	}
 
-	var curSecrets AllSecrets
-	if len(fb) > 0 {
-		if err := json.Unmarshal(fb, &curSecrets); err != nil {
-			return err
-		}
-	}
-
-	if key == "" || val == "" || key == "=" || val == "=" {
-		return fmt.Errorf("failed to create new secret with key '%s' and value '%s' because either key or value is invalid", key, val)
-	}
-
-	// Add the new secret, updating the key value
-	// if it already exists.
 	var found bool
 	for i, s := range curSecrets.Secrets {
 		if s.Key == key {
-			log.Printf("===> found duplicate - updating value for key '%s' to '%s'", key, val)
 			curSecrets.Secrets[i].Value = val
 			found = true
 		}
 	}
 
 	if !found {
-		log.Printf("===> adding new secret '%s: %s'", key, val)
 		curSecrets.Secrets = append(curSecrets.Secrets,
 			Secret{
 				Key:   key,
@@ -94,17 +85,7 @@ func (fv *FileVault) Set(key, val string) error {
 			})
 	}
 
-	secretBytes, err := json.Marshal(curSecrets)
-	if err != nil {
-		return err
-	}
-
-	// Encode and write the secrets into to the file.
-	if err = fv.writeEncrypted(secretBytes); err != nil {
-		return err
-	}
-
-	return nil
+	return fv.save(curSecrets)
 }
 
 // Get retrieves the value associated with the key.
@@ -114,100 +95,84 @@ func (fv *FileVault) Get(key string) (string, error) {
 	}
 
 	// Grab the current secrets.
-	fb, err := fv.readEncrypted()
+	curSecrets, err := fv.load()
 	if err != nil {
 		return "", err
 	}
 
-	if len(fb) == 0 {
-		return "", errors.New("secrets store is empty")
-	}
-
-	var curSecrets AllSecrets
-	if err := json.Unmarshal(fb, &curSecrets); err != nil {
-		return "", err
-	}
-
 	for _, s := range curSecrets.Secrets {
 		if s.Key == key {
 			return s.Value, nil
 		}
 	}
 
-	return "", fmt.Errorf("result not found for key '%s'", key)
+	return "", notFound(key)
 }
 
 // Delete removes the entry with a matching key
 // from the secrets store.
 func (fv *FileVault) Delete(key string) error {
+	if key == "" {
+		return errors.New("failed to delete secret because key value is empty")
+	}
 
 	// Grab the current secrets.
-	fb, err := fv.readEncrypted()
+	curSecrets, err := fv.load()
 	if err != nil {
 		return err
 	}
 
-	var curSecrets AllSecrets
-	if len(fb) > 0 {
-		if err := json.Unmarshal(fb, &curSecrets); err != nil {
-			return err
-		}
-	}
-
-	if key == "" {
-		return errors.New("failed to delete secret because key value is empty")
-	}
-
-	// Add the new secret, updating the key value
-	// if it already exists.
 	var found bool
 	for i, s := range curSecrets.Secrets {
 		if s.Key == key {
-			log.Printf("===> deleting secret with key '%s'", key)
 			curSecrets.Secrets = append(curSecrets.Secrets[:i], curSecrets.Secrets[i+1:]...)
 			found = true
+			break
 		}
 	}
 
 	if !found {
-		return errors.New("no secret with key '%s' in secrets store")
+		return notFound(key)
 	}
 
-	secretBytes, err := json.Marshal(curSecrets)
-	if err != nil {
-		return err
-	}
+	return fv.save(curSecrets)
+}
 
-	// Encode and write the secrets into to the file.
-	if err = fv.writeEncrypted(secretBytes); err != nil {
-		return err
+// List returns all currently stored secrets.
+func (fv *FileVault) List() ([]Secret, error) {
+	curSecrets, err := fv.load()
+	if err != nil {
+		return nil, err
 	}
-
-	return nil
+	return sortSecrets(curSecrets.Secrets), nil
 }
 
-// ListAll logs all currently stored secrets.
-func (fv *FileVault) ListAll() error {
-	// Grab the current secrets.
+// load reads and decrypts the secrets in the file.
+func (fv *FileVault) load() (AllSecrets, error) {
+	var curSecrets AllSecrets
+
 	fb, err := fv.readEncrypted()
 	if err != nil {
-		return err
+		return curSecrets, err
 	}
 
-	if len(fb) == 0 {
-		return errors.New("secrets store is empty")
+	if len(fb) > 0 {
+		if err := json.Unmarshal(fb, &curSecrets); err != nil {
+			return curSecrets, err
+		}
 	}
 
-	var curSecrets AllSecrets
-	if err := json.Unmarshal(fb, &curSecrets); err != nil {
-		return err
-	}
+	return curSecrets, nil
+}
 
-	for _, s := range curSecrets.Secrets {
-		fmt.Println(s.Key + ": " + s.Value)
+// save encrypts the secrets and writes them to the file.
+func (fv *FileVault) save(curSecrets AllSecrets) error {
+	secretBytes, err := json.Marshal(curSecrets)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return fv.writeEncrypted(secretBytes)
 }
 
 // readEncrypted gets the file bytes and decrypts them.
@@ -224,61 +189,124 @@ func (fv *FileVault) readEncrypted() ([]byte, error) {
 		return nil, nil
 	}
 
-	// Must convert to base 16 string
-	// for decode to work.
-	b16Bytes := fmt.Sprintf("%x", fb)
-
-	// Create the necessary ingredients for decryption.
-	key, _ := hex.DecodeString(fv.key)
-	ciphertext, _ := hex.DecodeString(b16Bytes)
+	return fv.kr.decrypt(fb)
+}
 
-	block, err := aes.NewCipher(key)
+// writeEncrypted creates a file that contains the bytes of
+// an encrypted string.
+func (fv *FileVault) writeEncrypted(plaintext []byte) error {
+	ciphertext, err := fv.kr.encrypt(plaintext)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if len(ciphertext) < aes.BlockSize {
-		return nil, fmt.Errorf("ciphertext too short, err: %s", err.Error())
-	}
+	// Once encrypted, the secrets can be written
+	// to the file.
+	return ioutil.WriteFile(fv.fp, ciphertext, 0600)
+}
 
-	iv := ciphertext[:aes.BlockSize]
-	ciphertext = ciphertext[aes.BlockSize:]
-	stream := cipher.NewCFBDecrypter(block, iv)
+// Migrate upgrades a file of secrets in the old format, keeping
+// a copy of it at the file's path with .bak added. The old format
+// can't tell a wrong key from the right one, so the secrets have
+// to decrypt to JSON before anything is written.
+func (fv *FileVault) Migrate(legacyKey string) (string, int, error) {
+	fb, err := ioutil.ReadFile(fv.fp)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(fb) == 0 || isVersioned(fb) {
+		return "", 0, nil
+	}
 
-	// Decrypt.
-	stream.XORKeyStream(ciphertext, ciphertext)
+	plaintext, err := decryptLegacy(legacyKey, fb)
+	if err != nil {
+		return "", 0, err
+	}
+	var curSecrets AllSecrets
+	if err := json.Unmarshal(plaintext, &curSecrets); err != nil {
+		return "", 0, errors.New("failed to decrypt old secrets, is encoding_key the key they were encrypted with?")
+	}
 
-	return ciphertext, nil
+	backup := fv.fp + ".bak"
+	if err := writeFileAtomic(backup, fb, 0600, nil); err != nil {
+		return "", 0, fmt.Errorf("error backing up secrets to %s, err: %s", backup, err)
+	}
+	ciphertext, err := fv.kr.encrypt(plaintext)
+	if err != nil {
+		return backup, 0, err
+	}
+	if err := writeFileAtomic(fv.fp, ciphertext, 0600, nil); err != nil {
+		return backup, 0, err
+	}
+	return backup, len(curSecrets.Secrets), nil
 }
 
-// writeEncrypted creates a file that contains the bytes of
-// an encrypted string.
-func (fv *FileVault) writeEncrypted(plaintext []byte) error {
-	key, _ := hex.DecodeString(fv.key)
-
-	// Create the necessary ingredients for encryption.
-	block, err := aes.NewCipher(key)
+// RotateKey encrypts the file's secrets again with to. The new
+// file is written next to the old one and only renamed over it
+// once it decrypts, with keys made afresh from to, to the same
+// secrets.
+func (fv *FileVault) RotateKey(to Keys, envelope bool) (int, error) {
+	fb, err := ioutil.ReadFile(fv.fp)
 	if err != nil {
-		return err
+		return 0, err
 	}
-
-	ciphertext := make([]byte, aes.BlockSize+len(plaintext))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return err
+	plaintext := []byte("{}")
+	if len(fb) > 0 {
+		if plaintext, err = fv.kr.decrypt(fb); err != nil {
+			return 0, err
+		}
+	}
+	var curSecrets AllSecrets
+	if err := json.Unmarshal(plaintext, &curSecrets); err != nil {
+		return 0, err
 	}
-	stream := cipher.NewCFBEncrypter(block, iv)
 
-	// Encrypt.
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], plaintext)
+	kr, err := newKeyring(to)
+	if err != nil {
+		return 0, err
+	}
+	var ciphertext []byte
+	switch {
+	case fv.kr.dataKey != nil:
+		// The secrets stay sealed with the data key, which
+		// only needs wrapping with the new master key.
+		kr.useDataKey(fv.kr.dataKey)
+		ciphertext, err = kr.rewrap(fb)
+	case envelope:
+		if err = kr.newDataKey(); err == nil {
+			ciphertext, err = kr.encrypt(plaintext)
+		}
+	default:
+		ciphertext, err = kr.encrypt(plaintext)
+	}
+	if err != nil {
+		return 0, err
+	}
 
-	// Once encrypted, the secrets can be written
-	// to the file.
-	if err := ioutil.WriteFile(fv.fp, ciphertext, 0777); err != nil {
-		return err
+	verify := func(tmp string) error {
+		b, err := ioutil.ReadFile(tmp)
+		if err != nil {
+			return err
+		}
+		check, err := newKeyring(to)
+		if err != nil {
+			return err
+		}
+		got, err := check.decrypt(b)
+		if err != nil {
+			return fmt.Errorf("failed to verify the re-encrypted secrets, err: %s", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			return errors.New("failed to verify the re-encrypted secrets, they don't match the old ones")
+		}
+		return nil
+	}
+	if err := writeFileAtomic(fv.fp, ciphertext, 0600, verify); err != nil {
+		return 0, err
 	}
 
-	return nil
+	fv.kr = kr
+	return len(curSecrets.Secrets), nil
 }
 
 // assertSecretsFile makes sure a file exists
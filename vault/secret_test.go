@@ -74,7 +74,7 @@ func TestListAll(t *testing.T) {
 		t.Errorf("failed to create new file vault with key '%s' and filepath '%s'", key, fp)
 	}
 
-	if err := fv.ListAll(); err != nil {
+	if _, err := fv.List(); err != nil {
 		t.Errorf("failed to list all in file vault, err: '%s'", err)
 	}
 }
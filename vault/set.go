@@ -4,7 +4,6 @@ import (
 	"log"
 
 	"github.com/spf13/cobra"
-	"github.com/spf13/viper"
 )
 
 // setCmd represents the set command.
@@ -23,17 +22,11 @@ var setCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		encodingKey := viper.GetString("encoding_key")
-		filePath := viper.GetString("filepath")
-
-		fv, err := NewFileVault(encodingKey, filePath)
-		if err != nil {
-			log.Fatalf("failed to create new file vault with encoding key '%s' and filepath '%s', err: %s", encodingKey, filePath, err)
-		}
-
-		if err := fv.Set(key, val); err != nil {
+		if err := mustVault().Set(key, val); err != nil {
 			log.Fatal(err)
 		}
+
+		log.Printf("===> stored secret '%s'", key)
 	},
 }
 
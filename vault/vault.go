@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Vault stores secrets by key.
+type Vault interface {
+	// Get retrieves the value associated with the key.
+	Get(key string) (string, error)
+	// Set stores a value under the key, replacing
+	// any value already there.
+	Set(key, val string) error
+	// Delete removes the secret with the key.
+	Delete(key string) error
+	// List returns all the secrets, sorted by key.
+	List() ([]Secret, error)
+}
+
+var (
+	_ Vault = (*FileVault)(nil)
+	_ Vault = (*BoltVault)(nil)
+	_ Vault = (*MemoryVault)(nil)
+
+	_ migrator = (*FileVault)(nil)
+	_ migrator = (*BoltVault)(nil)
+
+	_ rotator = (*FileVault)(nil)
+	_ rotator = (*BoltVault)(nil)
+)
+
+// migrator is a Vault that can have secrets in the old
+// unauthenticated format, from before encryption was versioned.
+type migrator interface {
+	// Migrate decrypts the old secrets with the hex-encoded key
+	// they were encrypted with and encrypts them again in the
+	// current format, after copying what was there to a backup.
+	// It returns the backup's path and how many secrets it
+	// migrated, which is none if they were up to date.
+	Migrate(legacyKey string) (backup string, n int, err error)
+}
+
+// NewVault is a factory function for the Vault backends:
+// "file" (the default), "bolt" or "memory". The file and
+// bolt vaults keep their secrets encrypted with keys at filePath.
+func NewVault(backend string, keys Keys, filePath string) (Vault, error) {
+	switch backend {
+	case "", "file":
+		return newFileVault(keys, filePath)
+	case "bolt":
+		return newBoltVault(keys, filePath)
+	case "memory":
+		return NewMemoryVault(), nil
+	}
+	return nil, fmt.Errorf("unknown vault backend '%s', must be file, bolt or memory", backend)
+}
+
+// checkEncodingKey makes sure the key is a hex-encoded
+// 16 byte AES key.
+func checkEncodingKey(encodingKey string) error {
+	if len(encodingKey) != 32 {
+		return errors.New("encoding key must have a length of 32 (hex-encoded 16 character string)")
+	}
+	if _, err := hex.DecodeString(encodingKey); err != nil {
+		return fmt.Errorf("encoding key must be hex-encoded, err: %s", err)
+	}
+	return nil
+}
+
+// checkSecret makes sure a key and value can be stored.
+func checkSecret(key, val string) error {
+	if key == "" || val == "" || key == "=" || val == "=" {
+		return fmt.Errorf("failed to create new secret with key '%s' because either key or value is invalid", key)
+	}
+	return nil
+}
+
+// notFound is the error for a key that isn't in a vault.
+func notFound(key string) error {
+	return fmt.Errorf("result not found for key '%s'", key)
+}
+
+// rotator is a Vault whose secrets are encrypted, and can
+// be encrypted again with other keys.
+type rotator interface {
+	// RotateKey encrypts the secrets again with to, checking
+	// they can be decrypted with it before the old ones are
+	// replaced, and uses to from then on. With envelope, or if
+	// it's already in use, the secrets are sealed with a data key
+	// and only that is encrypted with to. It returns how many
+	// secrets there are.
+	RotateKey(to Keys, envelope bool) (int, error)
+}
+
+// writeFileAtomic writes data to a temporary file next to
+// path and renames it into place, so path has either the old
+// data or the new and never half of it. If verify isn't nil,
+// it's given the temporary file to check before the rename.
+func writeFileAtomic(path string, data []byte, perm os.FileMode, verify func(tmp string) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if verify != nil {
+		if err := verify(tmp.Name()); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func sortSecrets(secrets []Secret) []Secret {
+	sort.Slice(secrets, func(i, j int) bool { return secrets[i].Key < secrets[j].Key })
+	return secrets
+}
+
+// MemoryVault keeps secrets in memory, for tests and for
+// trying things out. Its secrets are gone when it is.
+type MemoryVault struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+// NewMemoryVault is a factory function for MemoryVaults.
+func NewMemoryVault() *MemoryVault {
+	return &MemoryVault{secrets: make(map[string]string)}
+}
+
+// Get retrieves the value associated with the key.
+func (mv *MemoryVault) Get(key string) (string, error) {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+
+	val, ok := mv.secrets[key]
+	if !ok {
+		return "", notFound(key)
+	}
+	return val, nil
+}
+
+// Set adds a key-value pair to the MemoryVault.
+func (mv *MemoryVault) Set(key, val string) error {
+	if err := checkSecret(key, val); err != nil {
+		return err
+	}
+
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+	mv.secrets[key] = val
+	return nil
+}
+
+// Delete removes the entry with a matching key.
+func (mv *MemoryVault) Delete(key string) error {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+
+	if _, ok := mv.secrets[key]; !ok {
+		return notFound(key)
+	}
+	delete(mv.secrets, key)
+	return nil
+}
+
+// List returns all currently stored secrets.
+func (mv *MemoryVault) List() ([]Secret, error) {
+	mv.mu.Lock()
+	defer mv.mu.Unlock()
+
+	secrets := make([]Secret, 0, len(mv.secrets))
+	for k, v := range mv.secrets {
+		secrets = append(secrets, Secret{Key: k, Value: v})
+	}
+	return sortSecrets(secrets), nil
+}
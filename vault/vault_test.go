@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func TestVaults(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := "6D696E6E69657468656D6F6F63686572"
+	backends := []struct {
+		backend string
+		fp      string
+	}{
+		{"file", filepath.Join(dir, "file", "data.d")},
+		{"bolt", filepath.Join(dir, "bolt", "data.db")},
+		{"memory", ""},
+	}
+
+	for _, b := range backends {
+		t.Run(b.backend, func(t *testing.T) {
+			v, err := NewVault(b.backend, Keys{EncodingKey: key}, b.fp)
+			if err != nil {
+				t.Fatalf("failed to create %s vault, err: %s", b.backend, err)
+			}
+
+			if secrets, err := v.List(); err != nil || len(secrets) != 0 {
+				t.Errorf("new vault lists %v, err: %v", secrets, err)
+			}
+
+			for _, s := range []Secret{{"evernote", "123456"}, {"garage code", "8366"}, {"bank pin", "9994"}, {"garage code", "1234"}} {
+				if err := v.Set(s.Key, s.Value); err != nil {
+					t.Errorf("failed to set new secret with key '%s', err: %s", s.Key, err)
+				}
+			}
+			if err := v.Set("", "x"); err == nil {
+				t.Error("should have received error setting a secret with an empty key")
+			}
+
+			if got, err := v.Get("garage code"); err != nil || got != "1234" {
+				t.Errorf("got %q, %v looking up garage code, want 1234", got, err)
+			}
+			if _, err := v.Get("alarm"); err == nil {
+				t.Error("should have received error getting a key that isn't there")
+			}
+
+			if err := v.Delete("bank pin"); err != nil {
+				t.Errorf("failed to delete bank pin, err: %s", err)
+			}
+			if err := v.Delete("bank pin"); err == nil {
+				t.Error("should have received error deleting a key twice")
+			}
+
+			secrets, err := v.List()
+			want := []Secret{{"evernote", "123456"}, {"garage code", "1234"}}
+			if err != nil || len(secrets) != len(want) {
+				t.Fatalf("listed %v, err: %v, want %v", secrets, err, want)
+			}
+			for i := range want {
+				if secrets[i] != want[i] {
+					t.Errorf("listed %v, want %v", secrets, want)
+				}
+			}
+
+			// A new vault on the same file sees the same secrets.
+			if b.fp == "" {
+				return
+			}
+			v, err = NewVault(b.backend, Keys{EncodingKey: key}, b.fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := v.Get("evernote"); err != nil || got != "123456" {
+				t.Errorf("got %q, %v from reopened vault, want 123456", got, err)
+			}
+		})
+	}
+}
+
+func TestNewVault(t *testing.T) {
+	key := "6D696E6E69657468656D6F6F63686572"
+	tests := []struct {
+		name    string
+		backend string
+		key     string
+		fp      string
+	}{
+		{"unknown backend", "s3", key, "secrets.data"},
+		{"bad key", "bolt", "92725", "secrets.db"},
+		{"key not hex", "bolt", "zz696E6E69657468656D6F6F63686572", "secrets.db"},
+		{"no filepath", "bolt", key, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewVault(tt.backend, Keys{EncodingKey: tt.key}, tt.fp); err == nil {
+				t.Errorf("should have received error creating %s vault", tt.backend)
+			}
+		})
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := "6D696E6E69657468656D6F6F63686572"
+	rotations := []struct {
+		name     string
+		to       Keys
+		envelope bool
+	}{
+		{"new key", Keys{EncodingKey: "00112233445566778899AABBCCDDEEFF"}, false},
+		{"passphrase", Keys{Passphrase: "correct horse"}, false},
+		{"envelope", Keys{Passphrase: "battery staple"}, true},
+		{"rewrap", Keys{EncodingKey: key}, false},
+		{"rewrap again", Keys{Passphrase: "correct horse"}, false},
+	}
+
+	for _, backend := range []string{"file", "bolt"} {
+		t.Run(backend, func(t *testing.T) {
+			fp := filepath.Join(dir, backend, "data")
+			from := Keys{EncodingKey: key}
+			v, err := NewVault(backend, from, fp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []Secret{{"bank pin", "9994"}, {"garage code", "8366"}}
+			for _, s := range want {
+				if err := v.Set(s.Key, s.Value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var sealed []byte // what the data key sealed, once there is one
+			for _, r := range rotations {
+				n, err := v.(rotator).RotateKey(r.to, r.envelope)
+				if err != nil || n != len(want) {
+					t.Fatalf("%s: rotated %d secrets, err: %v, want %d", r.name, n, err, len(want))
+				}
+
+				if old, err := NewVault(backend, from, fp); err == nil {
+					if _, err := old.Get("garage code"); err == nil {
+						t.Errorf("%s: the old keys still decrypt the secrets", r.name)
+					}
+				}
+				from = r.to
+
+				v, err = NewVault(backend, r.to, fp)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := v.List()
+				if err != nil || len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+					t.Errorf("%s: listed %v, err: %v, want %v", r.name, got, err, want)
+				}
+
+				// Once there's a data key, rotating only wraps it again.
+				if s := sealedWithDataKey(t, backend, fp); sealed == nil {
+					sealed = s
+				} else if !bytes.Equal(s, sealed) {
+					t.Errorf("%s: the secrets were sealed again", r.name)
+				}
+				if r.envelope && sealed == nil {
+					t.Errorf("%s: the secrets aren't sealed with a data key", r.name)
+				}
+			}
+
+			if err := v.Set("alarm", "1234"); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := v.Get("alarm"); err != nil || got != "1234" {
+				t.Errorf("got %q, %v after rotating, want 1234", got, err)
+			}
+		})
+	}
+}
+
+// sealedWithDataKey returns the secrets at fp that are sealed
+// with a data key, without their headers.
+func sealedWithDataKey(t *testing.T, backend, fp string) []byte {
+	t.Helper()
+	var sealed []byte
+	add := func(ciphertext []byte) {
+		if size, err := headerSize(ciphertext); err == nil && ciphertext[5] == kdfData {
+			sealed = append(sealed, ciphertext[size:]...)
+		}
+	}
+
+	if backend == "file" {
+		fb, err := ioutil.ReadFile(fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		add(fb)
+		return sealed
+	}
+
+	db, err := bolt.Open(fp, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(secretsBucket)).ForEach(func(k, v []byte) error {
+			add(v)
+			return nil
+		})
+	})
+	return sealed
+}
+
+func TestBoltSalt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "data.db")
+
+	// Each vault is a run of the vault command.
+	keys := Keys{Passphrase: "correct horse"}
+	for _, s := range []Secret{{"bank pin", "9994"}, {"evernote", "123456"}, {"garage code", "8366"}} {
+		v, err := NewVault("bolt", keys, fp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := v.Set(s.Key, s.Value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if salts := boltSalts(t, fp); len(salts) != 1 {
+		t.Errorf("secrets set in 3 runs have %d salts, want 1", len(salts))
+	}
+
+	v, err := NewVault("bolt", keys, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys = Keys{Passphrase: "battery staple"}
+	if _, err := v.(rotator).RotateKey(keys, false); err != nil {
+		t.Fatal(err)
+	}
+	v, _ = NewVault("bolt", keys, fp)
+	if err := v.Set("alarm", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if salts := boltSalts(t, fp); len(salts) != 1 {
+		t.Errorf("secrets after rotating have %d salts, want 1", len(salts))
+	}
+}
+
+// boltSalts returns the scrypt salts the secrets at fp use.
+func boltSalts(t *testing.T, fp string) map[string]bool {
+	t.Helper()
+	db, err := bolt.Open(fp, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	salts := make(map[string]bool)
+	db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(secretsBucket)).ForEach(func(k, v []byte) error {
+			if v[5] == kdfScrypt {
+				salts[string(v[9:9+saltSize])] = true
+			}
+			return nil
+		})
+	})
+	return salts
+}